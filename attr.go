@@ -9,26 +9,80 @@ package dom
 
 import (
 	"encoding/xml"
+	"io"
 )
 
+// An attribute of an element.  The parent of an attribute is the element
+// that owns it, although ParentNode is nil as the DOM requires.  Like the
+// nodes from the Create methods, an attribute that is not owned by an
+// element refers to its owner document instead.
 type _attr struct {
 	_node
 	v string // value (for attr)
 }
 
 func (a *_attr) NodeType() uint           { return ATTRIBUTE_NODE }
-func (a *_attr) NodeName() string         { return a.n.Local }
+func (a *_attr) NodeName() string         { return a.qualifiedName() }
 func (a *_attr) NodeValue() string        { return a.v }
-func (a *_attr) PreviousSibling() Node    { return previousSibling(a, a.p.ChildNodes()) }
-func (a *_attr) NextSibling() Node        { return nextSibling(a, a.p.ChildNodes()) }
 func (a *_attr) AppendChild(n Node) Node  { return n }
 func (a *_attr) RemoveChild(n Node) Node  { return n }
 func (a *_attr) ParentNode() Node         { return Node(nil) }
-func (a *_attr) OwnerDocument() *Document { return ownerDocument(a) }
 func (a *_attr) ChildNodes() NodeList     { return NodeList(nil) }
 func (a *_attr) Attributes() NamedNodeMap { return NamedNodeMap(nil) }
+func (a *_attr) TextContent() string      { return a.v }
+func (a *_attr) SetTextContent(text string) {
+	a.SetValue(text)
+}
+func (a *_attr) CloneNode(deep bool) Node { return cloneNode(a, deep, a.OwnerDocument()) }
+func (a *_attr) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(a, w)
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-1112119403
+func (a *_attr) Name() string {
+	return a.qualifiedName()
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-221662474
+func (a *_attr) Value() string {
+	return a.v
+}
+
+// Changes the value, which is seen by the owner element.
+func (a *_attr) SetValue(value string) {
+	if e := a.OwnerElement(); e != nil {
+		e.attributeChanging(a.n, a.v)
+	}
+	a.v = value
+}
+
+// Returns the element the attribute belongs to, or nil.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Attr-ownerElement
+func (a *_attr) OwnerElement() *Element {
+	e, _ := a.p.(*Element)
+	return e
+}
+
+func (a *_attr) OwnerDocument() *Document {
+	switch p := a.p.(type) {
+	case *Element:
+		return p.OwnerDocument()
+	case *Document:
+		return p
+	}
+	return nil
+}
+
+// called when the attribute is removed from its element, so that it still
+// knows its owner document
+func (a *_attr) detach(d *Document) {
+	a.p = nil
+	if d != nil {
+		a.p = d
+	}
+}
 
-func newAttr(name string, val string) *_attr {
-	a := _attr{_node{nil, nil, xml.Name{"", name}}, val}
+func newAttr(name xml.Name, prefix string, val string) *_attr {
+	a := _attr{_node{n: name, pfx: prefix}, val}
 	return &a
 }
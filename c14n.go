@@ -0,0 +1,607 @@
+package dom
+
+/*
+ * Canonical XML
+ * http://www.w3.org/TR/xml-c14n
+ * http://www.w3.org/TR/xml-c14n11/
+ * http://www.w3.org/TR/xml-exc-c14n/
+ *
+ * A document, or the subtree below an element, is canonicalized as a
+ * whole, and a document subset as the node-set selecting it.  Attributes
+ * given default values by the DTD are not added, as the parser does not
+ * apply them.
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Identifiers of the canonicalization algorithms, as used by XML-DSig.
+const (
+	C14N_1_0          = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	C14N_1_0_COMMENTS = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments"
+	C14N_1_1          = "http://www.w3.org/2006/12/xml-c14n11"
+	C14N_1_1_COMMENTS = "http://www.w3.org/2006/12/xml-c14n11#WithComments"
+	EXC_C14N          = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	EXC_C14N_COMMENTS = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+)
+
+// A Canonicalizer writes the canonical form of a document or subtree.
+type Canonicalizer struct {
+	// One of the algorithm identifiers above.  The default is C14N_1_0.
+	Algorithm string
+	// For exclusive canonicalization, the prefixes of namespaces that are
+	// treated as for inclusive canonicalization.  The default namespace is
+	// given as "#default".
+	InclusiveNamespaces []string
+
+	// nodes for which skip returns true are left out, along with their
+	// subtrees
+	skip func(Node) bool
+}
+
+// Returns the canonical form of n, which must be a Document or an Element.
+func Canonicalize(n Node, algorithm string) ([]byte, error) {
+	c := &Canonicalizer{Algorithm: algorithm}
+	return c.Canonicalize(n)
+}
+
+// Returns the canonical form of n, which must be a Document or an Element.
+func (c *Canonicalizer) Canonicalize(n Node) ([]byte, error) {
+	var b bytes.Buffer
+	if err := c.CanonicalizeTo(&b, n); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Writes the canonical form of n, which must be a Document or an Element,
+// to w.
+func (c *Canonicalizer) CanonicalizeTo(w io.Writer, n Node) error {
+	enc, err := c.newEncoder(w)
+	if err != nil {
+		return err
+	}
+	switch n := n.(type) {
+	case *Document:
+		enc.writeDocument(n)
+	case *Element:
+		scope := map[string]string{}
+		if p, ok := n.ParentNode().(*Element); ok {
+			scope = inScopeNamespaces(p)
+		}
+		enc.writeElement(n, scope, map[string]string{}, true)
+	default:
+		return &EncoderError{"only documents and elements can be canonicalized"}
+	}
+	return enc.flush()
+}
+
+// Returns the canonical form of the document subset made of nodes.
+func (c *Canonicalizer) CanonicalizeSubset(nodes NodeList) ([]byte, error) {
+	var b bytes.Buffer
+	if err := c.CanonicalizeSubsetTo(&b, nodes); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Writes the canonical form of the document subset made of nodes, which
+// belong to a single tree, to w.  The subset is usually selected by an
+// XPath expression such as (//. | //@* | //namespace::*)[...], as only
+// the elements, attributes and namespace nodes in it are written: an
+// element without its namespace nodes declares no namespaces.
+// http://www.w3.org/TR/xml-c14n#DocSubsets
+func (c *Canonicalizer) CanonicalizeSubsetTo(w io.Writer, nodes NodeList) error {
+	enc, err := c.newEncoder(w)
+	if err != nil {
+		return err
+	}
+	enc.subset = map[Node]bool{}
+	enc.namespaces = map[*Element]map[string]string{}
+	var top Node
+	for i := uint(0); i < nodes.Length(); i++ {
+		n := nodes.Item(i)
+		switch n := n.(type) {
+		case *_xpathNamespace:
+			if n.owner == nil {
+				continue
+			}
+			if enc.namespaces[n.owner] == nil {
+				enc.namespaces[n.owner] = map[string]string{}
+			}
+			enc.namespaces[n.owner][n.n.Local] = n.uri
+			top = n.owner
+			continue
+		case Attr:
+			if e := n.OwnerElement(); e != nil {
+				top = e
+			}
+		default:
+			top = n
+		}
+		enc.subset[n] = true
+	}
+	if top != nil {
+		switch root := rootOf(top).(type) {
+		case *Document:
+			enc.writeDocument(root)
+		case *Element:
+			enc.writeSubset(root, nil, map[string]string{})
+		}
+	}
+	return enc.flush()
+}
+
+func (c *Canonicalizer) newEncoder(w io.Writer) (*_c14nEncoder, error) {
+	enc := &_c14nEncoder{w: bufio.NewWriter(w), skip: c.skip}
+	switch c.Algorithm {
+	case "", C14N_1_0:
+	case C14N_1_0_COMMENTS:
+		enc.comments = true
+	case C14N_1_1:
+		enc.v11 = true
+	case C14N_1_1_COMMENTS:
+		enc.v11, enc.comments = true, true
+	case EXC_C14N:
+		enc.exclusive = true
+	case EXC_C14N_COMMENTS:
+		enc.exclusive, enc.comments = true, true
+	default:
+		return nil, &EncoderError{"unsupported canonicalization algorithm " + c.Algorithm}
+	}
+	if enc.exclusive {
+		enc.inclusive = map[string]bool{}
+		for _, p := range c.InclusiveNamespaces {
+			if p == "#default" {
+				p = ""
+			}
+			enc.inclusive[p] = true
+		}
+	}
+	return enc, nil
+}
+
+// ====================================
+
+type _c14nEncoder struct {
+	w         *bufio.Writer
+	err       error
+	comments  bool
+	v11       bool
+	exclusive bool
+	inclusive map[string]bool // prefixes from InclusiveNamespaces
+	skip      func(Node) bool
+
+	// for a document subset, the nodes in it, and the namespace nodes in
+	// it for each element
+	subset     map[Node]bool
+	namespaces map[*Element]map[string]string
+}
+
+// an attribute or namespace declaration to be written
+type _c14nAttr struct {
+	space, local, qname, value string
+}
+
+func (enc *_c14nEncoder) flush() error {
+	if err := enc.w.Flush(); enc.err == nil {
+		enc.err = err
+	}
+	return enc.err
+}
+
+func (enc *_c14nEncoder) write(s string) {
+	if enc.err == nil {
+		_, enc.err = enc.w.WriteString(s)
+	}
+}
+
+func (enc *_c14nEncoder) skipped(n Node) bool {
+	if enc.skip != nil && enc.skip(n) {
+		return true
+	}
+	return n.NodeType() == COMMENT_NODE && !enc.comments
+}
+
+// http://www.w3.org/TR/xml-c14n#DocumentOrder
+func (enc *_c14nEncoder) writeDocument(d *Document) {
+	root := false
+	for c := d.FirstChild(); c != nil; c = c.NextSibling() {
+		if enc.skipped(c) {
+			continue
+		}
+		switch c.NodeType() {
+		case ELEMENT_NODE:
+			if enc.subset != nil {
+				enc.writeSubset(c.(*Element), nil, map[string]string{})
+			} else {
+				enc.writeElement(c.(*Element), map[string]string{}, map[string]string{}, false)
+			}
+			root = true
+		case COMMENT_NODE, PROCESSING_INSTRUCTION_NODE:
+			if enc.subset != nil && !enc.subset[c] {
+				continue
+			}
+			// nodes outside of the document element are separated by line feeds
+			if root {
+				enc.write("\n")
+			}
+			enc.writeNode(c)
+			if !root {
+				enc.write("\n")
+			}
+		}
+	}
+}
+
+func (enc *_c14nEncoder) writeNode(n Node) {
+	switch n.NodeType() {
+	case TEXT_NODE, CDATA_SECTION_NODE:
+		enc.writeEscaped(n.NodeValue(), false)
+	case COMMENT_NODE:
+		enc.write("<!--" + n.NodeValue() + "-->")
+	case PROCESSING_INSTRUCTION_NODE:
+		enc.write("<?" + n.NodeName())
+		if data := n.NodeValue(); data != "" {
+			enc.write(" " + data)
+		}
+		enc.write("?>")
+	}
+}
+
+func (enc *_c14nEncoder) writeEscaped(s string, attr bool) {
+	for _, r := range s {
+		switch {
+		case r == '&':
+			enc.write("&amp;")
+		case r == '<':
+			enc.write("&lt;")
+		case r == '>' && !attr:
+			enc.write("&gt;")
+		case r == '"' && attr:
+			enc.write("&quot;")
+		case r == '\t' && attr:
+			enc.write("&#x9;")
+		case r == '\n' && attr:
+			enc.write("&#xA;")
+		case r == '\r':
+			enc.write("&#xD;")
+		default:
+			if enc.err == nil {
+				_, enc.err = enc.w.WriteRune(r)
+			}
+		}
+	}
+}
+
+// Writes an element and its subtree.  scope holds the namespaces in scope
+// at the parent, and rendered the namespaces declared by the output
+// ancestors.  The apex is the top of a subtree being canonicalized.
+func (enc *_c14nEncoder) writeElement(e *Element, scope, rendered map[string]string, apex bool) {
+	scope = elementNamespaces(e, scope)
+
+	// namespace declarations
+	decls := []_c14nAttr{}
+	if enc.exclusive {
+		for prefix := range enc.visiblyUtilized(e, scope) {
+			decls = declareNamespace(decls, rendered, prefix, scope[prefix])
+		}
+	} else {
+		for prefix, uri := range scope {
+			decls = declareNamespace(decls, rendered, prefix, uri)
+		}
+	}
+
+	// attributes
+	attrs := []_c14nAttr{}
+	for i := range e.attribs {
+		if a := e.attribs[i]; a.n.Space != XMLNS_NAMESPACE {
+			attrs = append(attrs, _c14nAttr{a.n.Space, a.n.Local, a.qualifiedName(), a.v})
+		}
+	}
+	if apex && !enc.exclusive {
+		attrs = enc.inheritXmlAttributes(e, attrs)
+	}
+
+	rendered = enc.writeStartTag(e, decls, attrs, rendered)
+	for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+		if enc.skipped(c) {
+			continue
+		}
+		if ce, ok := c.(*Element); ok {
+			enc.writeElement(ce, scope, rendered, false)
+		} else {
+			enc.writeNode(c)
+		}
+	}
+	enc.write("</" + e.NodeName() + ">")
+}
+
+// Writes the nodes of the subtree of n that are in the subset.  a is the
+// nearest ancestor of n in the subset, if any, and rendered holds the
+// namespaces declared by the output ancestors.
+func (enc *_c14nEncoder) writeSubset(n Node, a *Element, rendered map[string]string) {
+	if enc.skipped(n) {
+		return
+	}
+	e, ok := n.(*Element)
+	if !ok {
+		if enc.subset[n] {
+			enc.writeNode(n)
+		}
+		return
+	}
+	in := enc.subset[e]
+	if in {
+		ns := enc.namespaces[e]
+		decls := []_c14nAttr{}
+		if enc.exclusive {
+			for prefix := range enc.visiblyUtilized(e, ns) {
+				decls = declareNamespace(decls, rendered, prefix, ns[prefix])
+			}
+		} else {
+			// namespace nodes are left out when the nearest output ancestor
+			// has the same ones, and the default namespace is undeclared
+			// when the ancestor has one and e does not
+			// http://www.w3.org/TR/xml-c14n#DocSubsets
+			var parent map[string]string
+			if a != nil {
+				parent = enc.namespaces[a]
+			}
+			for prefix, uri := range ns {
+				if have, ok := parent[prefix]; prefix != "xml" && (!ok || have != uri) {
+					decls = declareNamespace(decls, nil, prefix, uri)
+				}
+			}
+			if _, ok := ns[""]; !ok && parent[""] != "" {
+				decls = append(decls, _c14nAttr{"", "", "xmlns", ""})
+			}
+		}
+
+		attrs := []_c14nAttr{}
+		for i := range e.attribs {
+			if a := e.attribs[i]; a.n.Space != XMLNS_NAMESPACE && enc.subset[a] {
+				attrs = append(attrs, _c14nAttr{a.n.Space, a.n.Local, a.qualifiedName(), a.v})
+			}
+		}
+		if p := parentElement(e); !enc.exclusive && (p == nil || !enc.subset[p]) {
+			attrs = enc.inheritXmlAttributes(e, attrs)
+		}
+		rendered = enc.writeStartTag(e, decls, attrs, rendered)
+		a = e
+	}
+	for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+		enc.writeSubset(c, a, rendered)
+	}
+	if in {
+		enc.write("</" + e.NodeName() + ">")
+	}
+}
+
+// Writes the start tag of e with the namespace declarations and the
+// attributes in canonical order, and returns the namespaces declared by
+// the output ancestors of its children.
+func (enc *_c14nEncoder) writeStartTag(e *Element, decls, attrs []_c14nAttr, rendered map[string]string) map[string]string {
+	sort.Slice(decls, func(i, j int) bool { return decls[i].local < decls[j].local })
+	if len(decls) > 0 {
+		rendered = copyNamespaces(rendered)
+		for _, d := range decls {
+			rendered[d.local] = d.value
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	enc.write("<" + e.NodeName())
+	for _, a := range append(decls, attrs...) {
+		enc.write(" " + a.qname + "=\"")
+		enc.writeEscaped(a.value, true)
+		enc.write("\"")
+	}
+	enc.write(">")
+	return rendered
+}
+
+// Returns the prefixes of the namespaces that e visibly utilizes, along
+// with the prefixes from InclusiveNamespaces declared in scope.  In a
+// document subset, only the attributes in the subset count.
+// http://www.w3.org/TR/xml-exc-c14n/#def-visibly-utilizes
+func (enc *_c14nEncoder) visiblyUtilized(e *Element, scope map[string]string) map[string]bool {
+	used := map[string]bool{e.pfx: true}
+	for i := range e.attribs {
+		a := e.attribs[i]
+		if a.pfx != "" && a.pfx != "xml" && a.n.Space != XMLNS_NAMESPACE && (enc.subset == nil || enc.subset[a]) {
+			used[a.pfx] = true
+		}
+	}
+	for prefix := range enc.inclusive {
+		if _, ok := scope[prefix]; ok {
+			used[prefix] = true
+		}
+	}
+	return used
+}
+
+// Appends the declaration of prefix to decls, unless the output ancestors
+// already declare it.
+func declareNamespace(decls []_c14nAttr, rendered map[string]string, prefix, uri string) []_c14nAttr {
+	if have, ok := rendered[prefix]; ok && have == uri || !ok && uri == "" {
+		// already in effect, or an empty default namespace that was never changed
+		return decls
+	}
+	qname := "xmlns"
+	if prefix != "" {
+		if uri == "" {
+			// prefixes cannot be undeclared in XML 1.0
+			return decls
+		}
+		qname += ":" + prefix
+	}
+	return append(decls, _c14nAttr{"", prefix, qname, uri})
+}
+
+// Adds the attributes in the xml namespace from the ancestors of the apex
+// of a subtree.  C14N 1.1 only inherits xml:lang and xml:space, and joins
+// the values of xml:base.
+// http://www.w3.org/TR/xml-c14n11/#ProcessingModel
+func (enc *_c14nEncoder) inheritXmlAttributes(e *Element, attrs []_c14nAttr) []_c14nAttr {
+	have := map[string]int{}
+	for i, a := range attrs {
+		if a.space == XML_NAMESPACE {
+			have[a.local] = i
+		}
+	}
+	if enc.subset != nil {
+		// attributes of e left out of the subset are not inherited either
+		for i := range e.attribs {
+			if a := e.attribs[i]; a.n.Space == XML_NAMESPACE {
+				if _, ok := have[a.n.Local]; !ok {
+					have[a.n.Local] = -1
+				}
+			}
+		}
+	}
+	var bases []string // from the nearest ancestor outwards
+	for p := parentElement(e); p != nil; p = parentElement(p) {
+		if enc.subset[p] {
+			// the nearest output ancestor carries its own
+			break
+		}
+		for i := range p.attribs {
+			a := p.attribs[i]
+			if a.n.Space != XML_NAMESPACE {
+				continue
+			}
+			if enc.v11 {
+				switch a.n.Local {
+				case "base":
+					bases = append(bases, a.v)
+					continue
+				case "id":
+					continue
+				}
+			}
+			if _, ok := have[a.n.Local]; !ok {
+				have[a.n.Local] = len(attrs)
+				attrs = append(attrs, _c14nAttr{XML_NAMESPACE, a.n.Local, a.qualifiedName(), a.v})
+			}
+		}
+	}
+	if len(bases) == 0 {
+		return attrs
+	}
+	base := bases[len(bases)-1]
+	for i := len(bases) - 2; i >= 0; i-- {
+		base = joinURIs(base, bases[i])
+	}
+	if i, ok := have["base"]; ok {
+		if i >= 0 {
+			attrs[i].value = joinURIs(base, attrs[i].value)
+		}
+	} else {
+		attrs = append(attrs, _c14nAttr{XML_NAMESPACE, "base", "xml:base", base})
+	}
+	return attrs
+}
+
+// resolves ref against base
+// http://www.w3.org/TR/xml-c14n11/#XMLBaseFixup
+func joinURIs(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	if b.IsAbs() || b.Host != "" || r.IsAbs() || r.Host != "" {
+		return b.ResolveReference(r).String()
+	}
+	// a relative base stays relative, rather than being resolved against
+	// the root as url does
+	if ref == "" || strings.HasPrefix(ref, "/") {
+		return ref
+	}
+	path := ref
+	if i := strings.LastIndex(base, "/"); i >= 0 {
+		path = base[:i+1] + ref
+	}
+	return removeDotSegments(path)
+}
+
+// removes the "." and ".." segments from a relative path, keeping the ".."
+// segments that go above its start
+func removeDotSegments(path string) string {
+	segments := strings.Split(path, "/")
+	out := []string{}
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch {
+		case s == ".":
+			if last {
+				out = append(out, "")
+			}
+		case s == ".." && len(out) > 0 && out[len(out)-1] != "..":
+			out = out[:len(out)-1]
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// returns the namespaces in scope at e, given those in scope at its
+// parent.  Elements and attributes using a namespace that was not
+// declared, such as those from CreateElementNS, declare it implicitly.
+func elementNamespaces(e *Element, parent map[string]string) map[string]string {
+	scope, copied := parent, false
+	set := func(prefix, uri string) {
+		if v, ok := scope[prefix]; ok && v == uri || !ok && uri == "" {
+			return
+		}
+		if !copied {
+			scope, copied = copyNamespaces(parent), true
+		}
+		scope[prefix] = uri
+	}
+	for i := range e.attribs {
+		a := e.attribs[i]
+		switch {
+		case a.n.Space == XMLNS_NAMESPACE && a.pfx == "xmlns":
+			set(a.n.Local, a.v)
+		case a.n.Space == XMLNS_NAMESPACE:
+			set("", a.v)
+		}
+	}
+	set(e.pfx, e.n.Space)
+	for i := range e.attribs {
+		if a := e.attribs[i]; a.pfx != "" && a.pfx != "xml" && a.pfx != "xmlns" {
+			set(a.pfx, a.n.Space)
+		}
+	}
+	return scope
+}
+
+func copyNamespaces(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m)+1)
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
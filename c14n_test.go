@@ -0,0 +1,303 @@
+package dom
+
+import (
+	"testing"
+)
+
+// Examples from section 3 of http://www.w3.org/TR/xml-c14n.  Parts that
+// depend on attribute defaults or types from the DTD, external entities,
+// or a charset other than UTF-8 have been removed.
+var c14nVectors = []struct {
+	name, in, out, outComments string
+}{
+	{"3.1", `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`, `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!</doc>
+<?pi-without-data?>`, `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!<!-- Comment 1 --></doc>
+<?pi-without-data?>
+<!-- Comment 2 -->
+<!-- Comment 3 -->`},
+	{"3.2", `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`, `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`, ""},
+	{"3.3", `<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`, `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`, ""},
+	{"3.4", `<doc>
+   <text>First line&#x0d;&#10;Second line</text>
+   <value>&#x32;</value>
+   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>
+   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>
+   <norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+</doc>`, `<doc>
+   <text>First line&#xD;
+Second line</text>
+   <value>2</value>
+   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>
+   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>
+   <norm attr=" '    &#xD;&#xA;&#x9;   ' "></norm>
+</doc>`, ""},
+	{"3.5", `<!DOCTYPE doc [
+<!ENTITY ent1 "Hello">
+<!ENTITY ent2 "world">
+<!ENTITY entExt SYSTEM "earth.gif" NDATA gif>
+<!NOTATION gif SYSTEM "viewgif.exe">
+]>
+<doc attrExtEnt="entExt">
+   &ent1;, &ent2;!
+</doc>
+
+<!-- Let world.txt contain "world" (excluding the quotes) -->`, `<doc attrExtEnt="entExt">
+   Hello, world!
+</doc>`, `<doc attrExtEnt="entExt">
+   Hello, world!
+</doc>
+<!-- Let world.txt contain "world" (excluding the quotes) -->`},
+	{"3.6", `<?xml version="1.0" encoding="UTF-8"?>
+<doc>&#169;</doc>`, "<doc>\u00a9</doc>", ""},
+}
+
+func TestCanonicalizeVectors(t *testing.T) {
+	for _, v := range c14nVectors {
+		d, err := ParseStringXml(v.in)
+		if err != nil {
+			t.Errorf("Example %s: error parsing document (%v).", v.name, err)
+			continue
+		}
+		outComments := v.outComments
+		if outComments == "" {
+			outComments = v.out
+		}
+		algorithms := []struct{ plain, comments string }{
+			{C14N_1_0, C14N_1_0_COMMENTS},
+			{C14N_1_1, C14N_1_1_COMMENTS},
+		}
+		for _, alg := range algorithms {
+			if b, err := Canonicalize(d, alg.plain); err != nil || string(b) != v.out {
+				t.Errorf("Example %s with %s:\n%s\n(%v)", v.name, alg.plain, b, err)
+			}
+			if b, err := Canonicalize(d, alg.comments); err != nil || string(b) != outComments {
+				t.Errorf("Example %s with %s:\n%s\n(%v)", v.name, alg.comments, b, err)
+			}
+		}
+	}
+}
+
+// Example 3.7 from http://www.w3.org/TR/xml-c14n, and 3.8 from
+// http://www.w3.org/TR/xml-c14n11, with the attribute defaults from the
+// DTD given explicitly.
+const c14nSubsetXPath = `(//. | //@* | //namespace::*)
+[
+   self::ietf:e1 or (parent::ietf:e1 and not(self::text() or self::e2))
+   or
+   count(id("E3")|ancestor-or-self::node()) = count(ancestor-or-self::node())
+]`
+
+func TestCanonicalizeSubsetVectors(t *testing.T) {
+	test_cases := []struct {
+		name, algorithm, in, out string
+	}{
+		{"3.7", C14N_1_0, `<doc xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org">
+   <e1>
+      <e2 xmlns="" xml:space="preserve">
+         <e3 id="E3"/>
+      </e2>
+   </e1>
+</doc>`, `<e1 xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org"><e3 xmlns="" id="E3" xml:space="preserve"></e3></e1>`},
+		{"3.7", C14N_1_1, `<doc xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org">
+   <e1>
+      <e2 xmlns="" xml:space="preserve">
+         <e3 id="E3"/>
+      </e2>
+   </e1>
+</doc>`, `<e1 xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org"><e3 xmlns="" id="E3" xml:space="preserve"></e3></e1>`},
+		{"3.8", C14N_1_1, `<doc xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org" xml:base="something/else">
+   <e1>
+      <e2 xmlns="" xml:id="abc" xml:base="bar/" xml:space="preserve">
+         <e3 id="E3" xml:base="foo"/>
+      </e2>
+   </e1>
+</doc>`, `<e1 xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org" xml:base="something/else"><e3 xmlns="" id="E3" xml:base="bar/foo" xml:space="preserve"></e3></e1>`},
+	}
+	x := MustCompileXPath(c14nSubsetXPath)
+	ctx := &XPathContext{Namespaces: map[string]string{"ietf": "http://www.ietf.org"}}
+	for _, v := range test_cases {
+		d, err := ParseStringXml(v.in)
+		if err != nil {
+			t.Errorf("Example %s: error parsing document (%v).", v.name, err)
+			continue
+		}
+		r, err := x.EvaluateWith(d, ctx)
+		if err != nil {
+			t.Errorf("Example %s: error selecting the subset (%v).", v.name, err)
+			continue
+		}
+		c := &Canonicalizer{Algorithm: v.algorithm}
+		if b, err := c.CanonicalizeSubset(r.Nodes()); err != nil || string(b) != v.out {
+			t.Errorf("Example %s with %s:\n%s\n(%v)", v.name, v.algorithm, b, err)
+		}
+	}
+}
+
+// Example from section 2.2 of http://www.w3.org/TR/xml-exc-c14n
+const excC14nDoc = `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+    <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2>
+</n0:local>`
+
+func TestCanonicalizeSubtree(t *testing.T) {
+	d, err := ParseStringXml(excC14nDoc)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	elem2 := d.DocumentElement().GetElementsByTagName("n1:elem2").Item(0)
+
+	test_cases := []struct {
+		c   Canonicalizer
+		out string
+	}{
+		{Canonicalizer{Algorithm: C14N_1_0}, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en">
+    <n3:stuff></n3:stuff>
+  </n1:elem2>`},
+		{Canonicalizer{Algorithm: EXC_C14N}, `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`},
+		{Canonicalizer{Algorithm: EXC_C14N, InclusiveNamespaces: []string{"n0", "n3", "missing"}}, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en">
+    <n3:stuff></n3:stuff>
+  </n1:elem2>`},
+	}
+	for _, v := range test_cases {
+		if b, err := v.c.Canonicalize(elem2); err != nil || string(b) != v.out {
+			t.Errorf("Canonicalizing subtree with %s %v:\n%s\n(%v)", v.c.Algorithm, v.c.InclusiveNamespaces, b, err)
+		}
+	}
+}
+
+func TestCanonicalizeExclusiveDefault(t *testing.T) {
+	d, err := ParseStringXml(`<a xmlns="urn:a" xmlns:p="urn:p"><b xmlns=""><p:c/></b></a>`)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	b := d.DocumentElement().FirstChild()
+
+	test_cases := []struct {
+		c   Canonicalizer
+		out string
+	}{
+		{Canonicalizer{Algorithm: C14N_1_0}, `<b xmlns:p="urn:p"><p:c></p:c></b>`},
+		{Canonicalizer{Algorithm: EXC_C14N}, `<b><p:c xmlns:p="urn:p"></p:c></b>`},
+		{Canonicalizer{Algorithm: EXC_C14N, InclusiveNamespaces: []string{"#default", "p"}}, `<b xmlns:p="urn:p"><p:c></p:c></b>`},
+	}
+	for _, v := range test_cases {
+		if out, err := v.c.Canonicalize(b); err != nil || string(out) != v.out {
+			t.Errorf("Canonicalizing subtree with %s %v:\n%s\n(%v)", v.c.Algorithm, v.c.InclusiveNamespaces, out, err)
+		}
+	}
+	if out, _ := Canonicalize(d, EXC_C14N); string(out) != `<a xmlns="urn:a"><b xmlns=""><p:c xmlns:p="urn:p"></p:c></b></a>` {
+		t.Errorf("Canonicalizing document:\n%s", out)
+	}
+}
+
+func TestCanonicalizeXmlAttributes(t *testing.T) {
+	d, err := ParseStringXml(`<a xml:base="http://example.org/x/" xml:lang="en" xml:id="a"><b xml:base="y/" xml:space="preserve"><c xml:base="z"/><d/></b></a>`)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	b := d.DocumentElement().FirstChild()
+	c, dd := b.FirstChild(), b.LastChild()
+
+	test_cases := []struct {
+		n         Node
+		algorithm string
+		out       string
+	}{
+		{c, C14N_1_0, `<c xml:base="z" xml:id="a" xml:lang="en" xml:space="preserve"></c>`},
+		{c, C14N_1_1, `<c xml:base="http://example.org/x/y/z" xml:lang="en" xml:space="preserve"></c>`},
+		{dd, C14N_1_0, `<d xml:base="y/" xml:id="a" xml:lang="en" xml:space="preserve"></d>`},
+		{dd, C14N_1_1, `<d xml:base="http://example.org/x/y/" xml:lang="en" xml:space="preserve"></d>`},
+		{dd, EXC_C14N, `<d></d>`},
+	}
+	for _, v := range test_cases {
+		if out, err := Canonicalize(v.n, v.algorithm); err != nil || string(out) != v.out {
+			t.Errorf("Canonicalizing <%s> with %s:\n%s\n(%v)", v.n.NodeName(), v.algorithm, out, err)
+		}
+	}
+}
+
+func TestCanonicalizeCreated(t *testing.T) {
+	d, _ := ParseStringXml(`<a:root xmlns:a="urn:a"/>`)
+	root := d.DocumentElement()
+	child := d.CreateElementNS("urn:b", "child")
+	child.SetAttributeNS("urn:c", "c:attr", "1")
+	root.AppendChild(child)
+	root.AppendChild(d.CreateElement("plain"))
+
+	out, err := Canonicalize(d, C14N_1_0)
+	if err != nil || string(out) != `<a:root xmlns:a="urn:a"><child xmlns="urn:b" xmlns:c="urn:c" c:attr="1"></child><plain></plain></a:root>` {
+		t.Errorf("Canonicalizing created nodes:\n%s\n(%v)", out, err)
+	}
+	if _, err := Canonicalize(d, "urn:unknown"); err == nil {
+		t.Errorf("Unknown algorithm accepted")
+	}
+}
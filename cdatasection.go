@@ -0,0 +1,56 @@
+package dom
+
+/*
+ * CDATASection implementation
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// A block of text that was written as <![CDATA[...]]> in the source, and
+// that is serialized the same way.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-667469212
+type CDATASection struct {
+	Text
+}
+
+func (n *CDATASection) NodeType() uint           { return CDATA_SECTION_NODE }
+func (n *CDATASection) NodeName() (s string)     { return "#cdata-section" }
+func (n *CDATASection) NodeValue() (s string)    { return string(n.content) }
+func (n *CDATASection) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *CDATASection) CloneNode(deep bool) Node { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *CDATASection) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+
+func newCDATASection(token xml.CharData) *CDATASection {
+	n := new(CDATASection)
+	n.content = token.Copy()
+	return n
+}
+
+// Like Text.SplitText, but the new node is also a CDATA section.
+func (n *CDATASection) SplitText(offset uint32) *CDATASection {
+	t, _ := n.TrySplitText(offset)
+	return t
+}
+
+func (n *CDATASection) TrySplitText(offset uint32) (*CDATASection, error) {
+	t := newCDATASection(nil)
+	if err := splitText(n, &n.CharacterData, offset, t, &t.CharacterData); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (n *CDATASection) ReplaceWholeText(content string) *CDATASection {
+	if !replaceWholeText(&n._node, content) {
+		return nil
+	}
+	n.SetData(content)
+	return n
+}
@@ -1,6 +1,7 @@
 package dom
 
 import (
+	"io"
 	"strconv"
 )
 
@@ -20,16 +21,24 @@ type CharacterData struct {
 func (n *CharacterData) NodeType() uint           { return CDATA_SECTION_NODE }
 func (n *CharacterData) NodeName() (s string)     { return "#cdata-section" }
 func (n *CharacterData) NodeValue() (s string)    { return string(n.content) }
-func (n *CharacterData) PreviousSibling() Node    { return previousSibling(Node(n), n.p.ChildNodes()) }
-func (n *CharacterData) NextSibling() Node        { return nextSibling(Node(n), n.p.ChildNodes()) }
 func (n *CharacterData) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *CharacterData) CloneNode(deep bool) Node { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *CharacterData) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+
+func (n *CharacterData) TextContent() string        { return string(n.content) }
+func (n *CharacterData) SetTextContent(text string) { n.SetData(text) }
 
 func (n *CharacterData) Data() string {
 	return string(n.content)
 }
 
 func (n *CharacterData) SetData(s string) {
+	dataChanging(&n._node, n.Data)
+	count := len(n.content)
 	n.content = []byte(s)
+	dataReplaced(&n._node, 0, uint32(count), uint32(len(s)))
 }
 
 func (n *CharacterData) Length() uint32 {
@@ -37,58 +46,71 @@ func (n *CharacterData) Length() uint32 {
 }
 
 func (n *CharacterData) SubstringData(offset uint32, count uint32) string {
-	// Code does not follow DOM specification
-	// Offset and count should be in code points (?)
-
-	if offset+count >= uint32(len(n.content)) {
-		// May still throw error if offset is too large
-		return string(n.content[offset:])
-	}
-
-	// return slice
-	return string(n.content[offset : offset+count])
+	s, _ := n.TrySubstringData(offset, count)
+	return s
 }
 
 func (n *CharacterData) AppendData(data string) {
+	dataChanging(&n._node, n.Data)
 	n.content = append(n.content, []byte(data)...)
 }
 
 func (n *CharacterData) InsertData(offset uint32, data string) {
-	if offset == 0 {
-		n.content = append([]byte(data), n.content...)
-	}
-
-	tmp := append(n.content[0:offset], []byte(data)...)
-	n.content = append(tmp, n.content[offset:]...)
+	n.TryInsertData(offset, data)
 }
 
 func (n *CharacterData) DeleteData(offset, count uint32) {
-	if offset == 0 {
-		if count > uint32(len(n.content)) {
-			n.content = nil
-			return
-		}
+	n.TryDeleteData(offset, count)
+}
 
-		n.content = n.content[count:]
-		return
-	}
+func (n *CharacterData) ReplaceData(offset, count uint32, data string) {
+	n.TryReplaceData(offset, count, data)
+}
+
+// The checked variants of the methods above return a DOMException when
+// offset is past the end of the data.  Like Length, offsets and counts are
+// in bytes.  A count past the end of the data stops at the end.
 
-	if offset+count > uint32(len(n.content)) {
-		n.content = n.content[0:offset]
-		return
+func (n *CharacterData) TrySubstringData(offset, count uint32) (string, error) {
+	start, end, err := n.dataRange(offset, count)
+	if err != nil {
+		return "", err
 	}
+	return string(n.content[start:end]), nil
+}
 
-	n.content = append(n.content[0:offset], n.content[offset+count:]...)
+func (n *CharacterData) TryInsertData(offset uint32, data string) error {
+	return n.TryReplaceData(offset, 0, data)
 }
 
-func (n *CharacterData) ReplaceData(offset, count uint32, data string) {
-	if offset == 0 {
-		n.content = append([]byte(data), n.content[count:]...)
-		return
+func (n *CharacterData) TryDeleteData(offset, count uint32) error {
+	return n.TryReplaceData(offset, count, "")
+}
+
+func (n *CharacterData) TryReplaceData(offset, count uint32, data string) error {
+	start, end, err := n.dataRange(offset, count)
+	if err != nil {
+		return err
 	}
+	dataChanging(&n._node, n.Data)
+	content := make([]byte, 0, len(n.content)-(end-start)+len(data))
+	content = append(content, n.content[:start]...)
+	content = append(content, data...)
+	n.content = append(content, n.content[end:]...)
+	dataReplaced(&n._node, offset, uint32(end-start), uint32(len(data)))
+	return nil
+}
 
-	tmp := append(n.content[0:offset], []byte(data)...)
-	n.content = append(tmp, n.content[offset+count:]...)
+// returns the bytes covered by offset and count
+func (n *CharacterData) dataRange(offset, count uint32) (start, end int, err error) {
+	if uint64(offset) > uint64(len(n.content)) {
+		return 0, 0, &DOMException{INDEX_SIZE_ERR, "offset past the end of the data"}
+	}
+	start, end = int(offset), len(n.content)
+	if uint64(count) < uint64(end-start) {
+		end = start + int(count)
+	}
+	return start, end, nil
 }
 
 func (n *CharacterData) String() string {
@@ -0,0 +1,316 @@
+package dom
+
+/*
+ * Character encodings other than UTF-8
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A Charset converts between a character encoding and UTF-8.
+type Charset interface {
+	// Returns a reader that converts input in the charset to UTF-8.
+	NewReader(input io.Reader) io.Reader
+	// Appends the encoding of r to b.  Returns false if r cannot be
+	// represented in the charset.
+	AppendRune(b []byte, r rune) ([]byte, bool)
+}
+
+var charsets = struct {
+	sync.RWMutex
+	m map[string]Charset
+}{m: map[string]Charset{}}
+
+// Makes a charset known to the parser and the Encoder under name, which is
+// not case-sensitive.  A charset registered under the name of a built-in
+// charset replaces it.
+func RegisterCharset(name string, c Charset) {
+	charsets.Lock()
+	defer charsets.Unlock()
+	charsets.m[strings.ToUpper(name)] = c
+}
+
+// Returns the charset registered under name, or nil.
+func LookupCharset(name string) Charset {
+	charsets.RLock()
+	defer charsets.RUnlock()
+	return charsets.m[strings.ToUpper(name)]
+}
+
+func init() {
+	RegisterCharset("UTF-8", _utf8Charset{})
+	RegisterCharset("UTF8", _utf8Charset{})
+	ascii := newSingleByteCharset(func(b byte) rune { return utf8.RuneError })
+	RegisterCharset("US-ASCII", ascii)
+	RegisterCharset("ASCII", ascii)
+	latin1 := newSingleByteCharset(func(b byte) rune { return rune(b) })
+	for _, name := range []string{"ISO-8859-1", "ISO_8859-1", "LATIN1", "L1"} {
+		RegisterCharset(name, latin1)
+	}
+	latin9 := newSingleByteCharset(func(b byte) rune {
+		if r, ok := latin9Runes[b]; ok {
+			return r
+		}
+		return rune(b)
+	})
+	for _, name := range []string{"ISO-8859-15", "ISO_8859-15", "LATIN9", "LATIN-9"} {
+		RegisterCharset(name, latin9)
+	}
+	cp1252 := newSingleByteCharset(func(b byte) rune {
+		if b >= 0x80 && b < 0xA0 && windows1252Runes[b-0x80] != 0 {
+			return windows1252Runes[b-0x80]
+		}
+		return rune(b)
+	})
+	RegisterCharset("WINDOWS-1252", cp1252)
+	RegisterCharset("CP1252", cp1252)
+	RegisterCharset("UTF-16", &_utf16Charset{bigEndian: true, bom: true})
+	RegisterCharset("UTF-16BE", &_utf16Charset{bigEndian: true})
+	RegisterCharset("UTF-16LE", &_utf16Charset{bigEndian: false})
+}
+
+// the characters of ISO-8859-15 that differ from ISO-8859-1
+var latin9Runes = map[byte]rune{
+	0xA4: 0x20AC, 0xA6: 0x0160, 0xA8: 0x0161, 0xB4: 0x017D,
+	0xB8: 0x017E, 0xBC: 0x0152, 0xBD: 0x0153, 0xBE: 0x0178,
+}
+
+// the characters of windows-1252 from 0x80 to 0x9F, where the bytes left
+// undefined are zero and map to the C1 controls
+var windows1252Runes = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+// ====================================
+
+type _utf8Charset struct{}
+
+func (_utf8Charset) NewReader(input io.Reader) io.Reader { return input }
+func (_utf8Charset) AppendRune(b []byte, r rune) ([]byte, bool) {
+	return utf8.AppendRune(b, r), true
+}
+
+// ====================================
+
+// A charset where bytes below 0x80 are ASCII, and each byte above maps to
+// a single character.
+type _singleByteCharset struct {
+	high   [128]rune
+	encode map[rune]byte
+}
+
+func newSingleByteCharset(high func(b byte) rune) *_singleByteCharset {
+	cs := &_singleByteCharset{encode: map[rune]byte{}}
+	for i := range cs.high {
+		b := byte(0x80 + i)
+		cs.high[i] = high(b)
+		if cs.high[i] != utf8.RuneError {
+			cs.encode[cs.high[i]] = b
+		}
+	}
+	return cs
+}
+
+func (cs *_singleByteCharset) NewReader(input io.Reader) io.Reader {
+	return &_singleByteReader{r: input, cs: cs}
+}
+
+func (cs *_singleByteCharset) AppendRune(b []byte, r rune) ([]byte, bool) {
+	if r < 0x80 {
+		return append(b, byte(r)), true
+	}
+	if c, ok := cs.encode[r]; ok {
+		return append(b, c), true
+	}
+	return b, false
+}
+
+type _singleByteReader struct {
+	r       io.Reader
+	cs      *_singleByteCharset
+	in, out []byte
+}
+
+func (r *_singleByteReader) Read(p []byte) (int, error) {
+	if len(r.out) == 0 {
+		if cap(r.in) == 0 {
+			r.in = make([]byte, 1024)
+		}
+		n, err := r.r.Read(r.in[:cap(r.in)])
+		if n == 0 {
+			return 0, err
+		}
+		for _, b := range r.in[:n] {
+			if b < 0x80 {
+				r.out = append(r.out, b)
+			} else {
+				r.out = utf8.AppendRune(r.out, r.cs.high[b-0x80])
+			}
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[:copy(r.out, r.out[n:])]
+	return n, nil
+}
+
+// ====================================
+
+type _utf16Charset struct {
+	bigEndian bool
+	bom       bool // a byte order mark is read and written
+}
+
+func (cs *_utf16Charset) NewReader(input io.Reader) io.Reader {
+	return &_utf16Reader{r: input, bigEndian: cs.bigEndian, bom: cs.bom}
+}
+
+func (cs *_utf16Charset) AppendRune(b []byte, r rune) ([]byte, bool) {
+	put := func(u uint16) {
+		if cs.bigEndian {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		put(uint16(r1))
+		put(uint16(r2))
+	} else {
+		put(uint16(r))
+	}
+	return b, true
+}
+
+type _utf16Reader struct {
+	r         io.Reader
+	bigEndian bool
+	bom       bool // look for a byte order mark
+	in        []byte
+	high      rune // a high surrogate waiting for the low half
+	out       []byte
+	err       error
+}
+
+func (r *_utf16Reader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			if len(r.in) > 0 || r.high != 0 {
+				// an odd byte, or half of a surrogate pair, at the end
+				r.in, r.high = nil, 0
+				r.out = utf8.AppendRune(r.out, utf8.RuneError)
+				break
+			}
+			return 0, r.err
+		}
+		var buf [1024]byte
+		n, err := r.r.Read(buf[:])
+		r.in, r.err = append(r.in, buf[:n]...), err
+		r.decode()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[:copy(r.out, r.out[n:])]
+	return n, nil
+}
+
+func (r *_utf16Reader) decode() {
+	if r.bom && len(r.in) >= 2 {
+		switch {
+		case r.in[0] == 0xFE && r.in[1] == 0xFF:
+			r.bigEndian, r.in = true, r.in[2:]
+		case r.in[0] == 0xFF && r.in[1] == 0xFE:
+			r.bigEndian, r.in = false, r.in[2:]
+		}
+		r.bom = false
+	}
+	for ; len(r.in) >= 2; r.in = r.in[2:] {
+		u := rune(r.in[0])<<8 | rune(r.in[1])
+		if !r.bigEndian {
+			u = rune(r.in[1])<<8 | rune(r.in[0])
+		}
+		if r.high != 0 {
+			high := r.high
+			r.high = 0
+			if u >= 0xDC00 && u < 0xE000 {
+				r.out = utf8.AppendRune(r.out, utf16.DecodeRune(high, u))
+				continue
+			}
+			r.out = utf8.AppendRune(r.out, utf8.RuneError)
+		}
+		if u >= 0xD800 && u < 0xDC00 {
+			r.high = u
+			continue
+		}
+		// a low surrogate on its own is written as U+FFFD
+		r.out = utf8.AppendRune(r.out, u)
+	}
+}
+
+// ====================================
+
+// Detects the encoding of the input from its first bytes and the XML
+// declaration, and returns a reader of the input converted to UTF-8.
+// http://www.w3.org/TR/REC-xml/#sec-guessing
+func newUTF8Reader(r io.Reader, charsetReader func(string, io.Reader) (io.Reader, error)) (*bufio.Reader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		br.Discard(3)
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}), bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return bufio.NewReader(&_utf16Reader{r: br, bom: true}), nil
+	case bytes.Equal(head, []byte{0, '<', 0, '?'}):
+		return bufio.NewReader(&_utf16Reader{r: br, bigEndian: true}), nil
+	case bytes.Equal(head, []byte{'<', 0, '?', 0}):
+		return bufio.NewReader(&_utf16Reader{r: br}), nil
+	}
+
+	// look for the encoding in the XML declaration
+	if head, _ = br.Peek(5); string(head) != "<?xml" {
+		return br, nil
+	}
+	var decl []byte
+	for n := 64; n <= 1024 && decl == nil; n *= 2 {
+		head, err := br.Peek(n)
+		if i := bytes.Index(head, []byte("?>")); i >= 0 {
+			decl = head[5:i]
+		} else if err != nil {
+			break
+		}
+	}
+	charset, _ := procInstParam(string(decl), "encoding")
+	switch strings.ToUpper(charset) {
+	case "", "UTF-8", "UTF8":
+		return br, nil
+	}
+	if charsetReader != nil {
+		cr, err := charsetReader(charset, br)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(cr), nil
+	}
+	cs := LookupCharset(charset)
+	if cs == nil {
+		return nil, &SyntaxError{Msg: "Unsupported encoding " + charset + ".", Pos: Position{1, 1, 0}}
+	}
+	if _, ok := cs.(*_utf16Charset); ok {
+		// UTF-16 is known from the first bytes, so the declaration is wrong
+		return nil, &SyntaxError{Msg: "Document declared as " + charset + " is not in UTF-16.", Pos: Position{1, 1, 0}}
+	}
+	return bufio.NewReader(cs.NewReader(br)), nil
+}
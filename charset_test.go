@@ -0,0 +1,199 @@
+package dom
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16Bytes(s string, bigEndian, bom bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	b := []byte{}
+	for _, u := range units {
+		if bigEndian {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return b
+}
+
+func TestParseCharsets(t *testing.T) {
+	const text = "café € \U0001D11E"
+	test_cases := []struct {
+		in   []byte
+		text string
+	}{
+		{[]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a>caf\xe9 \xa4<![CDATA[\xe9]]></a>"), "café ¤é"},
+		{[]byte("<?xml version='1.0' encoding='latin1'?><a>\xff</a>"), "ÿ"},
+		{[]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-15\"?><a>\xa4\xbd</a>"), "€œ"},
+		{[]byte("<?xml version=\"1.0\" encoding=\"windows-1252\"?><a>\x80\x93\x81\xe9</a>"), "€“\u0081é"},
+		{[]byte("<?xml version=\"1.0\" encoding=\"US-ASCII\"?><a>ok</a>"), "ok"},
+		{[]byte("\xef\xbb\xbf<a>" + text + "</a>"), text},
+		{utf16Bytes("<?xml version=\"1.0\" encoding=\"UTF-16\"?><a>"+text+"</a>", true, true), text},
+		{utf16Bytes("<?xml version=\"1.0\" encoding=\"UTF-16\"?><a>"+text+"</a>", false, true), text},
+		{utf16Bytes("<?xml version=\"1.0\" encoding=\"UTF-16BE\"?><a>"+text+"</a>", true, false), text},
+		{utf16Bytes("<?xml version=\"1.0\" encoding=\"UTF-16LE\"?>\n<a>"+text+"</a>", false, false), text},
+		{utf16Bytes("<a>"+text+"</a>", false, true), text},
+	}
+	for i, v := range test_cases {
+		d, err := ParseXml(bytes.NewReader(v.in))
+		if err != nil {
+			t.Errorf("Test case %d: error parsing (%v).", i, err)
+			continue
+		}
+		if got := string(d.DocumentElement().ToText(false)); got != v.text {
+			t.Errorf("Test case %d: text is %q", i, got)
+		}
+	}
+
+	d, err := ParseXml(bytes.NewReader([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<a>\xe9<![CDATA[x]]></a>")))
+	if err != nil {
+		t.Fatalf("Error parsing (%v).", err)
+	}
+	if d.XmlEncoding() != "ISO-8859-1" {
+		t.Errorf("Encoding from the declaration is %q", d.XmlEncoding())
+	}
+	if c := d.DocumentElement().LastChild(); c.NodeType() != CDATA_SECTION_NODE || c.Position().String() != "2:5" {
+		t.Errorf("CDATA section not found after conversion: %s at %v", c.NodeName(), c.Position())
+	}
+
+	for _, in := range []string{
+		`<?xml version="1.0" encoding="EBCDIC"?><a/>`,
+		`<?xml version="1.0" encoding="UTF-16"?><a/>`,
+	} {
+		if _, err := ParseStringXml(in); err == nil {
+			t.Errorf("Parsing %q succeeded", in)
+		}
+	}
+}
+
+// a charset for testing, which writes lower case letters in upper case
+type upperCharset struct{}
+
+func (upperCharset) NewReader(input io.Reader) io.Reader {
+	b, _ := io.ReadAll(input)
+	return strings.NewReader(strings.ToLower(string(b)))
+}
+
+func (upperCharset) AppendRune(b []byte, r rune) ([]byte, bool) {
+	if r > 0x7F {
+		return b, false
+	}
+	return append(b, strings.ToUpper(string(r))...), true
+}
+
+func TestRegisterCharset(t *testing.T) {
+	RegisterCharset("x-Test-Upper", upperCharset{})
+	if LookupCharset("X-TEST-UPPER") == nil {
+		t.Fatalf("Charset not registered")
+	}
+	d, err := ParseStringXml(`<?xml version="1.0" encoding="X-TEST-UPPER"?><A B="C">TEXT</A>`)
+	if err != nil {
+		t.Fatalf("Error parsing (%v).", err)
+	}
+	if d.DocumentElement().NodeName() != "a" || d.DocumentElement().GetAttribute("b") != "c" {
+		t.Errorf("Registered charset not used for reading")
+	}
+
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	enc.Encoding = "x-test-upper"
+	d.DocumentElement().AppendChild(d.CreateTextNode("é"))
+	if err := enc.Encode(d.DocumentElement()); err != nil || b.String() != `<A B="C">TEXT&#233;</A>` {
+		t.Errorf("Registered charset not used for writing: %s (%v)", b.String(), err)
+	}
+}
+
+func TestEncoderCharsets(t *testing.T) {
+	d, _ := ParseStringXml("<a t=\"€œ\">€ é 中<![CDATA[中é]]><!--é--></a>")
+	test_cases := []struct {
+		encoding string
+		out      string
+	}{
+		{"windows-1252", "<a t=\"\x80\x9c\">\x80 \xe9 &#20013;<![CDATA[]]>&#20013;<![CDATA[\xe9]]><!--\xe9--></a>"},
+		{"ISO-8859-15", "<a t=\"\xa4\xbd\">\xa4 \xe9 &#20013;<![CDATA[]]>&#20013;<![CDATA[\xe9]]><!--\xe9--></a>"},
+		{"latin1", "<a t=\"&#8364;&#339;\">&#8364; \xe9 &#20013;<![CDATA[]]>&#20013;<![CDATA[\xe9]]><!--\xe9--></a>"},
+	}
+	for _, v := range test_cases {
+		var b bytes.Buffer
+		enc := NewEncoder(&b)
+		enc.Encoding = v.encoding
+		if err := enc.Encode(d.DocumentElement()); err != nil || b.String() != v.out {
+			t.Errorf("Encoding in %s: %q (%v)", v.encoding, b.String(), err)
+		}
+	}
+
+	// markup that cannot be encoded is an error
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	enc.Encoding = "windows-1252"
+	if err := enc.Encode(d.CreateComment("中")); err == nil {
+		t.Errorf("Unencodable comment written")
+	}
+}
+
+func TestEncoderUTF16RoundTrip(t *testing.T) {
+	const in = "<a x=\"\U0001D11E\">café 中</a>"
+	d, _ := ParseStringXml(in)
+	for _, encoding := range []string{"UTF-16", "UTF-16LE", "UTF-16BE"} {
+		var b bytes.Buffer
+		enc := NewEncoder(&b)
+		enc.Encoding = encoding
+		enc.XmlDeclaration = true
+		if err := enc.Encode(d); err != nil {
+			t.Errorf("%s: error encoding (%v).", encoding, err)
+			continue
+		}
+		if bom := b.Bytes()[:2]; (encoding == "UTF-16") != (bom[0] == 0xFE && bom[1] == 0xFF) {
+			t.Errorf("%s: byte order mark is % x", encoding, bom)
+		}
+		d2, err := ParseXml(&b)
+		if err != nil {
+			t.Errorf("%s: error parsing (%v).", encoding, err)
+			continue
+		}
+		if out := string(d2.DocumentElement().ToXml()); out != string(d.DocumentElement().ToXml()) {
+			t.Errorf("%s: round trip gives %s", encoding, out)
+		}
+		if d2.XmlEncoding() != encoding {
+			t.Errorf("%s: declared encoding is %s", encoding, d2.XmlEncoding())
+		}
+	}
+}
+
+func TestToXmlDeclaredEncoding(t *testing.T) {
+	test_cases := []struct {
+		in       []byte
+		expected string
+	}{
+		{utf16Bytes(`<?xml version="1.0" encoding="UTF-16"?><a>hé</a>`, true, true),
+			`<?xml version="1.0" encoding="UTF-8"?><a>h&#233;</a>`},
+		{[]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a>h\xe9</a>"),
+			`<?xml version="1.0" encoding="ISO-8859-1"?><a>h&#233;</a>`},
+	}
+	for i, v := range test_cases {
+		d, err := ParseXml(bytes.NewReader(v.in))
+		if err != nil {
+			t.Fatalf("Test case %d: error parsing (%v).", i, err)
+		}
+		out := string(d.ToXml())
+		if out != v.expected {
+			t.Errorf("Test case %d: ToXml gives %s", i, out)
+		}
+		d2, err := ParseStringXml(out)
+		if err != nil {
+			t.Errorf("Test case %d: error parsing the output (%v).", i, err)
+			continue
+		}
+		if s := string(d2.DocumentElement().ToText(false)); s != "hé" {
+			t.Errorf("Test case %d: round trip gives %q", i, s)
+		}
+	}
+}
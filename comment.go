@@ -10,6 +10,7 @@ package dom
 
 import (
 	"encoding/xml"
+	"io"
 )
 
 type Comment struct {
@@ -19,9 +20,11 @@ type Comment struct {
 func (n *Comment) NodeType() uint           { return COMMENT_NODE }
 func (n *Comment) NodeName() (s string)     { return "#comment" }
 func (n *Comment) NodeValue() (s string)    { return string(n.content) }
-func (n *Comment) PreviousSibling() Node    { return previousSibling(Node(n), n.p.ChildNodes()) }
-func (n *Comment) NextSibling() Node        { return nextSibling(Node(n), n.p.ChildNodes()) }
 func (n *Comment) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *Comment) CloneNode(deep bool) Node { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *Comment) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
 
 func newComment(token xml.Comment) *Comment {
 	n := new(Comment)
@@ -24,3 +24,10 @@ const (
 	DOCUMENT_FRAGMENT_NODE
 	NOTATION_NODE
 )
+
+// Namespace URIs that are permanently bound to the xml and xmlns prefixes.
+// See http://www.w3.org/TR/xml-names/#ns-decl
+const (
+	XML_NAMESPACE   = "http://www.w3.org/XML/1998/namespace"
+	XMLNS_NAMESPACE = "http://www.w3.org/2000/xmlns/"
+)
@@ -11,6 +11,11 @@ package dom
  * Copyright (c) 2010, Jeff Schiller
  */
 
+import (
+	"io"
+	"iter"
+)
+
 // TODO: split this out into separate interfaces again eventually
 
 type (
@@ -20,10 +25,23 @@ type (
 		RemoveChild(Node) Node
 		InsertBefore(Node, Node) Node
 		ReplaceChild(Node, Node) Node
+		// checked variants, which return a DOMException when the change is
+		// not allowed
+		TryAppendChild(Node) (Node, error)
+		TryRemoveChild(Node) (Node, error)
+		TryInsertBefore(Node, Node) (Node, error)
+		TryReplaceChild(Node, Node) (Node, error)
+		CloneNode(deep bool) Node
+		Normalize()
+		WriteTo(w io.Writer) (int64, error)
 		// attributes
 		NodeName() string
 		NodeValue() string
 		NodeType() uint
+		// the text of the node and its descendants, without comments and
+		// processing instructions
+		TextContent() string
+		SetTextContent(string)
 		ParentNode() Node
 		ChildNodes() NodeList
 		Attributes() NamedNodeMap
@@ -32,10 +50,24 @@ type (
 		LastChild() Node
 		PreviousSibling() Node
 		NextSibling() Node
+		// DOM Level 2 namespace attributes
+		NamespaceURI() string
+		Prefix() string
+		LocalName() string
+		// where the parser found the node
+		Position() Position
+		// iterators for range loops
+		Children() iter.Seq[Node]
+		Descendants() iter.Seq[Node]
+		Ancestors() iter.Seq[Node]
+		FollowingSiblings() iter.Seq[Node]
+		PrecedingSiblings() iter.Seq[Node]
+		Elements(name string) iter.Seq[*Element]
 
 		// internal interface methods needed for implementations (not part of the DOM)
+		node() *_node
 		setParent(Node)
-		insertChildAt(Node, uint)
+		insertChildBefore(Node, Node)
 		removeChild(Node)
 	}
 
@@ -43,6 +75,10 @@ type (
 	Attr interface {
 		Node
 		OwnerDocument() *Document
+		Name() string
+		Value() string
+		SetValue(string)
+		OwnerElement() *Element
 	}
 
 	// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-536297177
@@ -55,5 +91,18 @@ type (
 	NamedNodeMap interface {
 		Length() uint
 		Item(index uint) Node
+		GetNamedItem(name string) Node
+		GetNamedItemNS(namespaceURI, localName string) Node
+		// return the node replaced or removed, or nil
+		SetNamedItem(Node) Node
+		SetNamedItemNS(Node) Node
+		RemoveNamedItem(name string) Node
+		RemoveNamedItemNS(namespaceURI, localName string) Node
+		// checked variants, which return a DOMException when the change is
+		// not allowed
+		TrySetNamedItem(Node) (Node, error)
+		TrySetNamedItemNS(Node) (Node, error)
+		TryRemoveNamedItem(name string) (Node, error)
+		TryRemoveNamedItemNS(namespaceURI, localName string) (Node, error)
 	}
 )
@@ -0,0 +1,440 @@
+package dom
+
+/*
+ * DocumentType implementation
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The <!DOCTYPE> declaration of a document.  Entities and notations
+// declared in the internal subset are available through Entities and
+// Notations, but element and attribute list declarations are only kept as
+// part of the text of the internal subset.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-412266927
+type DocumentType struct {
+	_node
+	publicId       string
+	systemId       string
+	internalSubset string
+	entities       []Node
+	notations      []Node
+}
+
+func (n *DocumentType) NodeType() uint           { return DOCUMENT_TYPE_NODE }
+func (n *DocumentType) NodeName() string         { return n.n.Local }
+func (n *DocumentType) NodeValue() string        { return "" }
+func (n *DocumentType) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *DocumentType) CloneNode(deep bool) Node { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *DocumentType) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+
+// The name of the root element, as given in the declaration.
+func (n *DocumentType) Name() string { return n.n.Local }
+
+func (n *DocumentType) PublicId() string { return n.publicId }
+func (n *DocumentType) SystemId() string { return n.systemId }
+
+// The text between the square brackets of the declaration, or the empty
+// string if there is no internal subset.
+func (n *DocumentType) InternalSubset() string { return n.internalSubset }
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-1788794630
+func (n *DocumentType) Entities() NamedNodeMap {
+	return &_nodenamednodemap{n.entities}
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-D46829EF
+func (n *DocumentType) Notations() NamedNodeMap {
+	return &_nodenamednodemap{n.notations}
+}
+
+func newDoctype(name, publicId, systemId string) *DocumentType {
+	n := new(DocumentType)
+	n.n.Local = name
+	n.publicId = publicId
+	n.systemId = systemId
+	return n
+}
+
+// returns the text of the declaration, without the angle brackets
+func (n *DocumentType) declaration() string {
+	s := "DOCTYPE " + n.n.Local + externalId(n.publicId, n.systemId)
+	if n.internalSubset != "" {
+		s += " [" + n.internalSubset + "]"
+	}
+	return s
+}
+
+func externalId(publicId, systemId string) string {
+	switch {
+	case publicId != "":
+		return " PUBLIC " + quoteLiteral(publicId) + " " + quoteLiteral(systemId)
+	case systemId != "":
+		return " SYSTEM " + quoteLiteral(systemId)
+	}
+	return ""
+}
+
+// quotes a system or public literal, which cannot contain escapes
+func quoteLiteral(s string) string {
+	if strings.IndexByte(s, '"') >= 0 {
+		return "'" + s + "'"
+	}
+	return "\"" + s + "\""
+}
+
+// ====================================
+// Parsing of the DOCTYPE directive
+// http://www.w3.org/TR/REC-xml/#sec-prolog-dtd
+
+type _dtdScanner struct {
+	s   string
+	pos int
+}
+
+func (sc *_dtdScanner) errorf(msg string) error {
+	return &SyntaxError{Msg: "Invalid document type declaration: " + msg + "."}
+}
+
+func (sc *_dtdScanner) eof() bool { return sc.pos >= len(sc.s) }
+
+func (sc *_dtdScanner) skipSpace() {
+	for !sc.eof() && strings.IndexByte(" \t\r\n", sc.s[sc.pos]) >= 0 {
+		sc.pos++
+	}
+}
+
+// reads a name or keyword
+func (sc *_dtdScanner) word() string {
+	sc.skipSpace()
+	start := sc.pos
+	for !sc.eof() && strings.IndexByte(" \t\r\n[]>\"'", sc.s[sc.pos]) < 0 {
+		sc.pos++
+	}
+	return sc.s[start:sc.pos]
+}
+
+// reads a quoted literal
+func (sc *_dtdScanner) literal() (string, bool) {
+	sc.skipSpace()
+	if sc.eof() || (sc.s[sc.pos] != '"' && sc.s[sc.pos] != '\'') {
+		return "", false
+	}
+	end := strings.IndexByte(sc.s[sc.pos+1:], sc.s[sc.pos])
+	if end < 0 {
+		return "", false
+	}
+	lit := sc.s[sc.pos+1 : sc.pos+1+end]
+	sc.pos += end + 2
+	return lit, true
+}
+
+// reads an optional SYSTEM or PUBLIC identifier.  The system literal is
+// optional after PUBLIC when reading a notation.
+func (sc *_dtdScanner) externalId(notation bool) (publicId, systemId string, err error) {
+	start := sc.pos
+	switch sc.word() {
+	case "SYSTEM":
+		if systemId, ok := sc.literal(); ok {
+			return "", systemId, nil
+		}
+		return "", "", sc.errorf("expected a system literal")
+	case "PUBLIC":
+		publicId, ok := sc.literal()
+		if !ok {
+			return "", "", sc.errorf("expected a public literal")
+		}
+		if systemId, ok = sc.literal(); !ok && !notation {
+			return "", "", sc.errorf("expected a system literal")
+		}
+		return publicId, systemId, nil
+	}
+	sc.pos = start
+	return "", "", nil
+}
+
+// Parses the text of a directive.  Directives other than DOCTYPE are
+// ignored and return nil.
+func parseDoctype(dir string) (*DocumentType, error) {
+	sc := &_dtdScanner{s: dir}
+	if sc.word() != "DOCTYPE" {
+		return nil, nil
+	}
+	name := sc.word()
+	if name == "" {
+		return nil, sc.errorf("missing name")
+	}
+	publicId, systemId, err := sc.externalId(false)
+	if err != nil {
+		return nil, err
+	}
+	n := newDoctype(name, publicId, systemId)
+
+	sc.skipSpace()
+	if !sc.eof() && sc.s[sc.pos] == '[' {
+		end := strings.LastIndexByte(sc.s, ']')
+		if end < sc.pos || strings.TrimSpace(sc.s[end+1:]) != "" {
+			return nil, sc.errorf("unterminated internal subset")
+		}
+		n.internalSubset = sc.s[sc.pos+1 : end]
+		if err := n.parseInternalSubset(); err != nil {
+			return nil, err
+		}
+		sc.pos = len(sc.s)
+	}
+	if !sc.eof() {
+		return nil, sc.errorf("unexpected '" + sc.s[sc.pos:] + "'")
+	}
+	return n, nil
+}
+
+// reads the entity and notation declarations from the internal subset
+func (n *DocumentType) parseInternalSubset() error {
+	sc := &_dtdScanner{s: n.internalSubset}
+	for sc.skipSpace(); !sc.eof(); sc.skipSpace() {
+		rest := sc.s[sc.pos:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest, "-->")
+			if end < 0 {
+				return sc.errorf("unterminated comment")
+			}
+			sc.pos += end + 3
+		case strings.HasPrefix(rest, "<?"):
+			end := strings.Index(rest, "?>")
+			if end < 0 {
+				return sc.errorf("unterminated processing instruction")
+			}
+			sc.pos += end + 2
+		case rest[0] == '%':
+			// parameter entity references are not expanded
+			end := strings.IndexByte(rest, ';')
+			if end < 0 {
+				return sc.errorf("unterminated parameter entity reference")
+			}
+			sc.pos += end + 1
+		case strings.HasPrefix(rest, "<!"):
+			sc.pos += 2
+			var err error
+			switch sc.word() {
+			case "ENTITY":
+				err = n.parseEntityDecl(sc)
+			case "NOTATION":
+				err = n.parseNotationDecl(sc)
+			}
+			if err != nil {
+				return err
+			}
+			if err = sc.skipDecl(); err != nil {
+				return err
+			}
+		default:
+			return sc.errorf("unexpected '" + rest + "'")
+		}
+	}
+	return nil
+}
+
+// skips to the end of the current markup declaration
+func (sc *_dtdScanner) skipDecl() error {
+	for !sc.eof() {
+		switch c := sc.s[sc.pos]; c {
+		case '>':
+			sc.pos++
+			return nil
+		case '"', '\'':
+			if _, ok := sc.literal(); !ok {
+				return sc.errorf("unterminated literal")
+			}
+		default:
+			sc.pos++
+		}
+	}
+	return sc.errorf("unterminated markup declaration")
+}
+
+// http://www.w3.org/TR/REC-xml/#sec-entity-decl
+func (n *DocumentType) parseEntityDecl(sc *_dtdScanner) error {
+	name := sc.word()
+	if name == "%" {
+		// parameter entities are only used within the DTD
+		return nil
+	}
+	if name == "" {
+		return sc.errorf("missing entity name")
+	}
+	ent := new(Entity)
+	ent.n.Local = name
+	if value, ok := sc.literal(); ok {
+		// the replacement text is filled in once all entities are known
+		t := newText(xml.CharData(value))
+		ent.insertChildBefore(t, nil)
+		t.setParent(ent)
+	} else {
+		var err error
+		if ent.publicId, ent.systemId, err = sc.externalId(false); err != nil {
+			return err
+		}
+		if ent.systemId == "" {
+			return sc.errorf("expected a value for entity " + name)
+		}
+		start := sc.pos
+		if sc.word() == "NDATA" {
+			ent.notationName = sc.word()
+		} else {
+			sc.pos = start
+		}
+	}
+	// the first declaration of an entity is binding
+	for _, e := range n.entities {
+		if e.NodeName() == name {
+			return nil
+		}
+	}
+	ent.p = n
+	n.entities = append(n.entities, ent)
+	return nil
+}
+
+// http://www.w3.org/TR/REC-xml/#Notations
+func (n *DocumentType) parseNotationDecl(sc *_dtdScanner) error {
+	name := sc.word()
+	if name == "" {
+		return sc.errorf("missing notation name")
+	}
+	not := new(Notation)
+	not.n.Local = name
+	var err error
+	if not.publicId, not.systemId, err = sc.externalId(true); err != nil {
+		return err
+	}
+	not.p = n
+	n.notations = append(n.notations, not)
+	return nil
+}
+
+// Expands the references in the values of the internal entities, and
+// returns the replacement text of each.  References to entities that are
+// not declared are looked up in external, and otherwise left as they are.
+// The xml.Decoder inserts entities as plain text, so markup in their
+// values is not parsed.  The replacement text of an entity may be at most
+// max bytes long, unless max is zero.
+func (n *DocumentType) expandEntities(external map[string]string, max int) (map[string]string, error) {
+	values := map[string]string{}
+	for _, e := range n.entities {
+		if c := e.FirstChild(); c != nil {
+			values[e.NodeName()] = c.NodeValue()
+		}
+	}
+	expanded := map[string]string{}
+	inProgress := map[string]bool{}
+
+	var expand func(name string) (string, error)
+	expand = func(name string) (string, error) {
+		if v, ok := expanded[name]; ok {
+			return v, nil
+		}
+		if inProgress[name] {
+			return "", &SyntaxError{Msg: "Recursive reference to entity " + name + "."}
+		}
+		inProgress[name] = true
+		size := 0
+		v, err := expandReferences(values[name], func(ref string) (string, bool, error) {
+			if _, ok := values[ref]; ok {
+				v, err := expand(ref)
+				// stop before building a huge value from many references
+				if size += len(v); err == nil && max > 0 && size > max {
+					err = &LimitError{Limit: "MaxEntityExpansion", Max: max}
+				}
+				return v, true, err
+			}
+			v, ok := external[ref]
+			return v, ok, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if max > 0 && len(v) > max {
+			return "", &LimitError{Limit: "MaxEntityExpansion", Max: max}
+		}
+		delete(inProgress, name)
+		expanded[name] = v
+		return v, nil
+	}
+
+	for _, e := range n.entities {
+		if c := e.FirstChild(); c != nil {
+			v, err := expand(e.NodeName())
+			if err != nil {
+				return nil, err
+			}
+			c.(*Text).content = []byte(v)
+		}
+	}
+	return expanded, nil
+}
+
+var predefinedEntities = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"apos": "'",
+	"quot": "\"",
+}
+
+// replaces the character and entity references in s.  lookup returns the
+// replacement for a named entity, and whether it is known.
+func expandReferences(s string, lookup func(string) (string, bool, error)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '&')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(s[i:], ';')
+		if end < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		ref := s[i+1 : i+end]
+		s = s[i+end+1:]
+
+		if strings.HasPrefix(ref, "#") {
+			var v uint64
+			var err error
+			if strings.HasPrefix(ref, "#x") {
+				v, err = strconv.ParseUint(ref[2:], 16, 32)
+			} else {
+				v, err = strconv.ParseUint(ref[1:], 10, 32)
+			}
+			if err != nil {
+				return "", &SyntaxError{Msg: "Invalid character reference &" + ref + ";."}
+			}
+			b.WriteRune(rune(v))
+			continue
+		}
+		if v, ok := predefinedEntities[ref]; ok {
+			b.WriteString(v)
+			continue
+		}
+		v, ok, err := lookup(ref)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString("&" + ref + ";")
+		}
+	}
+}
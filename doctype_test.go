@@ -0,0 +1,105 @@
+package dom
+
+import (
+	"testing"
+)
+
+const doctypeDoc = `<!DOCTYPE note PUBLIC "-//Example//DTD Note//EN" "note.dtd" [
+<!ELEMENT note (#PCDATA)>
+<!-- a comment with a ] bracket -->
+<!ENTITY writer "Donald &amp; &who;">
+<!ENTITY who 'Duck'>
+<!ENTITY copy "&#169; &writer;">
+<!ENTITY % param "ignored">
+<!ENTITY logo SYSTEM "logo.gif" NDATA gif>
+<!NOTATION gif PUBLIC "image/gif">
+]><note>&copy;</note>`
+
+func TestParseDoctype(t *testing.T) {
+	d, err := ParseStringXml(doctypeDoc)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	dt := d.Doctype()
+	if dt == nil {
+		t.Fatalf("Document type not parsed")
+	}
+	if dt.Name() != "note" || dt.NodeName() != "note" || dt.NodeType() != DOCUMENT_TYPE_NODE {
+		t.Errorf("Document type name not parsed")
+	}
+	if dt.PublicId() != "-//Example//DTD Note//EN" || dt.SystemId() != "note.dtd" {
+		t.Errorf("External identifier not parsed")
+	}
+	if dt.Entities().Length() != 4 || dt.Notations().Length() != 1 {
+		t.Fatalf("Found %d entities and %d notations", dt.Entities().Length(), dt.Notations().Length())
+	}
+	writer := dt.Entities().Item(0).(*Entity)
+	if writer.NodeName() != "writer" || writer.FirstChild().NodeValue() != "Donald & Duck" {
+		t.Errorf("Replacement text of an entity not expanded")
+	}
+	logo := dt.Entities().Item(3).(*Entity)
+	if logo.SystemId() != "logo.gif" || logo.NotationName() != "gif" || logo.HasChildNodes() {
+		t.Errorf("Unparsed entity not parsed")
+	}
+	gif := dt.Notations().Item(0).(*Notation)
+	if gif.NodeName() != "gif" || gif.PublicId() != "image/gif" || gif.SystemId() != "" {
+		t.Errorf("Notation not parsed")
+	}
+	if string(d.ToText(false)) != "© Donald & Duck" {
+		t.Errorf("Entity from the internal subset not replaced (got %s)", d.ToText(false))
+	}
+	if d.DocumentElement().NodeName() != "note" || d.FirstChild() != Node(dt) {
+		t.Errorf("Document type not a child of the document")
+	}
+}
+
+func TestDoctypeToXml(t *testing.T) {
+	test_cases := []struct{ in, out string }{
+		{`<!DOCTYPE html><html></html>`, `<!DOCTYPE html><html></html>`},
+		{`<!DOCTYPE r SYSTEM 'r.dtd'><r></r>`, `<!DOCTYPE r SYSTEM "r.dtd"><r></r>`},
+		{`<!DOCTYPE r [<!ENTITY e "x">]><r>&e;</r>`, `<!DOCTYPE r [<!ENTITY e "x">]><r>x</r>`},
+	}
+	for _, tc := range test_cases {
+		d, err := ParseStringXml(tc.in)
+		if err != nil {
+			t.Errorf("Error parsing %s (%v).", tc.in, err)
+			continue
+		}
+		if string(d.ToXml()) != tc.out {
+			t.Errorf("%s serialized as %s", tc.in, d.ToXml())
+		}
+		c := d.CloneNode(true).(*Document)
+		if string(c.ToXml()) != tc.out || c.Doctype() == d.Doctype() {
+			t.Errorf("%s not cloned", tc.in)
+		}
+	}
+}
+
+func TestDoctypeErrors(t *testing.T) {
+	bad := []string{
+		`<!DOCTYPE r [<!ENTITY a "&b;"><!ENTITY b "&a;">]><r>&a;</r>`,
+		`<!DOCTYPE><r/>`,
+		`<!DOCTYPE r PUBLIC "x"><r/>`,
+		`<!DOCTYPE r [<!ENTITY a "x">] junk><r/>`,
+		`<r/><!DOCTYPE r>`,
+		`<!DOCTYPE r><!DOCTYPE r><r/>`,
+	}
+	for _, s := range bad {
+		if _, err := ParseStringXml(s); err == nil {
+			t.Errorf("Parsed invalid document type in %s", s)
+		}
+	}
+	// lenient parsing drops bad declarations
+	d, err := ParseStringHtml(`<!DOCTYPE><html></html>`)
+	if err != nil || d.Doctype() != nil {
+		t.Errorf("Bad document type not dropped when parsing HTML")
+	}
+}
+
+func TestDoctypeXPath(t *testing.T) {
+	d, _ := ParseStringXml(`<!DOCTYPE r><r/>`)
+	r, _ := MustCompileXPath("count(/node())").Evaluate(d)
+	if r.Number() != 1 {
+		t.Errorf("Document type included in the XPath data model")
+	}
+}
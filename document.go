@@ -10,20 +10,205 @@ package dom
 
 import (
 	"encoding/xml"
+	"io"
+	"strings"
 )
 
 // DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#i-Document
 type Document struct {
 	_node
+	// from the XML declaration, which is only written if a version is set
+	xmlVersion    string
+	xmlEncoding   string
+	xmlStandalone string
+	iterators     []*NodeIterator // updated when nodes are removed
+	ranges        []*Range        // updated when nodes or data change
+	observations  []*_observation // report the changes to observers
 }
 
-func (d *Document) NodeType() uint            { return DOCUMENT_NODE }
-func (d *Document) NodeName() string          { return "#document" }
-func (d *Document) NodeValue() string         { return "" }
-func (d *Document) AppendChild(c Node) Node   { return appendChild(d, c) }
-func (d *Document) RemoveChild(c Node) Node   { return removeChild(d, c) }
-func (d *Document) DocumentElement() *Element { return d.ChildNodes().Item(0).(*Element) }
-func (d *Document) OwnerDocument() *Document  { return d }
+func (d *Document) NodeType() uint                            { return DOCUMENT_NODE }
+func (d *Document) NodeName() string                          { return "#document" }
+func (d *Document) NodeValue() string                         { return "" }
+func (d *Document) AppendChild(c Node) Node                   { return appendChild(d, c) }
+func (d *Document) RemoveChild(c Node) Node                   { return removeChild(d, c) }
+func (d *Document) InsertBefore(c, ref Node) Node             { return insertBefore(d, c, ref) }
+func (d *Document) ReplaceChild(c, old Node) Node             { return replaceChild(d, c, old) }
+func (d *Document) OwnerDocument() *Document                  { return d }
+func (d *Document) TextContent() string                       { return "" }
+func (d *Document) TryAppendChild(c Node) (Node, error)       { return tryAppendChild(d, c) }
+func (d *Document) TryRemoveChild(c Node) (Node, error)       { return tryRemoveChild(d, c) }
+func (d *Document) TryInsertBefore(c, ref Node) (Node, error) { return tryInsertBefore(d, c, ref) }
+func (d *Document) TryReplaceChild(c, old Node) (Node, error) { return tryReplaceChild(d, c, old) }
+
+// reports whether there are iterators, ranges or observers to notify of
+// changes to the tree
+func (d *Document) watched() bool {
+	return len(d.iterators)+len(d.ranges)+len(d.observations) > 0
+}
+
+// notifies the iterators, ranges and observers of d that c is about to be
+// removed
+func (d *Document) removing(c Node) {
+	for _, it := range d.iterators {
+		it.removing(c)
+	}
+	p := parentOf(c)
+	i := _childIndex{c: c}
+	for _, r := range d.ranges {
+		r.removing(c, p, &i)
+	}
+	if len(d.observations) > 0 {
+		d.childRemoving(p, c)
+	}
+}
+
+// notifies the ranges and observers of d that c was inserted
+func (d *Document) inserted(c Node) {
+	p := parentOf(c)
+	i := _childIndex{c: c}
+	for _, r := range d.ranges {
+		r.inserted(p, &i)
+	}
+	if len(d.observations) > 0 {
+		d.childAdded(p, c)
+	}
+}
+
+// Returns the root element of the document, or nil if there is none.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-87CD092
+func (d *Document) DocumentElement() *Element {
+	for c := d.FirstChild(); c != nil; c = c.NextSibling() {
+		if e, ok := c.(*Element); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// Returns the document type declaration, or nil if there is none.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-B63ED1A31
+func (d *Document) Doctype() *DocumentType {
+	for c := d.FirstChild(); c != nil; c = c.NextSibling() {
+		if dt, ok := c.(*DocumentType); ok {
+			return dt
+		}
+	}
+	return nil
+}
+
+// The version from the XML declaration, or the empty string if the
+// document does not have one.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#Document3-version
+func (d *Document) XmlVersion() string {
+	return d.xmlVersion
+}
+
+// Setting the version adds an XML declaration to the document.  Setting
+// the empty string removes it.
+func (d *Document) SetXmlVersion(version string) {
+	d.xmlVersion = version
+}
+
+// The encoding from the XML declaration.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#Document3-encoding
+func (d *Document) XmlEncoding() string {
+	return d.xmlEncoding
+}
+
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#Document3-standalone
+func (d *Document) XmlStandalone() bool {
+	return d.xmlStandalone == "yes"
+}
+
+func (d *Document) SetXmlStandalone(standalone bool) {
+	if standalone {
+		d.xmlStandalone = "yes"
+	} else {
+		d.xmlStandalone = ""
+	}
+}
+
+// records the pseudo-attributes of the XML declaration
+func (d *Document) setXmlDeclaration(data string) {
+	d.xmlVersion, _ = procInstParam(data, "version")
+	d.xmlEncoding, _ = procInstParam(data, "encoding")
+	d.xmlStandalone, _ = procInstParam(data, "standalone")
+}
+
+// returns the data for the XML declaration, or the empty string if the
+// document does not have one
+func (d *Document) xmlDeclaration() string {
+	if d.xmlVersion == "" {
+		return ""
+	}
+	s := "version=\"" + d.xmlVersion + "\""
+	if d.xmlEncoding != "" {
+		s += " encoding=\"" + d.xmlEncoding + "\""
+	}
+	if d.xmlStandalone != "" {
+		s += " standalone=\"" + d.xmlStandalone + "\""
+	}
+	return s
+}
+
+// Writes the document to w, using an Encoder with the default options.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(d, w)
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-3A0ED0A4
+func (d *Document) CloneNode(deep bool) Node {
+	ret := newDoc()
+	ret.xmlVersion, ret.xmlEncoding, ret.xmlStandalone = d.xmlVersion, d.xmlEncoding, d.xmlStandalone
+	if deep {
+		for c := d.FirstChild(); c != nil; c = c.NextSibling() {
+			appendChild(ret, cloneNode(c, true, nil))
+		}
+	}
+	return ret
+}
+
+// Copies a node from another document.  The copy is owned by this
+// document, but is not yet part of the tree.  Documents cannot be
+// imported, and nil is returned.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Core-Document-importNode
+func (d *Document) ImportNode(n Node, deep bool) Node {
+	n, _ = d.TryImportNode(n, deep)
+	return n
+}
+
+// Like ImportNode, but returns a DOMException for a document.
+func (d *Document) TryImportNode(n Node, deep bool) (Node, error) {
+	if n.NodeType() == DOCUMENT_NODE {
+		return nil, &DOMException{NOT_SUPPORTED_ERR, "documents cannot be imported"}
+	}
+	return cloneNode(n, deep, d), nil
+}
+
+// Moves a node, and its subtree, from another document into this one.
+// The node is removed from its parent.  Documents cannot be adopted, and
+// nil is returned.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Document3-adoptNode
+func (d *Document) AdoptNode(n Node) Node {
+	n, _ = d.TryAdoptNode(n)
+	return n
+}
+
+// Like AdoptNode, but returns a DOMException for a document.
+func (d *Document) TryAdoptNode(n Node) (Node, error) {
+	if n.NodeType() == DOCUMENT_NODE {
+		return nil, &DOMException{NOT_SUPPORTED_ERR, "documents cannot be adopted"}
+	}
+	if p := n.ParentNode(); p != nil {
+		p.removeChild(n)
+	}
+	if a, ok := n.(*_attr); ok && a.OwnerElement() != nil {
+		a.OwnerElement().RemoveAttributeNode(a)
+	}
+	// like the nodes from the Create methods, the owner is recorded as the parent
+	n.setParent(d)
+	return n, nil
+}
 
 func (d *Document) CreateElement(tag string) *Element {
 	ret := newElem(xml.StartElement{xml.Name{"", tag}, nil})
@@ -31,6 +216,105 @@ func (d *Document) CreateElement(tag string) *Element {
 	return ret
 }
 
+// DOM2: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-DocCrElNS
+func (d *Document) CreateElementNS(namespaceURI, qualifiedName string) *Element {
+	prefix, local := splitQualifiedName(qualifiedName)
+	ret := newElem(xml.StartElement{Name: xml.Name{Space: namespaceURI, Local: local}})
+	ret.pfx = prefix
+	ret.p = d
+	return ret
+}
+
+// Like CreateElement, but returns a DOMException when the tag is not a
+// valid XML name.
+func (d *Document) TryCreateElement(tag string) (*Element, error) {
+	if err := checkName(tag); err != nil {
+		return nil, err
+	}
+	return d.CreateElement(tag), nil
+}
+
+// Like CreateElementNS, but returns a DOMException when the qualified name
+// is not valid, or its prefix does not match the namespace.
+func (d *Document) TryCreateElementNS(namespaceURI, qualifiedName string) (*Element, error) {
+	if err := checkQualifiedName(namespaceURI, qualifiedName); err != nil {
+		return nil, err
+	}
+	return d.CreateElementNS(namespaceURI, qualifiedName), nil
+}
+
+// Creates an attribute owned by the document, which can be added to an
+// element with SetAttributeNode.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-1084891198
+func (d *Document) CreateAttribute(name string) Attr {
+	ret := newAttr(xml.Name{Local: name}, "", "")
+	ret.p = d
+	return ret
+}
+
+// DOM2: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-DocCrAttrNS
+func (d *Document) CreateAttributeNS(namespaceURI, qualifiedName string) Attr {
+	prefix, local := splitQualifiedName(qualifiedName)
+	ret := newAttr(xml.Name{Space: namespaceURI, Local: local}, prefix, "")
+	ret.p = d
+	return ret
+}
+
+// Like CreateAttribute, but returns a DOMException when the name is not a
+// valid XML name.
+func (d *Document) TryCreateAttribute(name string) (Attr, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	return d.CreateAttribute(name), nil
+}
+
+// Like CreateAttributeNS, but returns a DOMException when the qualified
+// name is not valid, or its prefix does not match the namespace.
+func (d *Document) TryCreateAttributeNS(namespaceURI, qualifiedName string) (Attr, error) {
+	if err := checkQualifiedName(namespaceURI, qualifiedName); err != nil {
+		return nil, err
+	}
+	return d.CreateAttributeNS(namespaceURI, qualifiedName), nil
+}
+
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-35CB04B5
+func (d *Document) CreateDocumentFragment() *DocumentFragment {
+	ret := newFragment()
+	ret.p = d
+	return ret
+}
+
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-D26C0AF8
+func (d *Document) CreateCDATASection(data string) *CDATASection {
+	ret := newCDATASection(xml.CharData([]byte(data)))
+	ret.p = d
+	return ret
+}
+
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-135944439
+func (d *Document) CreateProcessingInstruction(target, data string) *ProcessingInstruction {
+	ret := newProcInst(xml.ProcInst{Target: target, Inst: []byte(data)})
+	ret.p = d
+	return ret
+}
+
+// Like CreateProcessingInstruction, but returns a DOMException when the
+// target is not a valid XML name, or is reserved, and when the data
+// contains "?>", which an Encoder fails on and ToXml writes as "? >".
+func (d *Document) TryCreateProcessingInstruction(target, data string) (*ProcessingInstruction, error) {
+	if err := checkName(target); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(target, "xml") {
+		return nil, &DOMException{INVALID_CHARACTER_ERR, "reserved target " + target}
+	}
+	if !isProcInstData(data) {
+		return nil, &DOMException{INVALID_CHARACTER_ERR, "processing instruction data contains ?>"}
+	}
+	return d.CreateProcessingInstruction(target, data), nil
+}
+
 func (d *Document) CreateTextNode(text string) *Text {
 	ret := newText(xml.CharData([]byte(text)))
 	ret.p = d
@@ -43,18 +327,31 @@ func (d *Document) CreateComment(text string) *Comment {
 	return ret
 }
 
-func (d *Document) setRoot(r *Element) *Element {
-	// empty the children vector
-	if d.ChildNodes().Length() > 0 {
-		panic("Document.setRoot used on document with non-empty list of child nodes")
+// Like CreateComment, but returns a DOMException when the text contains
+// "--" or ends in "-", which cannot be written in a comment: an Encoder
+// fails on such a comment, and ToXml puts spaces between the hyphens.
+func (d *Document) TryCreateComment(text string) (*Comment, error) {
+	if !isCommentData(text) {
+		return nil, &DOMException{INVALID_CHARACTER_ERR, "comment text contains --"}
 	}
-	appendChild(d, r)
-	return r
+	return d.CreateComment(text), nil
+}
+
+func (d *Document) GetElementsByTagName(name string) NodeList {
+	return newTagNodeList(d, name)
+}
+
+// DOM Level 2
+func (d *Document) GetElementsByTagNameNS(namespaceURI, localName string) NodeList {
+	return newTagNodeListNS(d, namespaceURI, localName)
 }
 
 // DOM Level 2
 func (d *Document) GetElementById(id string) *Element {
-	return d.DocumentElement().GetElementById(id)
+	if r := d.DocumentElement(); r != nil {
+		return r.GetElementById(id)
+	}
+	return nil
 }
 
 func newDoc() *Document {
@@ -64,9 +361,14 @@ func newDoc() *Document {
 
 // Custom routines solely for golang
 func (doc *Document) ToXml() []byte {
-	return toXml(doc.DocumentElement())
+	return toXml(doc)
+}
+
+// Like ToXml, but with each element on its own line, indented by indent.
+func (doc *Document) ToXmlIndent(indent string) []byte {
+	return toXmlIndent(doc, indent)
 }
 
 func (doc *Document) ToText(escape bool) []byte {
-	return toText(doc.DocumentElement(), escape)
+	return toText(doc, escape)
 }
@@ -0,0 +1,58 @@
+package dom
+
+/*
+ * DocumentFragment implementation
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"io"
+)
+
+// A lightweight container for a list of nodes.  When a fragment is
+// inserted into the tree, its children are moved into the tree in its
+// place, leaving the fragment empty.  Like the nodes returned by the
+// Create methods, the parent of a fragment is its owner document.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-B63ED1A3
+type DocumentFragment struct {
+	_node
+}
+
+func (n *DocumentFragment) NodeType() uint                      { return DOCUMENT_FRAGMENT_NODE }
+func (n *DocumentFragment) NodeName() string                    { return "#document-fragment" }
+func (n *DocumentFragment) NodeValue() string                   { return "" }
+func (n *DocumentFragment) PreviousSibling() Node               { return nil }
+func (n *DocumentFragment) NextSibling() Node                   { return nil }
+func (n *DocumentFragment) AppendChild(c Node) Node             { return appendChild(n, c) }
+func (n *DocumentFragment) RemoveChild(c Node) Node             { return removeChild(n, c) }
+func (n *DocumentFragment) InsertBefore(c, ref Node) Node       { return insertBefore(n, c, ref) }
+func (n *DocumentFragment) ReplaceChild(c, old Node) Node       { return replaceChild(n, c, old) }
+func (n *DocumentFragment) TryAppendChild(c Node) (Node, error) { return tryAppendChild(n, c) }
+func (n *DocumentFragment) TryRemoveChild(c Node) (Node, error) { return tryRemoveChild(n, c) }
+func (n *DocumentFragment) TryInsertBefore(c, ref Node) (Node, error) {
+	return tryInsertBefore(n, c, ref)
+}
+func (n *DocumentFragment) TryReplaceChild(c, old Node) (Node, error) {
+	return tryReplaceChild(n, c, old)
+}
+func (n *DocumentFragment) OwnerDocument() *Document   { return ownerDocument(n) }
+func (n *DocumentFragment) CloneNode(deep bool) Node   { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *DocumentFragment) SetTextContent(text string) { setTextContent(n, text) }
+func (n *DocumentFragment) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+
+func newFragment() *DocumentFragment {
+	n := new(DocumentFragment)
+	return n
+}
+
+// Custom routines solely for golang
+func (n *DocumentFragment) ToXml() []byte {
+	return toXml(n)
+}
+
+func (n *DocumentFragment) ToText(escape bool) []byte {
+	return toText(n, escape)
+}
@@ -0,0 +1,130 @@
+package dom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocumentFragmentAppend(t *testing.T) {
+	d, _ := ParseStringXml(`<root><last/></root>`)
+	r := d.DocumentElement()
+	f := d.CreateDocumentFragment()
+	if f.NodeType() != DOCUMENT_FRAGMENT_NODE || f.NodeName() != "#document-fragment" || f.OwnerDocument() != d {
+		t.Errorf("DocumentFragment not created correctly")
+	}
+	f.AppendChild(d.CreateElement("a"))
+	f.AppendChild(d.CreateTextNode("b"))
+	f.AppendChild(d.CreateElement("c"))
+	if string(f.ToXml()) != "<a></a>b<c></c>" {
+		t.Errorf("DocumentFragment serialized as %s", f.ToXml())
+	}
+
+	if r.AppendChild(f) != Node(f) {
+		t.Errorf("AppendChild() did not return the fragment")
+	}
+	if string(d.ToXml()) != "<root><last></last><a></a>b<c></c></root>" {
+		t.Errorf("Children of the fragment not appended in order: %s", d.ToXml())
+	}
+	if f.HasChildNodes() {
+		t.Errorf("Fragment not emptied after insertion")
+	}
+	if r.LastChild().ParentNode() != Node(r) {
+		t.Errorf("Children of the fragment not reparented")
+	}
+}
+
+func TestDocumentFragmentInsertReplace(t *testing.T) {
+	d, _ := ParseStringXml(`<root><x/><y/></root>`)
+	r := d.DocumentElement()
+	x, y := r.FirstChild(), r.LastChild()
+
+	f := d.CreateDocumentFragment()
+	f.AppendChild(d.CreateElement("a"))
+	f.AppendChild(d.CreateElement("b"))
+	r.InsertBefore(f, y)
+	if string(d.ToXml()) != "<root><x></x><a></a><b></b><y></y></root>" {
+		t.Errorf("InsertBefore() with a fragment produced %s", d.ToXml())
+	}
+
+	f.AppendChild(d.CreateElement("c"))
+	f.AppendChild(d.CreateElement("d"))
+	if r.ReplaceChild(f, x) != x || x.ParentNode() != nil {
+		t.Errorf("ReplaceChild() did not return and detach the old child")
+	}
+	if string(d.ToXml()) != "<root><c></c><d></d><a></a><b></b><y></y></root>" {
+		t.Errorf("ReplaceChild() with a fragment produced %s", d.ToXml())
+	}
+	if r.FirstChild().ParentNode() != Node(r) {
+		t.Errorf("InsertBefore() did not set the parent")
+	}
+
+	if r.InsertBefore(d.CreateElement("z"), x) != nil {
+		t.Errorf("InsertBefore() with a reference node that is not a child")
+	}
+}
+
+func TestDocumentFragmentClone(t *testing.T) {
+	d, _ := ParseStringXml(`<root/>`)
+	f := d.CreateDocumentFragment()
+	f.AppendChild(d.CreateElement("a")).AppendChild(d.CreateTextNode("text"))
+	c := f.CloneNode(true).(*DocumentFragment)
+	if string(c.ToXml()) != "<a>text</a>" || c.FirstChild() == f.FirstChild() {
+		t.Errorf("DocumentFragment not cloned correctly")
+	}
+}
+
+func TestParseFragment(t *testing.T) {
+	d, _ := ParseStringXml(`<root xmlns="urn:default" xmlns:p="urn:p"><ctx/></root>`)
+	ctx := d.DocumentElement().FirstChild().(*Element)
+	f, err := ParseFragment(ctx, strings.NewReader(`<a p:x="1">one</a>text<p:b/><!--c-->`))
+	if err != nil {
+		t.Fatalf("Error parsing fragment (%v).", err)
+	}
+	if f.OwnerDocument() != d || f.ChildNodes().Length() != 4 {
+		t.Fatalf("Fragment not parsed correctly")
+	}
+	a := f.FirstChild().(*Element)
+	if a.NamespaceURI() != "urn:default" || a.GetAttributeNS("urn:p", "x") != "1" {
+		t.Errorf("Default namespace from the context not applied")
+	}
+	b := f.ChildNodes().Item(2).(*Element)
+	if b.NamespaceURI() != "urn:p" || b.Prefix() != "p" {
+		t.Errorf("Prefix from the context not resolved")
+	}
+
+	ctx.AppendChild(f)
+	if string(ctx.ToText(false)) != "onetext" || ctx.ChildNodes().Length() != 4 {
+		t.Errorf("Parsed fragment not inserted")
+	}
+
+	if _, err := ParseFragment(ctx, strings.NewReader(`<a><b></a>`)); err == nil {
+		t.Errorf("Parsed a malformed fragment")
+	}
+	if _, err := ParseFragment(ctx, strings.NewReader(`<q:a/>`)); err == nil {
+		t.Errorf("Parsed a fragment with an unbound prefix")
+	}
+	f, err = ParseFragment(nil, strings.NewReader(`<a/>b`))
+	if err != nil || f.OwnerDocument() != nil || f.ChildNodes().Length() != 2 {
+		t.Errorf("Fragment without a context not parsed")
+	}
+
+	// the snippet cannot close the element wrapped around it, which is not
+	// named in errors
+	test_cases := []struct {
+		in, err string
+	}{
+		{`a</` + fragmentWrapper + `><b/><` + fragmentWrapper + `>c`, "1:2: End tag without a start tag."},
+		{`a</` + fragmentWrapper + `>`, "1:2: End tag without a start tag."},
+		{`<a>`, "1:4: element <a> not closed"},
+		{`</x>`, "1:5: unexpected end element </x>"},
+	}
+	for _, v := range test_cases {
+		if _, err := ParseFragment(nil, strings.NewReader(v.in)); err == nil || err.Error() != v.err {
+			t.Errorf("Parsing %q returned %v", v.in, err)
+		}
+	}
+	f, err = ParseFragment(nil, strings.NewReader(`<`+fragmentWrapper+`>x</`+fragmentWrapper+`>`))
+	if err != nil || f.ChildNodes().Length() != 1 {
+		t.Errorf("Element named like the wrapper not parsed (%v)", err)
+	}
+}
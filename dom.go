@@ -22,34 +22,181 @@ const (
 	DEBUG = true
 )
 
+// A SyntaxError is returned when a document is malformed.  Errors found
+// by encoding/xml are kept in Err, so that errors.As still finds an
+// *xml.SyntaxError.
 type SyntaxError struct {
 	Msg string
+	Pos Position // where the error was found, if known
+	Err error    // the error from encoding/xml, if any
 }
 
 func (se *SyntaxError) Error() string {
+	if se.Pos.IsValid() {
+		return se.Pos.String() + ": " + se.Msg
+	}
 	return se.Msg
 }
 
+func (se *SyntaxError) Unwrap() error {
+	return se.Err
+}
+
 // ====================================
 
 // these are the package-level functions that are the real workhorses
 // they only use interface types
 
 func appendChild(p Node, c Node) Node {
+	c, _ = tryAppendChild(p, c)
+	return c
+}
+
+func removeChild(p Node, c Node) Node {
+	c, _ = tryRemoveChild(p, c)
+	return c
+}
+
+func insertBefore(p Node, newChild Node, refChild Node) Node {
+	newChild, _ = tryInsertBefore(p, newChild, refChild)
+	return newChild
+}
+
+func replaceChild(p Node, newChild Node, oldChild Node) Node {
+	oldChild, _ = tryReplaceChild(p, newChild, oldChild)
+	return oldChild
+}
+
+func tryAppendChild(p Node, c Node) (Node, error) {
+	return tryInsertBefore(p, c, nil)
+}
+
+func tryRemoveChild(p Node, c Node) (Node, error) {
+	if !p.node().hasChild(c) {
+		return nil, &DOMException{NOT_FOUND_ERR, "node is not a child"}
+	}
+	p.removeChild(c)
+	c.setParent(nil)
+	return c, nil
+}
+
+func tryInsertBefore(p Node, newChild Node, refChild Node) (Node, error) {
+	if refChild != nil && !p.node().hasChild(refChild) {
+		return nil, &DOMException{NOT_FOUND_ERR, "reference node is not a child"}
+	}
+	if err := checkChild(p, newChild, nil); err != nil {
+		return nil, err
+	}
+	if refChild == newChild {
+		// inserting a node before itself is implementation dependent
+		return newChild, nil
+	}
+	insertChild(p, newChild, refChild)
+	return newChild, nil
+}
+
+func tryReplaceChild(p Node, newChild Node, oldChild Node) (Node, error) {
+	if !p.node().hasChild(oldChild) {
+		return nil, &DOMException{NOT_FOUND_ERR, "node to replace is not a child"}
+	}
+	if err := checkChild(p, newChild, oldChild); err != nil {
+		return nil, err
+	}
+	if newChild == oldChild {
+		return oldChild, nil
+	}
+	insertChild(p, newChild, oldChild)
+	p.removeChild(oldChild)
+	oldChild.setParent(nil)
+	return oldChild, nil
+}
+
+// inserts c before ref, or at the end when ref is nil, after the checks
+func insertChild(p Node, c Node, ref Node) {
+	// the children of a fragment are moved instead of the fragment itself
+	if f, ok := c.(*DocumentFragment); ok {
+		for ch := f.FirstChild(); ch != nil; ch = f.FirstChild() {
+			insertChild(p, ch, ref)
+		}
+		return
+	}
 	// if the child is already in the tree somewhere,
 	// remove it before reparenting
 	if c.ParentNode() != nil {
-		removeChild(c.ParentNode(), c)
+		c.ParentNode().removeChild(c)
 	}
-	i := p.ChildNodes().Length()
-	p.insertChildAt(c, i)
+	p.insertChildBefore(c, ref)
 	c.setParent(p)
-	return c
+	if d := ownerDocument(p); d != nil && d.watched() {
+		d.inserted(c)
+	}
 }
 
-func removeChild(p Node, c Node) Node {
-	p.removeChild(c)
-	c.setParent(nil)
+// Copies n, and its subtree when deep is set.  The copy has no parent,
+// except that it refers to doc as its owner when doc is not nil.
+func cloneNode(n Node, deep bool, doc *Document) Node {
+	var c Node
+	switch n := n.(type) {
+	case *Element:
+		e := newElem(xml.StartElement{Name: n.n})
+		e.pfx = n.pfx
+		for _, a := range n.attribs {
+			e.addAttr(newAttr(a.n, a.pfx, a.v))
+		}
+		c = e
+	case *Text:
+		c = newText(xml.CharData(n.content))
+	case *CDATASection:
+		c = newCDATASection(xml.CharData(n.content))
+	case *ProcessingInstruction:
+		c = newProcInst(xml.ProcInst{Target: n.target, Inst: []byte(n.data)})
+	case *Comment:
+		c = newComment(xml.Comment(n.content))
+	case *CharacterData:
+		c = &CharacterData{content: append([]byte(nil), n.content...)}
+	case *_attr:
+		c = newAttr(n.n, n.pfx, n.v)
+	case *DocumentFragment:
+		c = newFragment()
+	case *DocumentType:
+		dt := newDoctype(n.n.Local, n.publicId, n.systemId)
+		dt.internalSubset = n.internalSubset
+		for _, e := range n.entities {
+			dt.entities = append(dt.entities, cloneNode(e, true, nil))
+			dt.entities[len(dt.entities)-1].setParent(dt)
+		}
+		for _, not := range n.notations {
+			dt.notations = append(dt.notations, cloneNode(not, true, nil))
+			dt.notations[len(dt.notations)-1].setParent(dt)
+		}
+		c = dt
+	case *Entity:
+		ent := new(Entity)
+		ent.n = n.n
+		ent.publicId, ent.systemId, ent.notationName = n.publicId, n.systemId, n.notationName
+		c = ent
+	case *Notation:
+		not := new(Notation)
+		not.n = n.n
+		not.publicId, not.systemId = n.publicId, n.systemId
+		c = not
+	case *Document:
+		return n.CloneNode(deep)
+	default:
+		c = n.CloneNode(deep)
+		if doc != nil {
+			c.setParent(doc)
+		}
+		return c
+	}
+	if deep && n.NodeType() != ATTRIBUTE_NODE {
+		for ch := n.FirstChild(); ch != nil; ch = ch.NextSibling() {
+			appendChild(c, cloneNode(ch, true, nil))
+		}
+	}
+	if doc != nil {
+		c.setParent(doc)
+	}
 	return c
 }
 
@@ -67,73 +214,148 @@ func prevSibling(n Node) Node {
 }
 */
 
+// Deprecated: use a Parser.
 func ParseString(s string, strict bool, autoClose []string, entity map[string]string) (doc *Document, err error) {
 	doc, err = Parse(strings.NewReader(s), strict, autoClose, entity)
 	return
 }
 
 func ParseStringHtml(s string) (doc *Document, err error) {
-	doc, err = Parse(strings.NewReader(s), false, xml.HTMLAutoClose, xml.HTMLEntity)
-	return
+	return HtmlParser().ParseString(s)
 }
 
 func ParseStringXml(s string) (doc *Document, err error) {
-	doc, err = Parse(strings.NewReader(s), true, nil, nil)
-	return
+	return XmlParser().ParseString(s)
 }
 
 func ParseHtml(r io.Reader) (doc *Document, err error) {
-	doc, err = Parse(r, false, xml.HTMLAutoClose, xml.HTMLEntity)
-	return
+	return HtmlParser().Parse(r)
 }
 
 func ParseXml(r io.Reader) (doc *Document, err error) {
-	doc, err = Parse(r, true, nil, nil)
-	return
+	return XmlParser().Parse(r)
 }
 
+// Deprecated: use a Parser.
 func Parse(r io.Reader, strict bool, autoClose []string, entity map[string]string) (doc *Document, err error) {
-	// Create parser and get first token
-	p := xml.NewDecoder(r)
-	t, err := p.Token()
-	if err != nil {
-		return nil, err
-	}
-	p.Strict = strict
-	p.AutoClose = autoClose
-	p.Entity = entity
+	p := &Parser{Strict: strict, AutoClose: autoClose, Entity: entity}
+	return p.Parse(r)
+}
 
-	d := newDoc()
-	e := (Node)(nil) // e is the current parent
+// Parses a snippet of XML in the context of an element, using XmlParser.
+func ParseFragment(ctx *Element, r io.Reader) (*DocumentFragment, error) {
+	return XmlParser().ParseFragment(ctx, r)
+}
+
+// builds the tree below top from the tokens read by p, starting with the
+// token t, until the end of the input
+func parseTokens(p *_decoder, t xml.Token, top Node, ns *_nsScope) (err error) {
+	opts := p.opts
+	e := top // e is the current parent
+	depth := 0
 	for t != nil {
 		switch token := t.(type) {
 		case xml.StartElement:
-			el := newElem(token)
-			for ar := range token.Attr {
-				el.SetAttribute(token.Attr[ar].Name.Local, token.Attr[ar].Value)
+			if depth++; p.limits.depth > 0 && depth > p.limits.depth {
+				return &LimitError{Limit: "MaxDepth", Max: p.limits.depth, Pos: p.position()}
 			}
-			if e == nil {
-				// set doc root
-				// this element is a child of e, the last element we found
-				e = d.setRoot(el)
-			} else {
-				// this element is a child of e, the last element we found
-				e = e.AppendChild(el)
+			if max := p.limits.attributes; max > 0 && len(token.Attr) > max {
+				return &LimitError{Limit: "MaxAttributes", Max: max, Pos: p.position()}
+			}
+			if err := p.addNode(); err != nil {
+				return err
+			}
+			ns = ns.push(token.Attr)
+			el, err := newElemNS(token, p.rawNames(), ns, opts.Strict && !opts.IgnoreNamespaces)
+			if err != nil {
+				return err
+			}
+			if opts.IgnoreNamespaces {
+				dropNamespaces(el)
+			}
+			el.pos = p.position()
+			// this element is a child of e, the last element we found
+			if _, err := tryAppendChild(e, el); err != nil {
+				if e.NodeType() == DOCUMENT_NODE {
+					return &SyntaxError{Msg: "Only one root element allowed."}
+				}
+				return err
 			}
+			e = el
 		case xml.CharData:
-			if e == nil {
+			if err := p.checkText(token); err != nil {
+				return err
+			}
+			if p.isCDATA() {
+				if e.NodeType() == DOCUMENT_NODE {
+					return &SyntaxError{Msg: "CDATA section not allowed outside of root element."}
+				}
+				if err := p.addNode(); err != nil {
+					return err
+				}
+				c := newCDATASection(token)
+				c.pos = p.position()
+				e.AppendChild(c)
+			} else if e.NodeType() == DOCUMENT_NODE {
 				// Have not yet seen root element
 				// Ignore white space, otherwise throw error
-				if strings.TrimSpace(string([]byte(t.(xml.CharData)))) != "" {
-					return nil, &SyntaxError{"Text not allowed outside of root element."}
+				if strings.TrimSpace(string([]byte(token))) != "" {
+					return &SyntaxError{Msg: "Text not allowed outside of root element."}
 				}
-			} else {
-				e.AppendChild(newText(token))
+			} else if !opts.IgnoreWhitespace || strings.TrimSpace(string(token)) != "" {
+				if err := p.addNode(); err != nil {
+					return err
+				}
+				text := newText(token)
+				text.pos = p.position()
+				e.AppendChild(text)
 			}
 		case xml.EndElement:
+			if e == top {
+				// the end of the wrapper around a fragment, which has to be
+				// the end of the input, or the snippet has closed it
+				pos := p.position()
+				if _, err := p.Token(); err != io.EOF {
+					return &SyntaxError{Msg: "End tag without a start tag.", Pos: pos}
+				}
+				return nil
+			}
 			e = e.ParentNode()
+			ns = ns.parent
+			depth--
 		case xml.Comment:
-			e.AppendChild(newComment(token))
+			if opts.IgnoreComments {
+				break
+			}
+			if err := p.checkText(token); err != nil {
+				return err
+			}
+			if err := p.addNode(); err != nil {
+				return err
+			}
+			c := newComment(token)
+			c.pos = p.position()
+			e.AppendChild(c)
+		case xml.Directive:
+			if d, ok := e.(*Document); ok {
+				if err := p.doctype(d, string(token)); err != nil {
+					return err
+				}
+			}
+		case xml.ProcInst:
+			if d, ok := e.(*Document); ok && token.Target == "xml" {
+				d.setXmlDeclaration(string(token.Inst))
+			} else {
+				if err := p.checkText(token.Inst); err != nil {
+					return err
+				}
+				if err := p.addNode(); err != nil {
+					return err
+				}
+				pi := newProcInst(token)
+				pi.pos = p.position()
+				e.AppendChild(pi)
+			}
 
 		default:
 			// TODO: add handling for other types (text nodes, etc)
@@ -144,52 +366,94 @@ func Parse(r io.Reader, strict bool, autoClose []string, entity map[string]strin
 
 	// Make sure that reading stopped on EOF
 	if err != io.EOF {
-		return nil, err
+		return err
 	}
-
-	// All is good, return the document
-	return d, nil
+	return nil
 }
 
-// called recursively
-func toXml(n Node) []byte {
-	s := ""
-
-	switch n.NodeType() {
-	case ELEMENT_NODE:
-		s += "<" + n.NodeName()
-
-		// iterate over attributes
-		for i := uint(0); i < n.Attributes().Length(); i++ {
-			a := n.Attributes().Item(i)
-			s += " " + a.NodeName() + "=\"" + a.NodeValue() + "\""
+// adds the document type from a directive to d, and makes its internal
+// entities known to the decoder
+func (p *_decoder) doctype(d *Document, dir string) error {
+	strict := p.opts.Strict
+	dt, err := parseDoctype(dir)
+	if err != nil && strict {
+		return err
+	}
+	if dt == nil || err != nil {
+		// other directives, and bad declarations in lenient mode, are dropped
+		return nil
+	}
+	if d.Doctype() != nil || d.DocumentElement() != nil {
+		if strict {
+			return &SyntaxError{Msg: "DOCTYPE not allowed here."}
 		}
-
-		s += ">"
-
-		// iterate over children
-		for ch := uint(0); ch < n.ChildNodes().Length(); ch++ {
-			s += string(toXml(n.ChildNodes().Item(ch)))
+		return nil
+	}
+	if err := p.resolveEntities(dt); err != nil {
+		return err
+	}
+	values, err := dt.expandEntities(p.Entity, p.limits.expansion)
+	if err != nil {
+		return err
+	}
+	if len(values) > 0 {
+		// references to these entities count towards MaxEntityExpansion
+		sizes := map[string]int{}
+		for k, v := range values {
+			sizes[k] = len(v)
 		}
+		p.raw.limits.entities = sizes
 
-		s += "</" + n.NodeName() + ">"
-
-	case TEXT_NODE:
-		s += string(n.(*Text).EscapedBytes())
-		break
-
-	case COMMENT_NODE:
-		s += "<!--" + string(n.(*Comment).EscapedBytes()) + "-->"
-		break
+		// copy the map, as it belongs to the caller
+		entity := map[string]string{}
+		for k, v := range p.Entity {
+			entity[k] = v
+		}
+		for k, v := range values {
+			entity[k] = v
+		}
+		p.Entity = entity
+	}
+	dt.pos = p.position()
+	d.AppendChild(dt)
+	return nil
+}
 
+// creates an element from a start tag, resolving the names of the element
+// and its attributes against the namespaces in scope.  qnames holds the
+// names as written, if known, in the order of rawNames.
+func newElemNS(token xml.StartElement, qnames []string, ns *_nsScope, strict bool) (*Element, error) {
+	if len(qnames) != len(token.Attr)+1 {
+		qnames = make([]string, len(token.Attr)+1)
+	}
+	name, prefix, ok := ns.resolve(token.Name, qnames[0], true)
+	if !ok && strict {
+		return nil, &SyntaxError{Msg: "Unbound namespace prefix on element <" + name.Local + ">."}
 	}
-	return []byte(s)
+	el := newElem(xml.StartElement{Name: name})
+	el.pfx = prefix
+	for i, a := range token.Attr {
+		name, prefix, ok := ns.resolve(a.Name, qnames[i+1], false)
+		if !ok && strict {
+			return nil, &SyntaxError{Msg: "Unbound namespace prefix on attribute " + name.Local + "."}
+		}
+		if old := el.attributeNS(name.Space, name.Local); old != nil {
+			// http://www.w3.org/TR/xml-names/#uniqAttrs
+			if strict {
+				return nil, &SyntaxError{Msg: "Duplicate attribute " + qualifiedName(prefix, name.Local) + "."}
+			}
+			old.v = a.Value
+			continue
+		}
+		el.addAttr(newAttr(name, prefix, a.Value))
+	}
+	return el, nil
 }
 
 // called recursively
 func toText(n Node, escape bool) []byte {
 	switch n.NodeType() {
-	case ELEMENT_NODE:
+	case ELEMENT_NODE, DOCUMENT_NODE, DOCUMENT_FRAGMENT_NODE:
 		// iterate over children
 		s := []byte(nil)
 		for ch := uint(0); ch < n.ChildNodes().Length(); ch++ {
@@ -203,6 +467,12 @@ func toText(n Node, escape bool) []byte {
 		}
 		return n.(*Text).content
 
+	case CDATA_SECTION_NODE:
+		if escape {
+			return n.(*CDATASection).EscapedBytes()
+		}
+		return n.(*CDATASection).content
+
 	}
 	return []byte(nil)
 }
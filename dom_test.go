@@ -741,3 +741,91 @@ func TestToTextEscaped(t *testing.T) {
 		t.Errorf("Error reconstructing text of a marked-up element.")
 	}
 }
+
+func TestCloneNodeShallow(t *testing.T) {
+	d, _ := ParseStringXml(`<root a="1"><child>text</child></root>`)
+	r := d.DocumentElement()
+	c := r.CloneNode(false).(*Element)
+	if c == r || c.NodeName() != "root" || c.GetAttribute("a") != "1" {
+		t.Errorf("Element not cloned correctly")
+	}
+	if c.HasChildNodes() {
+		t.Errorf("Shallow clone copied the children")
+	}
+	if c.OwnerDocument() != d || c.ParentNode() != Node(d) || d.ChildNodes().Length() != 1 {
+		t.Errorf("Clone not owned by the document, or was added to the tree")
+	}
+	c.SetAttribute("a", "2")
+	if r.GetAttribute("a") != "1" {
+		t.Errorf("Clone shares attributes with the original")
+	}
+}
+
+func TestCloneNodeDeep(t *testing.T) {
+	d, _ := ParseStringXml(`<root xmlns:p="urn:p"><p:child p:a="1">text<!--c--></p:child></root>`)
+	r := d.DocumentElement()
+	c := r.CloneNode(true).(*Element)
+	if string(c.ToXml()) != string(r.ToXml()) {
+		t.Errorf("Deep clone serialized as %s", c.ToXml())
+	}
+	child := c.FirstChild().(*Element)
+	if child == r.FirstChild() || child.ParentNode() != Node(c) {
+		t.Errorf("Children of the clone not reparented")
+	}
+	if child.NamespaceURI() != "urn:p" || child.Prefix() != "p" || child.GetAttributeNS("urn:p", "a") != "1" {
+		t.Errorf("Namespaces not cloned")
+	}
+	txt := child.FirstChild().(*Text)
+	txt.SetData("changed")
+	if string(r.ToText(false)) != "text" {
+		t.Errorf("Clone shares character data with the original")
+	}
+
+	dc := d.CloneNode(true).(*Document)
+	if dc.DocumentElement() == r || string(dc.ToXml()) != string(d.ToXml()) {
+		t.Errorf("Document not cloned correctly")
+	}
+	if dc.DocumentElement().OwnerDocument() != dc {
+		t.Errorf("Cloned document does not own its children")
+	}
+}
+
+func TestImportNode(t *testing.T) {
+	src, _ := ParseStringXml(`<src><item id="x">one</item></src>`)
+	dst, _ := ParseStringXml(`<dst/>`)
+	item := src.GetElementById("x")
+	n := dst.ImportNode(item, true)
+	if ownerDocument(n) != dst || n.ParentNode() != Node(dst) {
+		t.Errorf("Imported node not owned by the document")
+	}
+	if item.ParentNode() != Node(src.DocumentElement()) {
+		t.Errorf("Importing removed the node from the source")
+	}
+	dst.DocumentElement().AppendChild(n)
+	if string(dst.ToXml()) != `<dst><item id="x">one</item></dst>` {
+		t.Errorf("Imported node serialized as %s", dst.ToXml())
+	}
+	if dst.ImportNode(src, true) != nil {
+		t.Errorf("Imported a document")
+	}
+}
+
+func TestAdoptNode(t *testing.T) {
+	src, _ := ParseStringXml(`<src><item>one</item><other/></src>`)
+	dst, _ := ParseStringXml(`<dst/>`)
+	item := src.DocumentElement().FirstChild()
+	n := dst.AdoptNode(item)
+	if n != item || ownerDocument(n) != dst {
+		t.Errorf("Adopted node not owned by the document")
+	}
+	if src.DocumentElement().ChildNodes().Length() != 1 {
+		t.Errorf("Adopted node not removed from its parent")
+	}
+	dst.DocumentElement().AppendChild(n)
+	if string(dst.ToXml()) != `<dst><item>one</item></dst>` || string(src.ToXml()) != `<src><other></other></src>` {
+		t.Errorf("Adoption produced %s and %s", dst.ToXml(), src.ToXml())
+	}
+	if dst.AdoptNode(src) != nil {
+		t.Errorf("Adopted a document")
+	}
+}
@@ -10,52 +10,65 @@ package dom
 
 import (
 	"encoding/xml"
+	"io"
 )
 
 // DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-745549614
 type Element struct {
 	_node
-	attribs []struct {
-		name  string // attributes of the element
-		value string
-	} // attributes of the element
-}
-
-func (e *Element) NodeType() uint           { return ELEMENT_NODE }
-func (n *Element) NodeName() string         { return n.n.Local }
-func (n *Element) NodeValue() string        { return "" }
-func (n *Element) PreviousSibling() Node    { return previousSibling(Node(n), n.p.ChildNodes()) }
-func (n *Element) NextSibling() Node        { return nextSibling(Node(n), n.p.ChildNodes()) }
-func (n *Element) AppendChild(c Node) Node  { return appendChild(n, c) }
-func (n *Element) RemoveChild(c Node) Node  { return removeChild(n, c) }
-func (n *Element) OwnerDocument() *Document { return ownerDocument(n) }
-func (n *Element) TagName() string          { return n.NodeName() }
-func (n *Element) Attributes() NamedNodeMap { return newAttrNamedNodeMap(n) }
+	attribs []*_attr // attributes of the element, which refer to it as parent
+}
+
+func (e *Element) NodeType() uint                            { return ELEMENT_NODE }
+func (n *Element) NodeName() string                          { return n.qualifiedName() }
+func (n *Element) NodeValue() string                         { return "" }
+func (n *Element) AppendChild(c Node) Node                   { return appendChild(n, c) }
+func (n *Element) RemoveChild(c Node) Node                   { return removeChild(n, c) }
+func (n *Element) InsertBefore(c, ref Node) Node             { return insertBefore(n, c, ref) }
+func (n *Element) ReplaceChild(c, old Node) Node             { return replaceChild(n, c, old) }
+func (n *Element) TryAppendChild(c Node) (Node, error)       { return tryAppendChild(n, c) }
+func (n *Element) TryRemoveChild(c Node) (Node, error)       { return tryRemoveChild(n, c) }
+func (n *Element) TryInsertBefore(c, ref Node) (Node, error) { return tryInsertBefore(n, c, ref) }
+func (n *Element) TryReplaceChild(c, old Node) (Node, error) { return tryReplaceChild(n, c, old) }
+func (n *Element) OwnerDocument() *Document                  { return ownerDocument(n) }
+func (n *Element) CloneNode(deep bool) Node                  { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *Element) TagName() string                           { return n.NodeName() }
+func (n *Element) Attributes() NamedNodeMap                  { return newAttrNamedNodeMap(n) }
+func (n *Element) SetTextContent(text string)                { setTextContent(n, text) }
+func (n *Element) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
 
 func (n *Element) GetAttribute(name string) string {
-	for i := range n.attribs {
-		if n.attribs[i].name == name {
-			return n.attribs[i].value
-		}
+	if a := n.attribute(name); a != nil {
+		return a.v
 	}
 	return ""
 }
 func (n *Element) SetAttribute(attrname string, attrval string) {
-	for i := range n.attribs {
-		if n.attribs[i].name == attrname {
-			n.attribs[i].value = attrval
-			return
-		}
+	if a := n.attribute(attrname); a != nil {
+		n.attributeChanging(a.n, a.v)
+		a.v = attrval
+		return
+	}
+	n.addAttr(newAttr(xml.Name{Space: "", Local: attrname}, "", attrval))
+}
+
+// Like SetAttribute, but returns a DOMException when the name is not a
+// valid XML name.
+func (n *Element) TrySetAttribute(attrname string, attrval string) error {
+	if err := checkName(attrname); err != nil {
+		return err
 	}
-	n.attribs = append(n.attribs, struct{ name, value string }{attrname, attrval})
-	return
+	n.SetAttribute(attrname, attrval)
+	return nil
 }
 
 // http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-6D6AC0F9
 func (n *Element) RemoveAttribute(attrname string) {
 	for i := range n.attribs {
-		if n.attribs[i].name == attrname {
-			n.attribs = append(n.attribs[:i], n.attribs[i+1:]...)
+		if n.attribs[i].qualifiedName() == attrname {
+			n.removeAttr(i)
 			return
 		}
 	}
@@ -63,28 +76,204 @@ func (n *Element) RemoveAttribute(attrname string) {
 
 // http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-ElHasAttr
 func (n *Element) HasAttribute(attrname string) bool {
+	return n.attribute(attrname) != nil
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-ElGetAttrNS
+func (n *Element) GetAttributeNS(namespaceURI, localName string) string {
+	if a := n.attributeNS(namespaceURI, localName); a != nil {
+		return a.v
+	}
+	return ""
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-ElSetAttrNS
+func (n *Element) SetAttributeNS(namespaceURI, qualifiedName, value string) {
+	prefix, local := splitQualifiedName(qualifiedName)
+	if a := n.attributeNS(namespaceURI, local); a != nil {
+		n.attributeChanging(a.n, a.v)
+		a.pfx = prefix
+		a.v = value
+		return
+	}
+	n.addAttr(newAttr(xml.Name{Space: namespaceURI, Local: local}, prefix, value))
+}
+
+// Like SetAttributeNS, but returns a DOMException when the qualified name
+// is not valid, or its prefix does not match the namespace.
+func (n *Element) TrySetAttributeNS(namespaceURI, qualifiedName, value string) error {
+	if err := checkQualifiedName(namespaceURI, qualifiedName); err != nil {
+		return err
+	}
+	n.SetAttributeNS(namespaceURI, qualifiedName, value)
+	return nil
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-ElRemAtNS
+func (n *Element) RemoveAttributeNS(namespaceURI, localName string) {
 	for i := range n.attribs {
-		if n.attribs[i].name == attrname {
-			return true
+		if n.attribs[i].n.Space == namespaceURI && n.attribs[i].n.Local == localName {
+			n.removeAttr(i)
+			return
 		}
 	}
-	return false
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-ElHasAttrNS
+func (n *Element) HasAttributeNS(namespaceURI, localName string) bool {
+	return n.attributeNS(namespaceURI, localName) != nil
+}
+
+// Returns the attribute named name, or nil.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-217A91B8
+func (n *Element) GetAttributeNode(name string) Attr {
+	if a := n.attribute(name); a != nil {
+		return a
+	}
+	return nil
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-ElGetAtNodeNS
+func (n *Element) GetAttributeNodeNS(namespaceURI, localName string) Attr {
+	if a := n.attributeNS(namespaceURI, localName); a != nil {
+		return a
+	}
+	return nil
+}
+
+// Adds an attribute, replacing the attribute with the same name.  Returns
+// the attribute replaced, or nil.  The attribute must not belong to
+// another element.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-887236154
+func (n *Element) SetAttributeNode(a Attr) Attr {
+	old, _ := n.TrySetAttributeNode(a)
+	return old
+}
+
+func (n *Element) TrySetAttributeNode(a Attr) (Attr, error) {
+	return n.setAttributeNode(a, false)
+}
+
+// Like SetAttributeNode, but replaces the attribute with the same
+// namespace URI and local name.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-ElSetAtNodeNS
+func (n *Element) SetAttributeNodeNS(a Attr) Attr {
+	old, _ := n.TrySetAttributeNodeNS(a)
+	return old
+}
+
+func (n *Element) TrySetAttributeNodeNS(a Attr) (Attr, error) {
+	return n.setAttributeNode(a, true)
+}
+
+// Removes an attribute of the element, and returns it.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-D589198
+func (n *Element) RemoveAttributeNode(a Attr) Attr {
+	a, _ = n.TryRemoveAttributeNode(a)
+	return a
+}
+
+func (n *Element) TryRemoveAttributeNode(a Attr) (Attr, error) {
+	for i := range n.attribs {
+		if Attr(n.attribs[i]) == a {
+			return n.removeAttr(i), nil
+		}
+	}
+	return nil, &DOMException{NOT_FOUND_ERR, "not an attribute of the element"}
+}
+
+func (n *Element) setAttributeNode(arg Node, ns bool) (Attr, error) {
+	a, ok := arg.(*_attr)
+	if !ok {
+		return nil, &DOMException{HIERARCHY_REQUEST_ERR, "only attributes can be set"}
+	}
+	if d, ad := n.OwnerDocument(), a.OwnerDocument(); d != nil && ad != nil && d != ad {
+		return nil, &DOMException{WRONG_DOCUMENT_ERR, "attribute belongs to another document"}
+	}
+	if owner := a.OwnerElement(); owner == n {
+		return a, nil
+	} else if owner != nil {
+		return nil, &DOMException{INUSE_ATTRIBUTE_ERR, "attribute belongs to another element"}
+	}
+	for i, old := range n.attribs {
+		if ns && old.n == a.n || !ns && old.qualifiedName() == a.qualifiedName() {
+			n.attributeChanging(old.n, old.v)
+			n.attribs[i] = a
+			a.p = n
+			old.detach(n.OwnerDocument())
+			return old, nil
+		}
+	}
+	n.addAttr(a)
+	return nil, nil
+}
+
+func (n *Element) addAttr(a *_attr) {
+	n.attributeChanging(a.n, "")
+	a.p = n
+	n.attribs = append(n.attribs, a)
+}
+
+func (n *Element) removeAttr(i int) *_attr {
+	a := n.attribs[i]
+	n.attributeChanging(a.n, a.v)
+	n.attribs = append(n.attribs[:i], n.attribs[i+1:]...)
+	a.detach(n.OwnerDocument())
+	return a
+}
+
+func (n *Element) attribute(name string) *_attr {
+	for i := range n.attribs {
+		if n.attribs[i].qualifiedName() == name {
+			return n.attribs[i]
+		}
+	}
+	return nil
+}
+
+func (n *Element) attributeNS(namespaceURI, localName string) *_attr {
+	for i := range n.attribs {
+		if n.attribs[i].n.Space == namespaceURI && n.attribs[i].n.Local == localName {
+			return n.attribs[i]
+		}
+	}
+	return nil
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Node3-lookupNamespaceURI
+func (n *Element) LookupNamespaceURI(prefix string) string {
+	uri, _ := lookupNamespaceURI(n, prefix)
+	return uri
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Node3-lookupNamespacePrefix
+func (n *Element) LookupPrefix(namespaceURI string) string {
+	prefix, _ := lookupPrefix(n, namespaceURI)
+	return prefix
 }
 
 func (n *Element) GetElementsByTagName(name string) NodeList {
 	return newTagNodeList(n, name)
 }
 
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-A6C90942
+func (n *Element) GetElementsByTagNameNS(namespaceURI, localName string) NodeList {
+	return newTagNodeListNS(n, namespaceURI, localName)
+}
+
 func newElem(token xml.StartElement) *Element {
 	n := new(Element)
 	n.n = token.Name
 	return n
 }
 
+// Without a DTD, the attributes treated as IDs are id, xml:id, and any
+// attribute with the local name ID or Id, such as those used by SAML and
+// WS-Security.
 func (e *Element) GetElementById(id string) *Element {
 	// check for an id
-	if av := e.GetAttribute("id"); av != "" {
-		if av == id {
+	for i := range e.attribs {
+		if a := e.attribs[i]; id != "" && a.v == id && isIdAttribute(a) {
 			return e
 		}
 	}
@@ -109,11 +298,26 @@ func (e *Element) GetElementById(id string) *Element {
 	return nil
 }
 
+func isIdAttribute(a *_attr) bool {
+	switch a.n.Local {
+	case "id":
+		return a.n.Space == "" || a.n.Space == XML_NAMESPACE
+	case "ID", "Id":
+		return a.n.Space != XMLNS_NAMESPACE
+	}
+	return false
+}
+
 // Custom routines solely for golang
 func (n *Element) ToXml() []byte {
 	return toXml(Node(n))
 }
 
+// Like ToXml, but with each element on its own line, indented by indent.
+func (n *Element) ToXmlIndent(indent string) []byte {
+	return toXmlIndent(n, indent)
+}
+
 func (n *Element) ToText(escape bool) []byte {
 	return toText(Node(n), escape)
 }
@@ -0,0 +1,580 @@
+package dom
+
+/*
+ * Streaming serialization of nodes to an io.Writer
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Encoder writes nodes as XML to an output stream.  The fields can be
+// set after calling NewEncoder to control the output, and must not be
+// changed while a node is being encoded.
+type Encoder struct {
+	// Write an XML declaration before a document.  Documents that were
+	// parsed with a declaration, or that have a version set, always get
+	// one.
+	XmlDeclaration bool
+	// Put each element on its own line, indented by Indent for each
+	// level of nesting.  Elements that only contain text are kept on one
+	// line, and the subtrees of elements with xml:space="preserve" are
+	// written as they are.
+	Indent string
+	// When indenting, write elements that mix text and child elements as
+	// they are, so that their content does not change.  Otherwise the text
+	// is trimmed and put on its own lines along with the child elements.
+	InlineMixed bool
+	// When indenting, start tags that would be wider than MaxWidth
+	// characters are written with each attribute on its own line.  Zero
+	// means no limit.
+	MaxWidth int
+	// Written for each line break.  The default is "\n".
+	LineEnding string
+	// Write elements without children as <a/> instead of <a></a>.
+	SelfClose bool
+	// Either '"' or '\'', used to quote attribute values.  The default
+	// is '"'.
+	QuoteChar byte
+	// The character encoding of the output, which is UTF-8 by default, or
+	// any charset known to LookupCharset.  Characters in text and attribute
+	// values that cannot be encoded are written as character references.
+	Encoding string
+
+	w   *bufio.Writer
+	cw  *_countingWriter
+	err error
+
+	// the output charset, or nil for UTF-8
+	charset Charset
+	buf     []byte
+	// the largest character that is written as it is in text and
+	// attribute values
+	maxLiteral rune
+	// the byte order mark has been written
+	wroteBOM bool
+	// keep the encoding from the XML declaration of the document
+	keepEncoding bool
+	// write comment and processing instruction data that would end the
+	// markup early with spaces put in, rather than failing
+	splitData bool
+	// inside of an element with xml:space="preserve"
+	preserve bool
+}
+
+type _countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *_countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// An EncoderError is returned when a node cannot be written.
+type EncoderError struct {
+	Msg string
+}
+
+func (e *EncoderError) Error() string {
+	return "dom: " + e.Msg
+}
+
+// Returns an Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	cw := &_countingWriter{w: w}
+	return &Encoder{cw: cw, w: bufio.NewWriter(cw)}
+}
+
+// Writes n, and its subtree, to the output stream.
+func (enc *Encoder) Encode(n Node) error {
+	enc.err = nil
+	enc.preserve = false
+	if err := enc.setup(); err != nil {
+		return err
+	}
+	if cs, ok := enc.charset.(*_utf16Charset); ok && cs.bom && !enc.wroteBOM {
+		enc.writeRune(0xFEFF)
+		enc.wroteBOM = true
+	}
+	enc.writeNode(n, 0)
+	if err := enc.w.Flush(); enc.err == nil {
+		enc.err = err
+	}
+	return enc.err
+}
+
+func (enc *Encoder) setup() error {
+	if enc.LineEnding == "" {
+		enc.LineEnding = "\n"
+	}
+	if enc.QuoteChar == 0 {
+		enc.QuoteChar = '"'
+	}
+	if enc.QuoteChar != '"' && enc.QuoteChar != '\'' {
+		return &EncoderError{"invalid quote character " + strconv.Quote(string(enc.QuoteChar))}
+	}
+	enc.charset = nil
+	if enc.Encoding != "" {
+		cs := LookupCharset(enc.Encoding)
+		if cs == nil {
+			return &EncoderError{"unsupported encoding " + enc.Encoding}
+		}
+		if _, ok := cs.(_utf8Charset); !ok {
+			enc.charset = cs
+		}
+	}
+	if !enc.keepEncoding {
+		enc.maxLiteral = utf8.MaxRune
+	}
+	return nil
+}
+
+// returns the encoder used by ToXml, which writes UTF-8 with everything
+// outside of ASCII escaped, and cannot fail on comment or processing
+// instruction data
+func newToXmlEncoder(w io.Writer) *Encoder {
+	enc := NewEncoder(w)
+	enc.maxLiteral = 0x7F
+	enc.keepEncoding = true
+	enc.splitData = true
+	return enc
+}
+
+// The per-type WriteTo methods use the default options.
+func writeTo(n Node, w io.Writer) (int64, error) {
+	enc := NewEncoder(w)
+	err := enc.Encode(n)
+	return enc.cw.n, err
+}
+
+// ====================================
+
+// writes markup, which cannot contain character references
+func (enc *Encoder) writeRaw(s string) {
+	if enc.err != nil {
+		return
+	}
+	if enc.charset == nil {
+		_, enc.err = enc.w.WriteString(s)
+		return
+	}
+	for _, r := range s {
+		if !enc.writeRune(r) {
+			enc.err = &EncoderError{"character " + strconv.QuoteRune(r) + " cannot be written in " + enc.Encoding}
+			return
+		}
+	}
+}
+
+// writes a single character in the output encoding, returning false if
+// that is not possible
+func (enc *Encoder) writeRune(r rune) bool {
+	if enc.charset == nil {
+		_, enc.err = enc.w.WriteRune(r)
+		return true
+	}
+	b, ok := enc.charset.AppendRune(enc.buf[:0], r)
+	if ok {
+		_, enc.err = enc.w.Write(b)
+	}
+	enc.buf = b
+	return ok
+}
+
+// true if r can be written in the output encoding
+func (enc *Encoder) canEncode(r rune) bool {
+	if enc.charset == nil {
+		return true
+	}
+	b, ok := enc.charset.AppendRune(enc.buf[:0], r)
+	enc.buf = b
+	return ok
+}
+
+func (enc *Encoder) writeCharRef(r rune) {
+	enc.writeRaw("&#" + strconv.Itoa(int(r)) + ";")
+}
+
+// writes character data, replacing line breaks with the line ending
+func (enc *Encoder) writeData(s string) {
+	if enc.LineEnding != "\n" {
+		s = strings.Replace(s, "\n", enc.LineEnding, -1)
+	}
+	enc.writeRaw(s)
+}
+
+func (enc *Encoder) writeText(s string) {
+	for _, r := range s {
+		if enc.err != nil {
+			return
+		}
+		if !isXmlChar(r) {
+			r = utf8.RuneError
+		}
+		switch {
+		case r == '\r':
+			// would otherwise be turned into a line feed when parsed
+			enc.writeRaw("&#13;")
+		case r == '<':
+			enc.writeRaw("&lt;")
+		case r == '>':
+			enc.writeRaw("&gt;")
+		case r == '&':
+			enc.writeRaw("&amp;")
+		case r == '\n' && enc.LineEnding != "\n":
+			enc.writeRaw(enc.LineEnding)
+		case r > enc.maxLiteral || !enc.canEncode(r):
+			enc.writeCharRef(r)
+		default:
+			enc.writeRune(r)
+		}
+	}
+}
+
+// Writes an attribute value, so that it is read back unchanged.  White
+// space other than spaces is written as character references, as the
+// parser would normalize it to spaces, and characters that are not allowed
+// in XML are replaced.
+// http://www.w3.org/TR/REC-xml/#AVNormalize
+func (enc *Encoder) writeAttrValue(s string) {
+	enc.writeRune(rune(enc.QuoteChar))
+	for _, r := range s {
+		if enc.err != nil {
+			return
+		}
+		if !isXmlChar(r) {
+			r = utf8.RuneError
+		}
+		switch {
+		case r == '\t':
+			enc.writeRaw("&#9;")
+		case r == '\n':
+			enc.writeRaw("&#10;")
+		case r == '\r':
+			enc.writeRaw("&#13;")
+		case r == '>':
+			enc.writeRaw("&gt;")
+		case r == '<':
+			enc.writeRaw("&lt;")
+		case r == '&':
+			enc.writeRaw("&amp;")
+		case r == '"' && enc.QuoteChar == '"':
+			enc.writeRaw("&quot;")
+		case r == '\'' && enc.QuoteChar == '\'':
+			enc.writeRaw("&apos;")
+		case r > enc.maxLiteral || !enc.canEncode(r):
+			enc.writeCharRef(r)
+		default:
+			enc.writeRune(r)
+		}
+	}
+	enc.writeRune(rune(enc.QuoteChar))
+}
+
+// true if r is allowed in an XML document, even as a character reference
+// http://www.w3.org/TR/REC-xml/#NT-Char
+func isXmlChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// true if data can be written in a comment, which would otherwise end
+// early
+// http://www.w3.org/TR/REC-xml/#NT-Comment
+func isCommentData(data string) bool {
+	return !strings.Contains(data, "--") && !strings.HasSuffix(data, "-")
+}
+
+// true if data can be written in a processing instruction
+// http://www.w3.org/TR/REC-xml/#NT-PI
+func isProcInstData(data string) bool {
+	return !strings.Contains(data, "?>")
+}
+
+// puts a space between the hyphens that would end a comment early
+func splitCommentData(data string) string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, r := range data {
+		if r == '-' && prev == '-' {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	if prev == '-' {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func (enc *Encoder) newline(depth int) {
+	enc.writeRaw(enc.LineEnding)
+	for i := 0; i < depth; i++ {
+		enc.writeRaw(enc.Indent)
+	}
+}
+
+// called recursively
+func (enc *Encoder) writeNode(n Node, depth int) {
+	if enc.err != nil {
+		return
+	}
+	switch n.NodeType() {
+	case DOCUMENT_NODE:
+		enc.writeDocument(n.(*Document))
+
+	case DOCUMENT_FRAGMENT_NODE:
+		enc.writeChildren(n, depth, false)
+
+	case ELEMENT_NODE:
+		enc.writeElement(n.(*Element), depth)
+
+	case ATTRIBUTE_NODE:
+		enc.writeRaw(n.NodeName() + "=")
+		enc.writeAttrValue(n.NodeValue())
+
+	case TEXT_NODE:
+		enc.writeText(n.NodeValue())
+
+	case CDATA_SECTION_NODE:
+		enc.writeRaw("<![CDATA[")
+		data := n.NodeValue()
+		for i, r := range data {
+			switch {
+			case r == '>' && strings.HasSuffix(data[:i], "]]"):
+				// the end of the section has to be split across two sections
+				enc.writeRaw("]]><![CDATA[>")
+			case !enc.canEncode(r):
+				// characters that cannot be encoded are written outside of the section
+				enc.writeRaw("]]>")
+				enc.writeCharRef(r)
+				enc.writeRaw("<![CDATA[")
+			case r == '\n' && enc.LineEnding != "\n":
+				enc.writeRaw(enc.LineEnding)
+			default:
+				enc.writeRune(r)
+			}
+		}
+		enc.writeRaw("]]>")
+
+	case COMMENT_NODE:
+		data := n.NodeValue()
+		switch {
+		case isCommentData(data):
+		case enc.splitData:
+			data = splitCommentData(data)
+		default:
+			enc.err = &EncoderError{"comment cannot contain \"--\" or end in \"-\": " + strconv.Quote(data)}
+			return
+		}
+		enc.writeRaw("<!--")
+		enc.writeData(data)
+		enc.writeRaw("-->")
+
+	case PROCESSING_INSTRUCTION_NODE:
+		data := n.NodeValue()
+		switch {
+		case isProcInstData(data):
+		case enc.splitData:
+			data = strings.Replace(data, "?>", "? >", -1)
+		default:
+			enc.err = &EncoderError{"processing instruction cannot contain \"?>\": " + strconv.Quote(data)}
+			return
+		}
+		enc.writeRaw("<?" + n.NodeName())
+		if data != "" {
+			enc.writeRaw(" ")
+			enc.writeData(data)
+		}
+		enc.writeRaw("?>")
+
+	case DOCUMENT_TYPE_NODE:
+		enc.writeRaw("<!")
+		enc.writeData(n.(*DocumentType).declaration())
+		enc.writeRaw(">")
+
+	default:
+		enc.err = &EncoderError{"cannot write a node of type " + strconv.Itoa(int(n.NodeType()))}
+	}
+}
+
+func (enc *Encoder) writeDocument(d *Document) {
+	version := d.xmlVersion
+	if version == "" && enc.XmlDeclaration {
+		version = "1.0"
+	}
+	wrote := false
+	if version != "" {
+		enc.writeRaw("<?xml version=\"" + version + "\"")
+		encoding := enc.Encoding
+		if encoding == "" && d.xmlEncoding != "" {
+			// the output is in UTF-8, unless only ASCII is written, which
+			// keeps the encoding of the document if it has the same bytes
+			encoding = "UTF-8"
+			if enc.keepEncoding && isASCIICompatible(d.xmlEncoding) {
+				encoding = d.xmlEncoding
+			}
+		}
+		if encoding != "" {
+			enc.writeRaw(" encoding=\"" + encoding + "\"")
+		}
+		if d.xmlStandalone != "" {
+			enc.writeRaw(" standalone=\"" + d.xmlStandalone + "\"")
+		}
+		enc.writeRaw("?>")
+		wrote = true
+	}
+	for c := d.FirstChild(); c != nil; c = c.NextSibling() {
+		if wrote && enc.Indent != "" {
+			enc.writeRaw(enc.LineEnding)
+		}
+		enc.writeNode(c, 0)
+		wrote = true
+	}
+}
+
+// true if the charset encodes each ASCII character as the same byte
+func isASCIICompatible(encoding string) bool {
+	cs := LookupCharset(encoding)
+	if cs == nil {
+		return false
+	}
+	var b []byte
+	for r := rune(0); r < utf8.RuneSelf; r++ {
+		var ok bool
+		if b, ok = cs.AppendRune(b[:0], r); !ok || len(b) != 1 || b[0] != byte(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (enc *Encoder) writeElement(e *Element, depth int) {
+	// http://www.w3.org/TR/REC-xml/#sec-white-space
+	preserve := enc.preserve
+	switch e.GetAttributeNS(XML_NAMESPACE, "space") {
+	case "preserve":
+		enc.preserve = true
+	case "default":
+		enc.preserve = false
+	}
+	defer func() { enc.preserve = preserve }()
+
+	name := e.NodeName()
+	enc.writeRaw("<" + name)
+	wrap := !preserve && enc.wrapAttributes(e, depth)
+	for i := range e.attribs {
+		a := e.attribs[i]
+		if wrap {
+			enc.newline(depth + 1)
+		} else {
+			enc.writeRaw(" ")
+		}
+		enc.writeRaw(a.qualifiedName() + "=")
+		enc.writeAttrValue(a.v)
+	}
+
+	indent, text, markup := false, hasTextChildren(e), hasMarkupChildren(e)
+	if enc.Indent != "" && !enc.preserve {
+		indent = !text || (markup && !enc.InlineMixed)
+	}
+	if !e.HasChildNodes() || (indent && !text && !markup) {
+		if enc.SelfClose {
+			enc.writeRaw("/>")
+		} else {
+			enc.writeRaw("></" + name + ">")
+		}
+		return
+	}
+	enc.writeRaw(">")
+	enc.writeChildren(e, depth, indent)
+	if indent {
+		enc.newline(depth)
+	}
+	enc.writeRaw("</" + name + ">")
+}
+
+// true if the start tag of e should be written with each attribute on its
+// own line
+func (enc *Encoder) wrapAttributes(e *Element, depth int) bool {
+	if enc.MaxWidth <= 0 || enc.Indent == "" || len(e.attribs) < 2 {
+		return false
+	}
+	width := depth*utf8.RuneCountInString(enc.Indent) + len("<>") + utf8.RuneCountInString(e.NodeName())
+	for i := range e.attribs {
+		a := e.attribs[i]
+		width += len(" =\"\"") + utf8.RuneCountInString(a.qualifiedName()) + utf8.RuneCountInString(a.v)
+	}
+	return width > enc.MaxWidth
+}
+
+func (enc *Encoder) writeChildren(n Node, depth int, indent bool) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if indent && c.NodeType() == TEXT_NODE {
+			// surrounding white space is replaced by the indentation
+			text := strings.TrimSpace(c.NodeValue())
+			if text != "" {
+				enc.newline(depth + 1)
+				enc.writeText(text)
+			}
+			continue
+		}
+		if indent {
+			enc.newline(depth + 1)
+		}
+		enc.writeNode(c, depth+1)
+	}
+}
+
+// true if e has children containing text other than white space
+func hasTextChildren(e *Element) bool {
+	for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c.NodeType() {
+		case CDATA_SECTION_NODE, ENTITY_REFERENCE_NODE:
+			return true
+		case TEXT_NODE:
+			if strings.TrimSpace(c.NodeValue()) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// true if e has children other than text
+func hasMarkupChildren(e *Element) bool {
+	for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+		if t := c.NodeType(); t != TEXT_NODE && t != CDATA_SECTION_NODE {
+			return true
+		}
+	}
+	return false
+}
+
+func toXml(n Node) []byte {
+	var b bytes.Buffer
+	newToXmlEncoder(&b).Encode(n)
+	return b.Bytes()
+}
+
+func toXmlIndent(n Node, indent string) []byte {
+	var b bytes.Buffer
+	enc := newToXmlEncoder(&b)
+	enc.Indent = indent
+	enc.InlineMixed = true
+	enc.Encode(n)
+	return b.Bytes()
+}
@@ -0,0 +1,292 @@
+package dom
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func encodeString(t *testing.T, enc *Encoder, b *bytes.Buffer, n Node) string {
+	b.Reset()
+	if err := enc.Encode(n); err != nil {
+		t.Fatalf("Error encoding node (%v).", err)
+	}
+	return b.String()
+}
+
+func TestEncoderDefaults(t *testing.T) {
+	d, _ := ParseStringXml(`<root a="x &amp; &quot;y&quot;"><empty/>caf&#233; &lt;3<!--c--></root>`)
+	var b bytes.Buffer
+	s := encodeString(t, NewEncoder(&b), &b, d)
+	if s != `<root a="x &amp; &quot;y&quot;"><empty></empty>café &lt;3<!--c--></root>` {
+		t.Errorf("Document encoded as %s", s)
+	}
+	b.Reset()
+	n, err := d.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) || b.String() != s {
+		t.Errorf("Document.WriteTo() wrote %d bytes (%v): %s", n, err, b.String())
+	}
+	b.Reset()
+	d.DocumentElement().FirstChild().WriteTo(&b)
+	if b.String() != "<empty></empty>" {
+		t.Errorf("Node.WriteTo() wrote %s", b.String())
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	d, _ := ParseStringXml(`<root><a q="it's"/><b>text</b><c><d/></c></root>`)
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	enc.XmlDeclaration = true
+	enc.Indent = "  "
+	enc.LineEnding = "\r\n"
+	enc.SelfClose = true
+	enc.QuoteChar = '\''
+	expected := "<?xml version=\"1.0\"?>\r\n<root>\r\n  <a q='it&apos;s'/>\r\n  <b>text</b>\r\n  <c>\r\n    <d/>\r\n  </c>\r\n</root>"
+	if s := encodeString(t, enc, &b, d); s != expected {
+		t.Errorf("Document encoded as %q", s)
+	}
+}
+
+func TestEncoderIndentKeepsText(t *testing.T) {
+	d, _ := ParseStringXml("<root>\n <p>mixed <b>content</b></p>\n</root>")
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	enc.Indent = "\t"
+	enc.InlineMixed = true
+	if s := encodeString(t, enc, &b, d); s != "<root>\n\t<p>mixed <b>content</b></p>\n</root>" {
+		t.Errorf("Document encoded as %q", s)
+	}
+}
+
+func TestEncoderEncodings(t *testing.T) {
+	d, _ := ParseStringXml(`<?xml version="1.0" encoding="UTF-8"?><r a="é">é€<![CDATA[€]]></r>`)
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	enc.Encoding = "ISO-8859-1"
+	if s := encodeString(t, enc, &b, d); s != "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><r a=\"\xe9\">\xe9&#8364;<![CDATA[]]>&#8364;<![CDATA[]]></r>" {
+		t.Errorf("Document encoded as %q", s)
+	}
+	enc.Encoding = "US-ASCII"
+	if s := encodeString(t, enc, &b, d); s != `<?xml version="1.0" encoding="US-ASCII"?><r a="&#233;">&#233;&#8364;<![CDATA[]]>&#8364;<![CDATA[]]></r>` {
+		t.Errorf("Document encoded as %q", s)
+	}
+	enc.Encoding = ""
+	if s := encodeString(t, enc, &b, d); s != `<?xml version="1.0" encoding="UTF-8"?><r a="é">é€<![CDATA[€]]></r>` {
+		t.Errorf("Document encoded as %q", s)
+	}
+
+	d, _ = ParseStringXml(`<café/>`)
+	enc.Encoding = "US-ASCII"
+	if err := enc.Encode(d); err == nil {
+		t.Errorf("Encoded a name that cannot be represented")
+	}
+	enc.Encoding = "EBCDIC"
+	if err := enc.Encode(d); err == nil {
+		t.Errorf("Encoded with an unsupported encoding")
+	}
+}
+
+type failingWriter struct{}
+
+func (w failingWriter) Write(p []byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestEncoderWriteError(t *testing.T) {
+	d, _ := ParseStringXml(`<r/>`)
+	if _, err := d.WriteTo(failingWriter{}); err == nil {
+		t.Errorf("Write error not returned")
+	}
+}
+
+func TestAttributeEscaping(t *testing.T) {
+	test_cases := []struct{ value, expected string }{
+		{`plain`, `<r a="plain"></r>`},
+		{`"quoted"`, `<r a="&quot;quoted&quot;"></r>`},
+		{`it's`, `<r a="it's"></r>`},
+		{`a & b < c > d`, `<r a="a &amp; b &lt; c &gt; d"></r>`},
+		{"tab\tnl\ncr\r", `<r a="tab&#9;nl&#10;cr&#13;"></r>`},
+		{"nul\x00bell\x07", `<r a="nul&#65533;bell&#65533;"></r>`},
+		{"￾", `<r a="&#65533;"></r>`},
+		{"é😀", `<r a="&#233;&#128512;"></r>`},
+	}
+	for _, tc := range test_cases {
+		d, _ := ParseStringXml(`<r/>`)
+		d.DocumentElement().SetAttribute("a", tc.value)
+		if s := string(d.ToXml()); s != tc.expected {
+			t.Errorf("Attribute %q serialized as %s instead of %s", tc.value, s, tc.expected)
+		}
+	}
+}
+
+// builds random strings from characters that are awkward to serialize
+func randomXmlStrings(count int) []string {
+	pool := []rune("aZ09 \t\n\r\"'&<>;#=/?]éÿĀ €퟿�\U0001f600\U0010ffff")
+	r := rand.New(rand.NewSource(1))
+	list := make([]string, count)
+	for i := range list {
+		s := make([]rune, r.Intn(20))
+		for j := range s {
+			s[j] = pool[r.Intn(len(pool))]
+		}
+		list[i] = string(s)
+	}
+	return list
+}
+
+func TestAttributeRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	encoders := []*Encoder{NewEncoder(&b), NewEncoder(&b), NewEncoder(&b)}
+	encoders[1].QuoteChar = '\''
+	encoders[2].Encoding = "US-ASCII"
+	for _, value := range randomXmlStrings(500) {
+		d, _ := ParseStringXml(`<r/>`)
+		d.DocumentElement().SetAttribute("a", value)
+		d.DocumentElement().AppendChild(d.CreateTextNode(value))
+
+		outputs := []string{string(d.ToXml())}
+		for _, enc := range encoders {
+			outputs = append(outputs, encodeString(t, enc, &b, d))
+		}
+		for _, s := range outputs {
+			d2, err := ParseStringXml(s)
+			if err != nil {
+				t.Errorf("Serialization of %q is not well-formed (%v): %s", value, err, s)
+				continue
+			}
+			r := d2.DocumentElement()
+			if r.GetAttribute("a") != value {
+				t.Errorf("Attribute %q read back as %q from %s", value, r.GetAttribute("a"), s)
+			}
+			if string(r.ToText(false)) != value {
+				t.Errorf("Text %q read back as %q from %s", value, r.ToText(false), s)
+			}
+		}
+	}
+}
+
+const prettyDoc = `<config><server host="localhost" port="8080"><name>main</name></server>` +
+	`<p>Some <b>bold</b> text</p><pre xml:space="preserve"><a> x </a><b/></pre><!--end--></config>`
+
+func TestEncoderIndentMixed(t *testing.T) {
+	d, _ := ParseStringXml(prettyDoc)
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	enc.Indent = "  "
+	expected := `<config>
+  <server host="localhost" port="8080">
+    <name>main</name>
+  </server>
+  <p>
+    Some
+    <b>bold</b>
+    text
+  </p>
+  <pre xml:space="preserve"><a> x </a><b></b></pre>
+  <!--end-->
+</config>`
+	if s := encodeString(t, enc, &b, d); s != expected {
+		t.Errorf("Document encoded as\n%s", s)
+	}
+
+	enc.InlineMixed = true
+	expected = `<config>
+  <server host="localhost" port="8080">
+    <name>main</name>
+  </server>
+  <p>Some <b>bold</b> text</p>
+  <pre xml:space="preserve"><a> x </a><b></b></pre>
+  <!--end-->
+</config>`
+	if s := encodeString(t, enc, &b, d); s != expected {
+		t.Errorf("Document encoded as\n%s", s)
+	}
+}
+
+func TestEncoderMaxWidth(t *testing.T) {
+	d, _ := ParseStringXml(prettyDoc)
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	enc.Indent = "  "
+	enc.MaxWidth = 30
+	enc.SelfClose = true
+	s := encodeString(t, enc, &b, d.DocumentElement().FirstChild())
+	expected := `<server
+  host="localhost"
+  port="8080">
+  <name>main</name>
+</server>`
+	if s != expected {
+		t.Errorf("Element encoded as\n%s", s)
+	}
+}
+
+func TestToXmlIndent(t *testing.T) {
+	d, _ := ParseStringXml("<r xml:space='preserve'><a>\n<b/></a><c xml:space='default'>\n<d/></c></r>")
+	expected := "<r xml:space=\"preserve\"><a>\n<b></b></a><c xml:space=\"default\">\n    <d></d>\n  </c></r>"
+	if s := string(d.ToXmlIndent("  ")); s != expected {
+		t.Errorf("Document.ToXmlIndent() returned\n%s", s)
+	}
+	c := d.DocumentElement().LastChild().(*Element)
+	if s := string(c.ToXmlIndent("\t")); s != "<c xml:space=\"default\">\n\t<d></d>\n</c>" {
+		t.Errorf("Element.ToXmlIndent() returned\n%s", s)
+	}
+	// the indentation is removed by reparsing and indenting again
+	d2, _ := ParseStringXml(string(c.ToXmlIndent("\t")))
+	if string(d2.ToXmlIndent("\t")) != string(c.ToXmlIndent("\t")) {
+		t.Errorf("Indentation is not stable")
+	}
+}
+
+func TestEncoderMarkupInData(t *testing.T) {
+	d, _ := ParseStringXml(`<r>x</r>`)
+	r := d.DocumentElement()
+	test_cases := []struct {
+		n   Node
+		out string
+	}{
+		{d.CreateComment("x--><evil/><!--"), `<r>x<!--x- -><evil/><!- - -->y</r>`},
+		{d.CreateComment("x-"), `<r>x<!--x- -->y</r>`},
+		{d.CreateComment("a---b"), `<r>x<!--a- - -b-->y</r>`},
+		{d.CreateProcessingInstruction("pi", "a?><evil/>"), `<r>x<?pi a? ><evil/>?>y</r>`},
+	}
+	y := d.CreateTextNode("y")
+	r.AppendChild(y)
+	for _, v := range test_cases {
+		r.InsertBefore(v.n, y)
+		// an Encoder fails rather than changing the data
+		var b bytes.Buffer
+		var e *EncoderError
+		if _, err := d.WriteTo(&b); !errors.As(err, &e) {
+			t.Errorf("Writing %q: %v", v.n.NodeValue(), err)
+		}
+		// ToXml cannot fail, so it keeps the markup well-formed
+		out := string(d.ToXml())
+		if out != v.out {
+			t.Errorf("ToXml with %q: expected %s, got %s", v.n.NodeValue(), v.out, out)
+		}
+		if p, err := ParseStringXml(out); err != nil {
+			t.Errorf("Error parsing the output for %q (%v).", v.n.NodeValue(), err)
+		} else if p.GetElementsByTagName("evil").Length() != 0 || p.DocumentElement().LastChild().NodeValue() != "y" {
+			t.Errorf("Markup injected through %q: %s", v.n.NodeValue(), out)
+		}
+		if out := string(d.ToXmlIndent("  ")); !strings.HasSuffix(out, "y</r>") {
+			t.Errorf("ToXmlIndent with %q: %s", v.n.NodeValue(), out)
+		}
+		r.RemoveChild(v.n)
+	}
+
+	if _, err := d.TryCreateComment("a--b"); exceptionCode(err) != INVALID_CHARACTER_ERR {
+		t.Errorf("CreateComment: %v", err)
+	}
+	if _, err := d.TryCreateComment("a-"); exceptionCode(err) != INVALID_CHARACTER_ERR {
+		t.Errorf("CreateComment: %v", err)
+	}
+	if _, err := d.TryCreateProcessingInstruction("pi", "a?>"); exceptionCode(err) != INVALID_CHARACTER_ERR {
+		t.Errorf("CreateProcessingInstruction: %v", err)
+	}
+	if c, err := d.TryCreateComment("- a - b -c"); err != nil || c.Data() != "- a - b -c" {
+		t.Errorf("CreateComment: %v", err)
+	}
+}
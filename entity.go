@@ -0,0 +1,57 @@
+package dom
+
+/*
+ * Entity and Notation implementation
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"io"
+)
+
+// An entity declared in the internal subset of the document type.  The
+// replacement text of an internal entity is held as a single text child.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-527DCFF2
+type Entity struct {
+	_node
+	publicId     string
+	systemId     string
+	notationName string
+}
+
+func (n *Entity) NodeType() uint           { return ENTITY_NODE }
+func (n *Entity) NodeName() string         { return n.n.Local }
+func (n *Entity) NodeValue() string        { return "" }
+func (n *Entity) PreviousSibling() Node    { return nil }
+func (n *Entity) NextSibling() Node        { return nil }
+func (n *Entity) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *Entity) CloneNode(deep bool) Node { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *Entity) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+
+func (n *Entity) PublicId() string     { return n.publicId }
+func (n *Entity) SystemId() string     { return n.systemId }
+func (n *Entity) NotationName() string { return n.notationName }
+
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-5431D1B9
+type Notation struct {
+	_node
+	publicId string
+	systemId string
+}
+
+func (n *Notation) NodeType() uint           { return NOTATION_NODE }
+func (n *Notation) NodeName() string         { return n.n.Local }
+func (n *Notation) NodeValue() string        { return "" }
+func (n *Notation) PreviousSibling() Node    { return nil }
+func (n *Notation) NextSibling() Node        { return nil }
+func (n *Notation) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *Notation) CloneNode(deep bool) Node { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *Notation) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+
+func (n *Notation) PublicId() string { return n.publicId }
+func (n *Notation) SystemId() string { return n.systemId }
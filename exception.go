@@ -0,0 +1,173 @@
+package dom
+
+/*
+ * DOMException and the checks made before changing the tree
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"strings"
+)
+
+// The codes of a DOMException.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-258A00AF
+const (
+	_              = iota // ignore first value
+	INDEX_SIZE_ERR = iota
+	DOMSTRING_SIZE_ERR
+	HIERARCHY_REQUEST_ERR
+	WRONG_DOCUMENT_ERR
+	INVALID_CHARACTER_ERR
+	NO_DATA_ALLOWED_ERR
+	NO_MODIFICATION_ALLOWED_ERR
+	NOT_FOUND_ERR
+	NOT_SUPPORTED_ERR
+	INUSE_ATTRIBUTE_ERR
+	INVALID_STATE_ERR
+	SYNTAX_ERR
+	INVALID_MODIFICATION_ERR
+	NAMESPACE_ERR
+	INVALID_ACCESS_ERR
+	VALIDATION_ERR
+	TYPE_MISMATCH_ERR
+)
+
+var exceptionNames = [...]string{
+	"", "INDEX_SIZE_ERR", "DOMSTRING_SIZE_ERR", "HIERARCHY_REQUEST_ERR",
+	"WRONG_DOCUMENT_ERR", "INVALID_CHARACTER_ERR", "NO_DATA_ALLOWED_ERR",
+	"NO_MODIFICATION_ALLOWED_ERR", "NOT_FOUND_ERR", "NOT_SUPPORTED_ERR",
+	"INUSE_ATTRIBUTE_ERR", "INVALID_STATE_ERR", "SYNTAX_ERR",
+	"INVALID_MODIFICATION_ERR", "NAMESPACE_ERR", "INVALID_ACCESS_ERR",
+	"VALIDATION_ERR", "TYPE_MISMATCH_ERR",
+}
+
+// A DOMException is returned by the checked variants of the methods that
+// change the tree, such as TryAppendChild, when the operation is not
+// allowed.  The unchecked methods leave the tree unchanged in that case,
+// and return nil instead of a node.
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-17189187
+type DOMException struct {
+	Code uint
+	Msg  string
+}
+
+func (e *DOMException) Error() string {
+	if e.Code < uint(len(exceptionNames)) {
+		return "dom: " + exceptionNames[e.Code] + ": " + e.Msg
+	}
+	return "dom: " + e.Msg
+}
+
+// ====================================
+
+// checks that c may be inserted as a child of p, in place of replaced when
+// that is not nil
+func checkChild(p, c, replaced Node) error {
+	if c == nil {
+		return &DOMException{HIERARCHY_REQUEST_ERR, "no node to insert"}
+	}
+	if pd, cd := ownerDocument(p), ownerDocument(c); pd != nil && cd != nil && pd != cd &&
+		c.NodeType() != DOCUMENT_NODE {
+		return &DOMException{WRONG_DOCUMENT_ERR, "node belongs to another document"}
+	}
+	for a := p; a != nil; a = a.ParentNode() {
+		if a == c {
+			return &DOMException{HIERARCHY_REQUEST_ERR, "node cannot be inserted into itself or its descendants"}
+		}
+	}
+
+	nodes := []Node{c}
+	if f, ok := c.(*DocumentFragment); ok {
+		nodes = nodes[:0]
+		for ch := f.first; ch != nil; ch = ch.NextSibling() {
+			nodes = append(nodes, ch)
+		}
+	}
+	for _, n := range nodes {
+		if !allowedChild(p.NodeType(), n.NodeType()) {
+			return &DOMException{HIERARCHY_REQUEST_ERR, strings.TrimPrefix(n.NodeName(), "#") + " cannot be a child of " + strings.TrimPrefix(p.NodeName(), "#")}
+		}
+	}
+
+	// a document has at most one root element and one document type
+	if d, ok := p.(*Document); ok {
+		count := map[uint]int{}
+		for _, n := range nodes {
+			count[n.NodeType()]++
+		}
+		for n := d.first; n != nil; n = n.NextSibling() {
+			if n != replaced && n != c {
+				count[n.NodeType()]++
+			}
+		}
+		if count[ELEMENT_NODE] > 1 {
+			return &DOMException{HIERARCHY_REQUEST_ERR, "document already has a root element"}
+		}
+		if count[DOCUMENT_TYPE_NODE] > 1 {
+			return &DOMException{HIERARCHY_REQUEST_ERR, "document already has a document type"}
+		}
+	}
+	return nil
+}
+
+// reports whether a node of type child may be a child of a node of type
+// parent
+func allowedChild(parent, child uint) bool {
+	switch parent {
+	case DOCUMENT_NODE:
+		switch child {
+		case ELEMENT_NODE, PROCESSING_INSTRUCTION_NODE, COMMENT_NODE, DOCUMENT_TYPE_NODE:
+			return true
+		}
+	case ELEMENT_NODE, DOCUMENT_FRAGMENT_NODE, ENTITY_NODE, ENTITY_REFERENCE_NODE:
+		switch child {
+		case ELEMENT_NODE, PROCESSING_INSTRUCTION_NODE, COMMENT_NODE, TEXT_NODE,
+			CDATA_SECTION_NODE, ENTITY_REFERENCE_NODE:
+			return true
+		}
+	case ATTRIBUTE_NODE:
+		return child == TEXT_NODE || child == ENTITY_REFERENCE_NODE
+	}
+	return false
+}
+
+// reports whether s matches the Name production of XML
+// http://www.w3.org/TR/REC-xml/#NT-Name
+func isXmlName(s string) bool {
+	for i, r := range s {
+		if !isNCNameStart(r) && r != ':' && (i == 0 || !isNCNameChar(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// checks a name for CreateElement and SetAttribute
+func checkName(name string) error {
+	if !isXmlName(name) {
+		return &DOMException{INVALID_CHARACTER_ERR, "invalid name " + name}
+	}
+	return nil
+}
+
+// checks a qualified name, and its prefix against the namespace
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-DocCrElNS
+func checkQualifiedName(namespaceURI, qualifiedName string) error {
+	if err := checkName(qualifiedName); err != nil {
+		return err
+	}
+	prefix, local := splitQualifiedName(qualifiedName)
+	if strings.Count(qualifiedName, ":") > 1 || local == "" || strings.HasPrefix(qualifiedName, ":") {
+		return &DOMException{NAMESPACE_ERR, "malformed qualified name " + qualifiedName}
+	}
+	switch {
+	case prefix != "" && namespaceURI == "":
+		return &DOMException{NAMESPACE_ERR, "prefix " + prefix + " without a namespace"}
+	case prefix == "xml" && namespaceURI != XML_NAMESPACE:
+		return &DOMException{NAMESPACE_ERR, "prefix xml bound to " + namespaceURI}
+	case (prefix == "xmlns" || qualifiedName == "xmlns") != (namespaceURI == XMLNS_NAMESPACE):
+		return &DOMException{NAMESPACE_ERR, "xmlns and " + XMLNS_NAMESPACE + " must be used together"}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package dom
+
+import (
+	"errors"
+	"testing"
+)
+
+func exceptionCode(err error) uint {
+	var e *DOMException
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
+func TestTreeExceptions(t *testing.T) {
+	d, _ := ParseStringXml(`<!DOCTYPE a><a><b><c/></b>text</a>`)
+	other, _ := ParseStringXml(`<x/>`)
+	a := d.DocumentElement()
+	b := a.FirstChild().(*Element)
+	c := b.FirstChild()
+	text := a.LastChild()
+
+	test_cases := []struct {
+		name string
+		f    func() (Node, error)
+		code uint
+	}{
+		{"append ancestor", func() (Node, error) { return c.TryAppendChild(a) }, HIERARCHY_REQUEST_ERR},
+		{"append self", func() (Node, error) { return b.TryAppendChild(b) }, HIERARCHY_REQUEST_ERR},
+		{"append parent", func() (Node, error) { return b.TryAppendChild(a) }, HIERARCHY_REQUEST_ERR},
+		{"append document", func() (Node, error) { return a.TryAppendChild(other) }, HIERARCHY_REQUEST_ERR},
+		{"second root", func() (Node, error) { return d.TryAppendChild(d.CreateElement("r")) }, HIERARCHY_REQUEST_ERR},
+		{"second doctype", func() (Node, error) { return d.TryAppendChild(d.Doctype().CloneNode(false)) }, HIERARCHY_REQUEST_ERR},
+		{"text in document", func() (Node, error) { return d.TryAppendChild(d.CreateTextNode("x")) }, HIERARCHY_REQUEST_ERR},
+		{"child of text", func() (Node, error) { return text.TryAppendChild(d.CreateElement("e")) }, HIERARCHY_REQUEST_ERR},
+		{"wrong document", func() (Node, error) { return a.TryAppendChild(other.CreateElement("e")) }, WRONG_DOCUMENT_ERR},
+		{"foreign ref", func() (Node, error) { return a.TryInsertBefore(d.CreateElement("e"), c) }, NOT_FOUND_ERR},
+		{"foreign old", func() (Node, error) { return a.TryReplaceChild(d.CreateElement("e"), c) }, NOT_FOUND_ERR},
+		{"remove grandchild", func() (Node, error) { return a.TryRemoveChild(c) }, NOT_FOUND_ERR},
+		{"remove nil", func() (Node, error) { return a.TryRemoveChild(nil) }, NOT_FOUND_ERR},
+		{"append nil", func() (Node, error) { return a.TryAppendChild(nil) }, HIERARCHY_REQUEST_ERR},
+		{"replace root with root", func() (Node, error) { return d.TryReplaceChild(d.CreateElement("r"), a) }, 0},
+	}
+	for _, v := range test_cases {
+		before := string(d.ToXml())
+		_, err := v.f()
+		if code := exceptionCode(err); code != v.code {
+			t.Errorf("%s: expected code %d, got %v", v.name, v.code, err)
+		}
+		if v.code != 0 && string(d.ToXml()) != before {
+			t.Errorf("%s: tree changed to %s", v.name, d.ToXml())
+		}
+	}
+	if d.DocumentElement().NodeName() != "r" {
+		t.Errorf("Root not replaced")
+	}
+
+	// the unchecked methods return nil and leave the tree alone
+	if n := c.AppendChild(b); n != nil || b.ParentNode() != a {
+		t.Errorf("AppendChild created a cycle")
+	}
+	if n := b.InsertBefore(d.CreateElement("e"), a); n != nil {
+		t.Errorf("InsertBefore with a foreign reference returned %v", n)
+	}
+	if n := b.RemoveChild(text); n != nil || text.ParentNode() != a {
+		t.Errorf("RemoveChild of a non-child returned %v", n)
+	}
+}
+
+func TestFragmentExceptions(t *testing.T) {
+	d, _ := ParseStringXml(`<a/>`)
+	f := d.CreateDocumentFragment()
+	f.AppendChild(d.CreateElement("x"))
+	f.AppendChild(d.CreateElement("y"))
+	if _, err := d.TryAppendChild(f); exceptionCode(err) != HIERARCHY_REQUEST_ERR {
+		t.Errorf("Fragment with elements appended to document: %v", err)
+	}
+	if f.ChildNodes().Length() != 2 {
+		t.Errorf("Fragment changed by a failed insertion")
+	}
+	if _, err := d.DocumentElement().TryAppendChild(f); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if f.ChildNodes().Length() != 0 || string(d.ToXml()) != "<a><x></x><y></y></a>" {
+		t.Errorf("Unexpected document: %s", d.ToXml())
+	}
+}
+
+func TestDataExceptions(t *testing.T) {
+	d, _ := ParseStringXml(`<a>hello</a>`)
+	text := d.DocumentElement().FirstChild().(*Text)
+	if _, err := text.TrySubstringData(6, 1); exceptionCode(err) != INDEX_SIZE_ERR {
+		t.Errorf("SubstringData past the end: %v", err)
+	}
+	if err := text.TryInsertData(6, "x"); exceptionCode(err) != INDEX_SIZE_ERR {
+		t.Errorf("InsertData past the end: %v", err)
+	}
+	if err := text.TryDeleteData(6, 1); exceptionCode(err) != INDEX_SIZE_ERR {
+		t.Errorf("DeleteData past the end: %v", err)
+	}
+	text.InsertData(10, "x")
+	text.InsertData(0, ">")
+	text.InsertData(6, "<")
+	text.ReplaceData(1, 1, "H")
+	text.DeleteData(6, 0xFFFFFFFF)
+	if s, err := text.TrySubstringData(1, 0xFFFFFFFF); err != nil || s != "Hello" || text.Data() != ">Hello" {
+		t.Errorf("Unexpected data %q (%v)", text.Data(), err)
+	}
+}
+
+func TestNameExceptions(t *testing.T) {
+	d, _ := ParseStringXml(`<a/>`)
+	test_cases := []struct {
+		ns, name string
+		code     uint
+	}{
+		{"", "a", 0},
+		{"urn:x", "x:a", 0},
+		{XML_NAMESPACE, "xml:lang", 0},
+		{XMLNS_NAMESPACE, "xmlns", 0},
+		{"", "1a", INVALID_CHARACTER_ERR},
+		{"", "a b", INVALID_CHARACTER_ERR},
+		{"", "", INVALID_CHARACTER_ERR},
+		{"", "x:a", NAMESPACE_ERR},
+		{"urn:x", "x:a:b", NAMESPACE_ERR},
+		{"urn:x", "xml:a", NAMESPACE_ERR},
+		{"urn:x", "xmlns:a", NAMESPACE_ERR},
+		{XMLNS_NAMESPACE, "a", NAMESPACE_ERR},
+	}
+	for _, v := range test_cases {
+		_, err := d.TryCreateElementNS(v.ns, v.name)
+		if code := exceptionCode(err); code != v.code {
+			t.Errorf("CreateElementNS(%q, %q): expected code %d, got %v", v.ns, v.name, v.code, err)
+		}
+		err = d.DocumentElement().TrySetAttributeNS(v.ns, v.name, "v")
+		if code := exceptionCode(err); code != v.code {
+			t.Errorf("SetAttributeNS(%q, %q): expected code %d, got %v", v.ns, v.name, v.code, err)
+		}
+	}
+	if _, err := d.TryCreateElement("a<"); exceptionCode(err) != INVALID_CHARACTER_ERR {
+		t.Errorf("CreateElement: %v", err)
+	}
+	if err := d.DocumentElement().TrySetAttribute("a=", "v"); exceptionCode(err) != INVALID_CHARACTER_ERR {
+		t.Errorf("SetAttribute: %v", err)
+	}
+	if _, err := d.TryCreateProcessingInstruction("XML", ""); exceptionCode(err) != INVALID_CHARACTER_ERR {
+		t.Errorf("CreateProcessingInstruction: %v", err)
+	}
+	if _, err := d.TryImportNode(d, true); exceptionCode(err) != NOT_SUPPORTED_ERR {
+		t.Errorf("ImportNode: %v", err)
+	}
+	if err := (&DOMException{NOT_FOUND_ERR, "x"}).Error(); err != "dom: NOT_FOUND_ERR: x" {
+		t.Errorf("Unexpected message %q", err)
+	}
+}
+
+func TestParseSecondRoot(t *testing.T) {
+	if _, err := ParseStringHtml(`<p>a</p><p>b</p>`); err == nil {
+		t.Errorf("Second root element accepted")
+	}
+}
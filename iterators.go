@@ -0,0 +1,119 @@
+package dom
+
+/*
+ * Iterators over the tree for range loops
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"iter"
+)
+
+// Iterates over the children of the node.  The child being visited may be
+// removed or moved during the loop.
+func (n *_node) Children() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		for c := n.first; c != nil; {
+			next := c.node().next
+			if !yield(c) {
+				return
+			}
+			c = next
+		}
+	}
+}
+
+// Iterates over the descendants of the node in document order, not
+// including the node itself.  The loop stops if the node being visited is
+// removed; use a NodeIterator to change the tree while visiting it.
+func (n *_node) Descendants() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		c := n.first
+		for c != nil {
+			if !yield(c) {
+				return
+			}
+			if first := c.node().first; first != nil {
+				c = first
+				continue
+			}
+			// the next sibling of c or of its closest ancestor that has one
+			for c != nil {
+				cn := c.node()
+				if cn.next != nil {
+					c = cn.next
+					break
+				}
+				if cn.p == nil || cn.p.node() == n {
+					return
+				}
+				c = cn.p
+			}
+		}
+	}
+}
+
+// Iterates over the ancestors of the node, starting with its parent and
+// ending with the root of the tree.
+func (n *_node) Ancestors() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		for c := n; c.isChild(); c = c.p.node() {
+			if !yield(c.p) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over the siblings after the node, starting with the next one.
+func (n *_node) FollowingSiblings() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		for s := n.next; s != nil; {
+			next := s.node().next
+			if !yield(s) {
+				return
+			}
+			s = next
+		}
+	}
+}
+
+// Iterates over the siblings before the node, starting with the previous
+// one.
+func (n *_node) PrecedingSiblings() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		for s := n.prev; s != nil; {
+			prev := s.node().prev
+			if !yield(s) {
+				return
+			}
+			s = prev
+		}
+	}
+}
+
+// Iterates over the descendant elements with the given tag name in
+// document order, like GetElementsByTagName.  The name "*" matches all
+// elements.
+func (n *_node) Elements(name string) iter.Seq[*Element] {
+	return func(yield func(*Element) bool) {
+		for c := range n.Descendants() {
+			if e, ok := c.(*Element); ok && (name == "*" || e.NodeName() == name) {
+				if !yield(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// reports whether the node is linked as a child of its parent, which is
+// not the case for attributes and the nodes from the Create methods
+func (n *_node) isChild() bool {
+	if n.p == nil {
+		return false
+	}
+	first := n.p.node().first
+	return n.prev != nil || first != nil && first.node() == n
+}
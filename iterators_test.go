@@ -0,0 +1,89 @@
+package dom
+
+import (
+	"iter"
+	"testing"
+)
+
+// the names of the nodes in seq
+func names[N Node](seq iter.Seq[N]) string {
+	s := ""
+	for n := range seq {
+		s += n.NodeName() + " "
+	}
+	return s
+}
+
+func TestIterators(t *testing.T) {
+	d, _ := ParseStringXml(`<a x="1"><b><c/>text<d/></b><!--comment--><e><f/><b/></e></a>`)
+	a := d.DocumentElement()
+	b := a.FirstChild()
+	c := b.FirstChild()
+	f := a.LastChild().FirstChild()
+	test_cases := []struct {
+		seq      iter.Seq[Node]
+		expected string
+	}{
+		{a.Children(), "b #comment e "},
+		{c.Children(), ""},
+		{d.Descendants(), "a b c #text d #comment e f b "},
+		{b.Descendants(), "c #text d "},
+		{f.Descendants(), ""},
+		{f.Ancestors(), "e a #document "},
+		{d.Ancestors(), ""},
+		{b.FollowingSiblings(), "#comment e "},
+		{a.LastChild().PrecedingSiblings(), "#comment b "},
+		{c.PrecedingSiblings(), ""},
+		// nodes that are not children have no ancestors or siblings
+		{d.CreateElement("x").Ancestors(), ""},
+		{a.GetAttributeNode("x").Ancestors(), ""},
+	}
+	for i, v := range test_cases {
+		if s := names(v.seq); s != v.expected {
+			t.Errorf("Case %d: expected %q, got %q", i, v.expected, s)
+		}
+	}
+	if s := names(d.Elements("b")); s != "b b " {
+		t.Errorf("Elements(b) returned %q", s)
+	}
+	if s := names(b.Elements("*")); s != "c d " {
+		t.Errorf("Elements(*) returned %q", s)
+	}
+
+	// breaking out of the loop
+	count := 0
+	for n := range d.Descendants() {
+		count++
+		if n.NodeName() == "c" {
+			break
+		}
+	}
+	if count != 3 {
+		t.Errorf("Loop did not stop at c, visited %d nodes", count)
+	}
+
+	// removing the child being visited
+	for n := range b.Children() {
+		b.RemoveChild(n)
+	}
+	if b.HasChildNodes() {
+		t.Errorf("Children not all removed")
+	}
+}
+
+func TestIteratorsDoNotAllocatePerNode(t *testing.T) {
+	for _, n := range []int{10, 1000} {
+		r := wideElement(n)
+		allocs := testing.AllocsPerRun(10, func() {
+			for range r.Descendants() {
+			}
+			for range r.Elements("c") {
+			}
+			for range r.FirstChild().FollowingSiblings() {
+			}
+		})
+		if allocs > 4 {
+			t.Errorf("Iterating over %d nodes allocated %v times", n, allocs)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package dom
+
+/*
+ * Resource limits for parsing untrusted input
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"strconv"
+)
+
+// The limits used by a Parser when its fields are zero.
+const (
+	DEFAULT_MAX_DEPTH            = 256
+	DEFAULT_MAX_NODES            = 1000000
+	DEFAULT_MAX_ATTRIBUTES       = 256
+	DEFAULT_MAX_TEXT_SIZE        = 10 << 20
+	DEFAULT_MAX_ENTITY_EXPANSION = 1 << 20
+)
+
+// A LimitError is returned when the input exceeds one of the limits of the
+// Parser.
+type LimitError struct {
+	Limit string   // the name of the Parser field, such as "MaxDepth"
+	Max   int      // the value of the limit
+	Pos   Position // where the limit was exceeded, if known
+}
+
+func (e *LimitError) Error() string {
+	msg := e.Limit + " of " + strconv.Itoa(e.Max) + " exceeded"
+	if e.Pos.IsValid() {
+		msg = e.Pos.String() + ": " + msg
+	}
+	return "dom: " + msg
+}
+
+// The limits in effect for a parse, where zero means no limit.
+type _limits struct {
+	depth, nodes, attributes, text, expansion int
+}
+
+func (p *Parser) limits() _limits {
+	limit := func(v, def int) int {
+		switch {
+		case v == 0:
+			return def
+		case v < 0:
+			return 0
+		}
+		return v
+	}
+	return _limits{
+		depth:      limit(p.MaxDepth, DEFAULT_MAX_DEPTH),
+		nodes:      limit(p.MaxNodes, DEFAULT_MAX_NODES),
+		attributes: limit(p.MaxAttributes, DEFAULT_MAX_ATTRIBUTES),
+		text:       limit(p.MaxTextSize, DEFAULT_MAX_TEXT_SIZE),
+		expansion:  limit(p.MaxEntityExpansion, DEFAULT_MAX_ENTITY_EXPANSION),
+	}
+}
+
+// counts a node created by the parser against MaxNodes
+func (p *_decoder) addNode() error {
+	p.nodes++
+	if max := p.limits.nodes; max > 0 && p.nodes > max {
+		return &LimitError{Limit: "MaxNodes", Max: max, Pos: p.position()}
+	}
+	return nil
+}
+
+// checks the size of text, a comment or a processing instruction against
+// MaxTextSize, after entities were replaced
+func (p *_decoder) checkText(text []byte) error {
+	if max := p.limits.text; max > 0 && len(text) > max {
+		return &LimitError{Limit: "MaxTextSize", Max: max, Pos: p.position()}
+	}
+	return nil
+}
+
+// ====================================
+
+// Limits on the input seen by the xml.Decoder, which are checked as it
+// reads, before it builds a token.
+type _inputLimits struct {
+	token     int            // the bytes in a token, bounded by MaxTextSize
+	expansion int            // MaxEntityExpansion
+	entities  map[string]int // the size of the entities from the DTD
+	expanded  int            // the bytes of entity references so far
+	ref       []byte         // the name of the entity reference being read
+	inRef     bool
+}
+
+func isNameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' ||
+		b == '_' || b == '-' || b == '.' || b == ':' || b >= 0x80
+}
+
+// checks a byte read by the decoder.  buffered is the size of the current
+// token so far.
+func (l *_inputLimits) check(b byte, buffered int) error {
+	// the decoder reads one byte past the end of text to find its end
+	if l.token > 0 && buffered > l.token+1 {
+		return &LimitError{Limit: "MaxTextSize", Max: l.token}
+	}
+	if l.entities == nil {
+		return nil
+	}
+	// references to entities from the DTD are counted as they are read, as
+	// the decoder replaces them while building the token
+	if l.inRef {
+		switch {
+		case b == ';':
+			l.inRef = false
+			l.expanded += l.entities[string(l.ref)]
+			if l.expansion > 0 && l.expanded > l.expansion {
+				return &LimitError{Limit: "MaxEntityExpansion", Max: l.expansion}
+			}
+		case isNameByte(b) && len(l.ref) < 256:
+			l.ref = append(l.ref, b)
+		default:
+			l.inRef = false
+		}
+	}
+	if b == '&' {
+		l.inRef, l.ref = true, l.ref[:0]
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package dom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const billionLaughs = `<?xml version="1.0"?>
+<!DOCTYPE lolz [
+  <!ENTITY lol "lol">
+  <!ENTITY lol1 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+  <!ENTITY lol2 "&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;">
+  <!ENTITY lol3 "&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;">
+  <!ENTITY lol4 "&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;">
+  <!ENTITY lol5 "&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;">
+  <!ENTITY lol6 "&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;">
+  <!ENTITY lol7 "&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;">
+  <!ENTITY lol8 "&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;">
+  <!ENTITY lol9 "&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;">
+]>
+<lolz>&lol9;</lolz>`
+
+// a document with one large entity referenced many times, which grows
+// quadratically without nesting entities
+func quadraticBlowup() string {
+	value := strings.Repeat("x", 50000)
+	refs := strings.Repeat("&a;", 50000)
+	return `<!DOCTYPE d [<!ENTITY a "` + value + `">]><d>` + refs + `</d>`
+}
+
+func nested(depth int) string {
+	return strings.Repeat("<a>", depth) + strings.Repeat("</a>", depth)
+}
+
+func limitError(err error) string {
+	var le *LimitError
+	if errors.As(err, &le) {
+		return le.Limit
+	}
+	return ""
+}
+
+func TestLimits(t *testing.T) {
+	test_cases := []struct {
+		p     Parser
+		in    string
+		limit string
+	}{
+		{Parser{Strict: true}, billionLaughs, "MaxEntityExpansion"},
+		{Parser{}, billionLaughs, "MaxEntityExpansion"},
+		{Parser{Strict: true}, quadraticBlowup(), "MaxEntityExpansion"},
+		{Parser{Strict: true}, nested(DEFAULT_MAX_DEPTH), ""},
+		{Parser{Strict: true}, nested(10000), "MaxDepth"},
+		{Parser{}, nested(10000), "MaxDepth"},
+		{Parser{Strict: true, MaxDepth: -1}, nested(10000), ""},
+		{Parser{Strict: true, MaxDepth: 3}, "<a><b><c><d/></c></b></a>", "MaxDepth"},
+		{Parser{Strict: true, MaxNodes: 3}, "<a><b/><c/><d/></a>", "MaxNodes"},
+		{Parser{Strict: true, MaxAttributes: 2}, `<a x="1" y="2"/>`, ""},
+		{Parser{Strict: true, MaxAttributes: 2}, `<a x="1" y="2" z="3"/>`, "MaxAttributes"},
+		{Parser{Strict: true}, "<a" + strings.Repeat(` a="1"`, 300) + "/>", "MaxAttributes"},
+		{Parser{Strict: true, MaxTextSize: 8}, "<a>12345678</a>", ""},
+		{Parser{Strict: true, MaxTextSize: 8}, "<a>123456789</a>", "MaxTextSize"},
+		{Parser{Strict: true, MaxTextSize: 8}, "<a><!-- 123456789 --></a>", "MaxTextSize"},
+		{Parser{Strict: true, MaxTextSize: 8}, "<a><?pi 123456789?></a>", "MaxTextSize"},
+		{Parser{Strict: true, MaxTextSize: 16}, "<a" + strings.Repeat(" ", 100) + "/>", "MaxTextSize"},
+		{Parser{Strict: true, MaxTextSize: 16}, "<a>" + strings.Repeat("x", 100000), "MaxTextSize"},
+		{Parser{Strict: true, MaxEntityExpansion: 100}, `<!DOCTYPE d [<!ENTITY e "0123456789">]><d>` + strings.Repeat("&e;", 10) + `</d>`, ""},
+		{Parser{Strict: true, MaxEntityExpansion: 100}, `<!DOCTYPE d [<!ENTITY e "0123456789">]><d>` + strings.Repeat("&e;", 11) + `</d>`, "MaxEntityExpansion"},
+		{Parser{Strict: true, MaxEntityExpansion: 100}, `<!DOCTYPE d [<!ENTITY e "0123456789">]><d a="` + strings.Repeat("&e;", 11) + `"/>`, "MaxEntityExpansion"},
+		{Parser{Strict: true}, `<!DOCTYPE d [<!ENTITY e "` + strings.Repeat("x", 1000) + `">]><d>` + strings.Repeat("&e;", 2000) + `</d>`, "MaxEntityExpansion"},
+		{Parser{Strict: true, MaxEntityExpansion: -1}, `<!DOCTYPE d [<!ENTITY e "` + strings.Repeat("x", 1000) + `">]><d>` + strings.Repeat("&e;", 2000) + `</d>`, ""},
+	}
+	for i, v := range test_cases {
+		start := time.Now()
+		_, err := v.p.ParseString(v.in)
+		if limit := limitError(err); limit != v.limit || v.limit == "" && err != nil {
+			t.Errorf("Test case %d: expected limit %q, got %v", i, v.limit, err)
+		}
+		if d := time.Since(start); v.limit != "" && d > 5*time.Second {
+			t.Errorf("Test case %d: took %v to fail", i, d)
+		}
+	}
+}
+
+func TestLimitErrorPosition(t *testing.T) {
+	_, err := (&Parser{Strict: true, MaxDepth: 2}).ParseString("<a>\n <b>\n  <c/></b></a>")
+	if err == nil || err.Error() != "dom: 3:3: MaxDepth of 2 exceeded" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	_, err = (&Parser{Strict: true, MaxTextSize: 4}).ParseString("<a>\n<b>xxxxxxxxxx</b></a>")
+	var le *LimitError
+	if !errors.As(err, &le) || le.Pos.Line != 2 {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLimitsFragment(t *testing.T) {
+	p := &Parser{Strict: true, MaxNodes: 2}
+	if _, err := p.ParseFragment(nil, strings.NewReader("<a/><b/>")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := p.ParseFragment(nil, strings.NewReader("<a/><b/><c/>")); limitError(err) != "MaxNodes" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -17,14 +17,136 @@ func (m *_attrnamednodemap) Length() uint {
 }
 func (m *_attrnamednodemap) Item(index uint) Node {
 	if index >= 0 && index < m.Length() {
-		item := m.e.attribs[int(index)]
-		return newAttr(item.name, item.value)
+		return m.e.attribs[int(index)]
 	}
 	return Node(nil)
 }
 
+func (m *_attrnamednodemap) GetNamedItem(name string) Node {
+	if a := m.e.attribute(name); a != nil {
+		return a
+	}
+	return nil
+}
+
+func (m *_attrnamednodemap) GetNamedItemNS(namespaceURI, localName string) Node {
+	if a := m.e.attributeNS(namespaceURI, localName); a != nil {
+		return a
+	}
+	return nil
+}
+
+func (m *_attrnamednodemap) SetNamedItem(n Node) Node {
+	n, _ = m.TrySetNamedItem(n)
+	return n
+}
+
+func (m *_attrnamednodemap) SetNamedItemNS(n Node) Node {
+	n, _ = m.TrySetNamedItemNS(n)
+	return n
+}
+
+func (m *_attrnamednodemap) RemoveNamedItem(name string) Node {
+	n, _ := m.TryRemoveNamedItem(name)
+	return n
+}
+
+func (m *_attrnamednodemap) RemoveNamedItemNS(namespaceURI, localName string) Node {
+	n, _ := m.TryRemoveNamedItemNS(namespaceURI, localName)
+	return n
+}
+
+func (m *_attrnamednodemap) TrySetNamedItem(n Node) (Node, error) {
+	return attrResult(m.e.setAttributeNode(n, false))
+}
+
+func (m *_attrnamednodemap) TrySetNamedItemNS(n Node) (Node, error) {
+	return attrResult(m.e.setAttributeNode(n, true))
+}
+
+func (m *_attrnamednodemap) TryRemoveNamedItem(name string) (Node, error) {
+	for i := range m.e.attribs {
+		if m.e.attribs[i].qualifiedName() == name {
+			return m.e.removeAttr(i), nil
+		}
+	}
+	return nil, &DOMException{NOT_FOUND_ERR, "no attribute " + name}
+}
+
+func (m *_attrnamednodemap) TryRemoveNamedItemNS(namespaceURI, localName string) (Node, error) {
+	for i := range m.e.attribs {
+		if a := m.e.attribs[i]; a.n.Space == namespaceURI && a.n.Local == localName {
+			return m.e.removeAttr(i), nil
+		}
+	}
+	return nil, &DOMException{NOT_FOUND_ERR, "no attribute " + localName + " in namespace " + namespaceURI}
+}
+
+// converts the result of setAttributeNode, so that a nil Attr gives a nil
+// Node
+func attrResult(a Attr, err error) (Node, error) {
+	if a == nil {
+		return nil, err
+	}
+	return a, err
+}
+
 func newAttrNamedNodeMap(e *Element) *_attrnamednodemap {
 	nm := new(_attrnamednodemap)
 	nm.e = e
 	return nm
 }
+
+// used to return the entities and notations of a document type, which are
+// read-only
+type _nodenamednodemap struct {
+	nodes []Node
+}
+
+func (m *_nodenamednodemap) Length() uint {
+	return uint(len(m.nodes))
+}
+func (m *_nodenamednodemap) Item(index uint) Node {
+	if index < m.Length() {
+		return m.nodes[int(index)]
+	}
+	return Node(nil)
+}
+
+func (m *_nodenamednodemap) GetNamedItem(name string) Node {
+	for _, n := range m.nodes {
+		if n.NodeName() == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// entities and notations do not have a namespace
+func (m *_nodenamednodemap) GetNamedItemNS(namespaceURI, localName string) Node {
+	if namespaceURI != "" {
+		return nil
+	}
+	return m.GetNamedItem(localName)
+}
+
+func (m *_nodenamednodemap) SetNamedItem(n Node) Node                              { return nil }
+func (m *_nodenamednodemap) SetNamedItemNS(n Node) Node                            { return nil }
+func (m *_nodenamednodemap) RemoveNamedItem(name string) Node                      { return nil }
+func (m *_nodenamednodemap) RemoveNamedItemNS(namespaceURI, localName string) Node { return nil }
+
+func (m *_nodenamednodemap) TrySetNamedItem(n Node) (Node, error) {
+	return nil, &DOMException{NO_MODIFICATION_ALLOWED_ERR, "map is read-only"}
+}
+
+func (m *_nodenamednodemap) TrySetNamedItemNS(n Node) (Node, error) {
+	return m.TrySetNamedItem(n)
+}
+
+func (m *_nodenamednodemap) TryRemoveNamedItem(name string) (Node, error) {
+	return m.TrySetNamedItem(nil)
+}
+
+func (m *_nodenamednodemap) TryRemoveNamedItemNS(namespaceURI, localName string) (Node, error) {
+	return m.TrySetNamedItem(nil)
+}
@@ -0,0 +1,142 @@
+package dom
+
+import (
+	"testing"
+)
+
+func TestAttributeIdentity(t *testing.T) {
+	d, _ := ParseStringXml(`<a x="1" xmlns:p="urn:p" p:y="2"/>`)
+	e := d.DocumentElement()
+	m := e.Attributes()
+	if m.Item(0) != m.Item(0) || e.Attributes().Item(0) != m.Item(0) {
+		t.Errorf("Attributes have no identity")
+	}
+	x := e.GetAttributeNode("x")
+	if x == nil || x != m.GetNamedItem("x") || x.OwnerElement() != e || x.OwnerDocument() != d {
+		t.Fatalf("Unexpected attribute node %v", x)
+	}
+	if x.ParentNode() != nil {
+		t.Errorf("Attribute has a parent")
+	}
+
+	// writes go both ways
+	x.SetValue("one")
+	if e.GetAttribute("x") != "one" || string(e.ToXml()) != `<a x="one" xmlns:p="urn:p" p:y="2"></a>` {
+		t.Errorf("Change to Attr not seen by the element: %s", e.ToXml())
+	}
+	e.SetAttribute("x", "uno")
+	if x.Value() != "uno" || x.NodeValue() != "uno" {
+		t.Errorf("Change to the element not seen by Attr: %s", x.Value())
+	}
+
+	y := m.GetNamedItemNS("urn:p", "y")
+	if y == nil || y.NodeName() != "p:y" || y != e.GetAttributeNodeNS("urn:p", "y") {
+		t.Errorf("GetNamedItemNS returned %v", y)
+	}
+	if m.GetNamedItem("y") != nil || m.GetNamedItemNS("", "x") != x {
+		t.Errorf("Lookup by name confused with lookup by namespace")
+	}
+
+	// removed attributes keep their value and document, but not their owner
+	e.RemoveAttribute("x")
+	if x.OwnerElement() != nil || x.OwnerDocument() != d || x.Value() != "uno" || m.Length() != 2 {
+		t.Errorf("Removed attribute still owned")
+	}
+}
+
+func TestSetNamedItem(t *testing.T) {
+	d, _ := ParseStringXml(`<a x="1"><b/></a>`)
+	a := d.DocumentElement()
+	b := a.FirstChild().(*Element)
+	m := a.Attributes()
+	old := a.GetAttributeNode("x")
+
+	x := d.CreateAttribute("x")
+	x.SetValue("2")
+	if r := m.SetNamedItem(x); r != old || old.OwnerElement() != nil || x.OwnerElement() != a {
+		t.Errorf("SetNamedItem returned %v", r)
+	}
+	if a.GetAttribute("x") != "2" || m.Length() != 1 {
+		t.Errorf("Attribute not replaced: %s", a.ToXml())
+	}
+	if r := m.SetNamedItem(x); r != x {
+		t.Errorf("Setting an attribute again returned %v", r)
+	}
+
+	// an attribute can only belong to one element
+	if _, err := b.TrySetAttributeNode(x); exceptionCode(err) != INUSE_ATTRIBUTE_ERR {
+		t.Errorf("Attribute of another element: %v", err)
+	}
+	other, _ := ParseStringXml(`<o/>`)
+	if _, err := m.TrySetNamedItem(other.CreateAttribute("z")); exceptionCode(err) != WRONG_DOCUMENT_ERR {
+		t.Errorf("Attribute of another document: %v", err)
+	}
+	if _, err := m.TrySetNamedItem(b); exceptionCode(err) != HIERARCHY_REQUEST_ERR {
+		t.Errorf("Element set as an attribute: %v", err)
+	}
+	if r := b.SetAttributeNode(d.ImportNode(other.CreateAttribute("z"), false).(Attr)); r != nil || !b.HasAttribute("z") {
+		t.Errorf("Imported attribute not set")
+	}
+
+	// the NS variant matches on the namespace and local name
+	p := d.CreateAttributeNS("urn:p", "p:y")
+	q := d.CreateAttributeNS("urn:p", "q:y")
+	a.SetAttributeNodeNS(p)
+	if r := a.SetAttributeNodeNS(q); r != p || a.GetAttributeNodeNS("urn:p", "y") != q {
+		t.Errorf("SetAttributeNodeNS returned %v", r)
+	}
+	if r := m.SetNamedItem(p); r != nil || m.Length() != 3 {
+		t.Errorf("SetNamedItem replaced %v", r)
+	}
+
+	// removal
+	if r := m.RemoveNamedItemNS("urn:p", "y"); r != q || m.Length() != 2 {
+		t.Errorf("RemoveNamedItemNS returned %v", r)
+	}
+	if r := m.RemoveNamedItem("p:y"); r != p || q.OwnerElement() != nil {
+		t.Errorf("RemoveNamedItem returned %v", r)
+	}
+	if _, err := m.TryRemoveNamedItem("p:y"); exceptionCode(err) != NOT_FOUND_ERR {
+		t.Errorf("Removing a missing attribute: %v", err)
+	}
+	if r := a.RemoveAttributeNode(x); r != x || a.HasAttribute("x") || m.Length() != 0 {
+		t.Errorf("RemoveAttributeNode returned %v", r)
+	}
+	if _, err := a.TryRemoveAttributeNode(x); exceptionCode(err) != NOT_FOUND_ERR {
+		t.Errorf("Removing a removed attribute: %v", err)
+	}
+
+	// adopting an attribute takes it from its element
+	z := b.GetAttributeNode("z")
+	if other.AdoptNode(z); b.HasAttribute("z") || z.OwnerDocument() != other {
+		t.Errorf("Adopted attribute still owned")
+	}
+}
+
+func TestCloneAttributes(t *testing.T) {
+	d, _ := ParseStringXml(`<a x="1"/>`)
+	a := d.DocumentElement()
+	c := a.CloneNode(false).(*Element)
+	if c.GetAttributeNode("x") == a.GetAttributeNode("x") || c.GetAttributeNode("x").OwnerElement() != c {
+		t.Errorf("Attributes shared by the clone")
+	}
+	c.SetAttribute("x", "2")
+	if a.GetAttribute("x") != "1" {
+		t.Errorf("Change to the clone seen by the original")
+	}
+	x := a.GetAttributeNode("x").CloneNode(false).(Attr)
+	if x.OwnerElement() != nil || x.OwnerDocument() != d || x.Value() != "1" {
+		t.Errorf("Unexpected clone of an attribute")
+	}
+}
+
+func TestEntityMap(t *testing.T) {
+	d, _ := ParseStringXml(`<!DOCTYPE a [<!ENTITY e "x">]><a/>`)
+	m := d.Doctype().Entities()
+	if m.GetNamedItem("e") == nil || m.GetNamedItemNS("", "e") == nil || m.GetNamedItem("f") != nil {
+		t.Errorf("GetNamedItem failed on entities")
+	}
+	if _, err := m.TryRemoveNamedItem("e"); exceptionCode(err) != NO_MODIFICATION_ALLOWED_ERR {
+		t.Errorf("Entities not read-only: %v", err)
+	}
+}
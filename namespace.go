@@ -0,0 +1,224 @@
+package dom
+
+/*
+ * XML Namespaces support
+ * http://www.w3.org/TR/xml-names/
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+func qualifiedName(prefix, local string) string {
+	if prefix != "" {
+		return prefix + ":" + local
+	}
+	return local
+}
+
+// splits a qualified name into its prefix and local part
+func splitQualifiedName(qname string) (prefix, local string) {
+	if i := strings.Index(qname, ":"); i > 0 {
+		return qname[:i], qname[i+1:]
+	}
+	return "", qname
+}
+
+// A _nsScope holds the namespace declarations made on a single element
+// while parsing.  The scopes are chained to form the in-scope namespaces
+// of the element currently being built.
+type _nsScope struct {
+	parent *_nsScope
+	decls  []struct{ prefix, uri string }
+}
+
+func (s *_nsScope) push(attrs []xml.Attr) *_nsScope {
+	ns := &_nsScope{parent: s}
+	for _, a := range attrs {
+		if a.Name.Space == "xmlns" {
+			ns.declare(a.Name.Local, a.Value)
+		} else if a.Name.Space == "" && a.Name.Local == "xmlns" {
+			ns.declare("", a.Value)
+		}
+	}
+	return ns
+}
+
+func (s *_nsScope) declare(prefix, uri string) {
+	s.decls = append(s.decls, struct{ prefix, uri string }{prefix, uri})
+}
+
+// returns the namespace URI bound to prefix, if any
+func (s *_nsScope) lookupURI(prefix string) (string, bool) {
+	switch prefix {
+	case "xml":
+		return XML_NAMESPACE, true
+	case "xmlns":
+		return XMLNS_NAMESPACE, true
+	}
+	for ; s != nil; s = s.parent {
+		for i := len(s.decls) - 1; i >= 0; i-- {
+			if s.decls[i].prefix == prefix {
+				return s.decls[i].uri, true
+			}
+		}
+	}
+	return "", false
+}
+
+// returns a prefix currently bound to uri.  The default namespace is
+// only considered when allowDefault is set, since it never applies to
+// attributes.
+func (s *_nsScope) lookupPrefix(uri string, allowDefault bool) (string, bool) {
+	switch uri {
+	case XML_NAMESPACE:
+		return "xml", true
+	case XMLNS_NAMESPACE:
+		return "xmlns", true
+	}
+	if allowDefault {
+		if v, ok := s.lookupURI(""); ok && v == uri {
+			return "", true
+		}
+	}
+	for sc := s; sc != nil; sc = sc.parent {
+		for i := len(sc.decls) - 1; i >= 0; i-- {
+			d := sc.decls[i]
+			if d.prefix == "" || d.uri != uri {
+				continue
+			}
+			// make sure that the prefix has not been rebound by an inner scope
+			if v, _ := s.lookupURI(d.prefix); v == uri {
+				return d.prefix, true
+			}
+		}
+	}
+	return "", false
+}
+
+// resolves a name returned by the xml.Decoder into its namespace URI,
+// prefix and local name.  The decoder has already replaced the prefix with
+// the namespace URI, so the prefix is taken from qname, the name as it was
+// written, or else recovered from the declarations in scope.  An unbound
+// prefix is left by the decoder in the Space field.
+func (s *_nsScope) resolve(name xml.Name, qname string, isElement bool) (n xml.Name, prefix string, ok bool) {
+	switch {
+	case name.Space == "xmlns":
+		return xml.Name{Space: XMLNS_NAMESPACE, Local: name.Local}, "xmlns", true
+	case name.Space == "" && name.Local == "xmlns" && !isElement:
+		return xml.Name{Space: XMLNS_NAMESPACE, Local: name.Local}, "", true
+	case name.Space == "":
+		return name, "", true
+	}
+	if prefix, local := splitQualifiedName(qname); local == name.Local && (prefix != "" || isElement) {
+		if uri, ok := s.lookupURI(prefix); ok && uri == name.Space {
+			return name, prefix, true
+		}
+	}
+	if prefix, ok := s.lookupPrefix(name.Space, isElement); ok {
+		return name, prefix, true
+	}
+	// not bound, so the space holds the original prefix
+	return xml.Name{Space: "", Local: qualifiedName(name.Space, name.Local)}, "", false
+}
+
+// Returns the namespace URI bound to prefix at the given node, walking up
+// through the ancestors of the node.  The empty prefix looks up the
+// default namespace.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Node3-lookupNamespaceURI
+func lookupNamespaceURI(n Node, prefix string) (string, bool) {
+	switch prefix {
+	case "xml":
+		return XML_NAMESPACE, true
+	case "xmlns":
+		return XMLNS_NAMESPACE, true
+	}
+	for ; n != nil; n = n.ParentNode() {
+		e, ok := n.(*Element)
+		if !ok {
+			continue
+		}
+		if e.n.Space != "" && e.pfx == prefix {
+			return e.n.Space, true
+		}
+		for i := range e.attribs {
+			a := e.attribs[i]
+			if a.n.Space != XMLNS_NAMESPACE {
+				continue
+			}
+			if (prefix == "" && a.pfx == "" && a.n.Local == "xmlns") ||
+				(prefix != "" && a.pfx == "xmlns" && a.n.Local == prefix) {
+				return a.v, a.v != ""
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns the namespace declarations in scope at the given node, as a map
+// from prefix to namespace URI.  The default namespace uses the empty
+// prefix.  The xml prefix, which is always bound, is not included.
+func inScopeNamespaces(n Node) map[string]string {
+	nss := map[string]string{}
+	add := func(prefix, uri string) {
+		if _, ok := nss[prefix]; !ok && prefix != "xml" && prefix != "xmlns" {
+			nss[prefix] = uri
+		}
+	}
+	for ; n != nil; n = n.ParentNode() {
+		e, ok := n.(*Element)
+		if !ok {
+			continue
+		}
+		if e.n.Space != "" {
+			add(e.pfx, e.n.Space)
+		}
+		for i := range e.attribs {
+			a := e.attribs[i]
+			switch {
+			case a.n.Space == XMLNS_NAMESPACE && a.pfx == "xmlns":
+				add(a.n.Local, a.v)
+			case a.n.Space == XMLNS_NAMESPACE:
+				add("", a.v)
+			case a.n.Space != "" && a.pfx != "":
+				add(a.pfx, a.n.Space)
+			}
+		}
+	}
+	// an empty default namespace is the same as no declaration
+	if nss[""] == "" {
+		delete(nss, "")
+	}
+	return nss
+}
+
+// Returns a prefix bound to uri at the given node.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Node3-lookupNamespacePrefix
+func lookupPrefix(n Node, uri string) (string, bool) {
+	if uri == "" {
+		return "", false
+	}
+	for p := n; p != nil; p = p.ParentNode() {
+		e, ok := p.(*Element)
+		if !ok {
+			continue
+		}
+		if e.n.Space == uri && e.pfx != "" {
+			if v, _ := lookupNamespaceURI(n, e.pfx); v == uri {
+				return e.pfx, true
+			}
+		}
+		for i := range e.attribs {
+			a := e.attribs[i]
+			if a.n.Space == XMLNS_NAMESPACE && a.pfx == "xmlns" && a.v == uri {
+				if v, _ := lookupNamespaceURI(n, a.n.Local); v == uri {
+					return a.n.Local, true
+				}
+			}
+		}
+	}
+	return "", false
+}
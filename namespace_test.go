@@ -0,0 +1,211 @@
+package dom
+
+import (
+	"strings"
+	"testing"
+)
+
+const soapEnvelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns="urn:default"><soap:Body soap:mustUnderstand="1"><item id="a" xml:lang="en"></item><x:item xmlns:x="urn:x" x:id="b"></x:item></soap:Body></soap:Envelope>`
+
+func TestNamespaceElementNames(t *testing.T) {
+	d, err := ParseStringXml(soapEnvelope)
+	if err != nil {
+		t.Fatalf("Error parsing namespaced document (%v).", err)
+	}
+	r := d.DocumentElement()
+	if r.NodeName() != "soap:Envelope" || r.TagName() != "soap:Envelope" {
+		t.Errorf("Element.nodeName did not include the prefix (got %s)", r.NodeName())
+	}
+	if r.NamespaceURI() != "http://schemas.xmlsoap.org/soap/envelope/" ||
+		r.Prefix() != "soap" || r.LocalName() != "Envelope" {
+		t.Errorf("Element namespace attributes not set correctly")
+	}
+
+	item := r.FirstChild().FirstChild()
+	if item.NodeName() != "item" || item.NamespaceURI() != "urn:default" || item.Prefix() != "" {
+		t.Errorf("Element in default namespace not resolved correctly")
+	}
+	xitem := item.NextSibling()
+	if xitem.NodeName() != "x:item" || xitem.NamespaceURI() != "urn:x" || xitem.LocalName() != "item" {
+		t.Errorf("Element with locally declared prefix not resolved correctly")
+	}
+}
+
+func TestNamespaceAttributes(t *testing.T) {
+	d, _ := ParseStringXml(soapEnvelope)
+	r := d.DocumentElement()
+	body := r.FirstChild().(*Element)
+	item := body.FirstChild().(*Element)
+	xitem := item.NextSibling().(*Element)
+
+	if body.GetAttributeNS("http://schemas.xmlsoap.org/soap/envelope/", "mustUnderstand") != "1" ||
+		body.GetAttribute("soap:mustUnderstand") != "1" {
+		t.Errorf("Element.GetAttributeNS() did not find a prefixed attribute")
+	}
+	if item.GetAttributeNS("", "id") != "a" || item.GetAttributeNS("urn:default", "id") != "" {
+		t.Errorf("Unprefixed attributes should not be in the default namespace")
+	}
+	if item.GetAttributeNS(XML_NAMESPACE, "lang") != "en" {
+		t.Errorf("xml:lang not bound to the XML namespace")
+	}
+	if !xitem.HasAttributeNS("urn:x", "id") || xitem.HasAttributeNS("", "id") {
+		t.Errorf("Element.HasAttributeNS() not implemented correctly")
+	}
+	if r.GetAttributeNS(XMLNS_NAMESPACE, "soap") != "http://schemas.xmlsoap.org/soap/envelope/" ||
+		r.GetAttributeNS(XMLNS_NAMESPACE, "xmlns") != "urn:default" {
+		t.Errorf("Namespace declarations not available as attributes")
+	}
+
+	a := body.Attributes().Item(0)
+	if a.NodeName() != "soap:mustUnderstand" || a.Prefix() != "soap" || a.LocalName() != "mustUnderstand" {
+		t.Errorf("Attr namespace attributes not set correctly (got %s)", a.NodeName())
+	}
+}
+
+func TestNamespaceSetRemoveAttributeNS(t *testing.T) {
+	d, _ := ParseStringXml(`<root/>`)
+	r := d.DocumentElement()
+	r.SetAttributeNS("urn:a", "a:foo", "1")
+	r.SetAttributeNS("urn:b", "b:foo", "2")
+	if r.GetAttributeNS("urn:a", "foo") != "1" || r.GetAttributeNS("urn:b", "foo") != "2" {
+		t.Errorf("Element.SetAttributeNS() did not set the attributes")
+	}
+	r.SetAttributeNS("urn:a", "c:foo", "3")
+	if r.Attributes().Length() != 2 || r.GetAttribute("c:foo") != "3" {
+		t.Errorf("Element.SetAttributeNS() did not replace the existing attribute")
+	}
+	r.RemoveAttributeNS("urn:a", "foo")
+	if r.HasAttributeNS("urn:a", "foo") || !r.HasAttributeNS("urn:b", "foo") {
+		t.Errorf("Element.RemoveAttributeNS() did not remove the attribute")
+	}
+}
+
+func TestNamespacePrefixRebinding(t *testing.T) {
+	d, err := ParseStringXml(`<p:a xmlns:p="urn:1"><p:b xmlns:p="urn:2"/><p:c/></p:a>`)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	r := d.DocumentElement()
+	b := r.FirstChild()
+	c := b.NextSibling()
+	if b.NamespaceURI() != "urn:2" || c.NamespaceURI() != "urn:1" ||
+		b.Prefix() != "p" || c.Prefix() != "p" {
+		t.Errorf("Rebound prefix was not resolved in scope")
+	}
+	if b.(*Element).LookupNamespaceURI("p") != "urn:2" || c.(*Element).LookupNamespaceURI("p") != "urn:1" {
+		t.Errorf("Element.LookupNamespaceURI() did not respect scoping")
+	}
+	if c.(*Element).LookupPrefix("urn:2") != "" || b.(*Element).LookupPrefix("urn:2") != "p" {
+		t.Errorf("Element.LookupPrefix() did not respect scoping")
+	}
+}
+
+func TestNamespaceUnboundPrefix(t *testing.T) {
+	if _, err := ParseStringXml(`<p:a/>`); err == nil {
+		t.Errorf("Unbound prefix accepted in strict mode")
+	}
+	d, err := ParseStringHtml(`<p:a></p:a>`)
+	if err != nil {
+		t.Fatalf("Unbound prefix rejected in non-strict mode (%v)", err)
+	}
+	if d.DocumentElement().NodeName() != "p:a" || d.DocumentElement().NamespaceURI() != "" {
+		t.Errorf("Unbound prefix not kept as part of the name")
+	}
+}
+
+func TestNamespaceSharedURI(t *testing.T) {
+	// the prefixes are kept as written when several are bound to a URI
+	test_cases := []struct {
+		in, names string
+	}{
+		{`<b:x xmlns:a="u" xmlns:b="u"><b:y></b:y><a:y a:z="1" b:w="2"></a:y></b:x>`, "b:x b:y a:y"},
+		{`<p:x xmlns="u" xmlns:p="u"><y p:z="1"></y></p:x>`, "p:x y"},
+		{`<x xmlns="u" xmlns:p="u"><p:y></p:y></x>`, "x p:y"},
+	}
+	for _, v := range test_cases {
+		d, err := ParseStringXml(v.in)
+		if err != nil {
+			t.Errorf("Error parsing %s (%v).", v.in, err)
+			continue
+		}
+		if out := string(d.ToXml()); out != v.in {
+			t.Errorf("Expected %s, got %s", v.in, out)
+		}
+		names := ""
+		for e := range d.Descendants() {
+			if e.NodeType() == ELEMENT_NODE {
+				names += " " + e.NodeName()
+			}
+		}
+		if names = names[1:]; names != v.names {
+			t.Errorf("Expected the elements %s in %s, got %s", v.names, v.in, names)
+		}
+	}
+	d, _ := ParseStringXml(`<b:x xmlns:a="u" xmlns:b="u" a:z="1"/>`)
+	if a := d.DocumentElement().Attributes().GetNamedItem("a:z"); a == nil || a.Prefix() != "a" {
+		t.Errorf("Attribute prefix not kept")
+	}
+	if n, err := MustCompileXPath("name(/*)").Evaluate(d); err != nil || n.String() != "b:x" {
+		t.Errorf("XPath name() of the root: %v (%v)", n, err)
+	}
+}
+
+func TestNamespaceDuplicateAttributes(t *testing.T) {
+	for _, in := range []string{
+		"<r>\n  <x xmlns:a=\"u\" xmlns:b=\"u\" a:y=\"1\" b:y=\"2\"/></r>",
+		"<r>\n  <x y=\"1\" y=\"2\"/></r>",
+	} {
+		_, err := ParseStringXml(in)
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Parsing %q returned %v", in, err)
+		} else if se.Pos.String() != "2:3" || !strings.Contains(se.Msg, "y") {
+			t.Errorf("Parsing %q: error %q at %v", in, se.Msg, se.Pos)
+		}
+	}
+	// the same local name in different namespaces is fine
+	if _, err := ParseStringXml(`<x xmlns:a="u" xmlns:b="v" a:y="1" b:y="2" y="3"/>`); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// the last one wins in non-strict mode
+	d, err := ParseStringHtml(`<x y="1" y="2"></x>`)
+	if err != nil || d.DocumentElement().GetAttribute("y") != "2" {
+		t.Errorf("Duplicate attribute in non-strict mode: %v", err)
+	}
+}
+
+func TestNamespaceGetElementsByTagNameNS(t *testing.T) {
+	d, _ := ParseStringXml(soapEnvelope)
+	if l := d.GetElementsByTagNameNS("urn:default", "item").Length(); l != 1 {
+		t.Errorf("GetElementsByTagNameNS() returned %d elements instead of 1", l)
+	}
+	if l := d.GetElementsByTagNameNS("*", "item").Length(); l != 2 {
+		t.Errorf("GetElementsByTagNameNS() returned %d elements instead of 2", l)
+	}
+	if l := d.GetElementsByTagNameNS("http://schemas.xmlsoap.org/soap/envelope/", "*").Length(); l != 2 {
+		t.Errorf("GetElementsByTagNameNS() returned %d elements instead of 2", l)
+	}
+	if l := d.DocumentElement().GetElementsByTagName("x:item").Length(); l != 1 {
+		t.Errorf("GetElementsByTagName() did not match the qualified name")
+	}
+}
+
+func TestNamespaceCreateElementNS(t *testing.T) {
+	d, _ := ParseStringXml(`<root xmlns:svg="http://www.w3.org/2000/svg"/>`)
+	e := d.CreateElementNS("http://www.w3.org/2000/svg", "svg:rect")
+	if e.NodeName() != "svg:rect" || e.LocalName() != "rect" || e.Prefix() != "svg" ||
+		e.NamespaceURI() != "http://www.w3.org/2000/svg" {
+		t.Errorf("Document.CreateElementNS() did not set the names correctly")
+	}
+	d.DocumentElement().AppendChild(e)
+	if string(d.ToXml()) != `<root xmlns:svg="http://www.w3.org/2000/svg"><svg:rect></svg:rect></root>` {
+		t.Errorf("Namespaced element not serialized correctly (got %s)", d.ToXml())
+	}
+}
+
+func TestNamespaceToXml(t *testing.T) {
+	d, _ := ParseStringXml(soapEnvelope)
+	if string(d.ToXml()) != soapEnvelope {
+		t.Errorf("Namespaced document not rebuilt (got %s)", d.ToXml())
+	}
+}
@@ -14,45 +14,217 @@ package dom
 
 import (
 	"encoding/xml"
+	"io"
+	"strings"
+	"sync/atomic"
 )
 
 type _node struct {
-	p Node     // parent
-	c []Node   // children
-	n xml.Name // name
+	p           Node     // parent
+	first, last Node     // children
+	prev, next  Node     // siblings
+	count       int      // number of children
+	n           xml.Name // name (namespace URI and local name)
+	pfx         string   // namespace prefix
+	pos         Position // where the parser found the node
+	// the child last returned by ChildNodes().Item, and the index of this
+	// node among its siblings when it is one.  Reading a tree from several
+	// goroutines is safe as long as none of them changes it, so Item
+	// updates them atomically.
+	cursor atomic.Pointer[_node]
+	index  atomic.Int64
 }
 
 // internal methods used so that our workhorses can do the real work
+func (n *_node) node() *_node {
+	return n
+}
 func (n *_node) setParent(p Node) {
 	n.p = p
 }
-func (n *_node) insertChildAt(c Node, i uint) {
-	n.c = append(n.c[:int(i)], append([]Node{c}, n.c[int(i):]...)...)
+
+// links c into the children before ref, or at the end when ref is nil
+func (n *_node) insertChildBefore(c Node, ref Node) {
+	cn := c.node()
+	cn.next = ref
+	if ref == nil {
+		cn.prev = n.last
+		n.last = c
+	} else {
+		rn := ref.node()
+		cn.prev = rn.prev
+		rn.prev = c
+	}
+	if cn.prev == nil {
+		n.first = c
+	} else {
+		cn.prev.node().next = c
+	}
+	n.count++
+	n.cursor.Store(nil)
 }
+
+// unlinks c from the children, if it is one
 func (n *_node) removeChild(c Node) {
-	for i := len(n.c); i > 0; i-- {
-		if n.c[i-1] == c {
-			n.c = append(n.c[:i-1], n.c[i:]...)
-			break
+	if !n.hasChild(c) {
+		return
+	}
+	if d := ownerDocument(c); d != nil && d.watched() {
+		d.removing(c)
+	}
+	cn := c.node()
+	if cn.prev == nil {
+		n.first = cn.next
+	} else {
+		cn.prev.node().next = cn.next
+	}
+	if cn.next == nil {
+		n.last = cn.prev
+	} else {
+		cn.next.node().prev = cn.prev
+	}
+	cn.prev, cn.next = nil, nil
+	n.count--
+	n.cursor.Store(nil)
+}
+
+// reports whether c is linked into the children.  The nodes from the
+// Create methods have their owner as parent without being one of its
+// children.
+func (n *_node) hasChild(c Node) bool {
+	if c == nil {
+		return false
+	}
+	cn := c.node()
+	return cn.p != nil && cn.p.node() == n && (cn.prev != nil || n.first == c)
+}
+
+// returns the child at index i, walking from the closest of the first, the
+// last and the previously returned child
+func (n *_node) child(i int) Node {
+	if i < 0 || i >= n.count {
+		return nil
+	}
+	c, at := n.first, 0
+	if n.count-1-i < i {
+		c, at = n.last, n.count-1
+	}
+	if cn := n.cursor.Load(); cn != nil {
+		if ci := int(cn.index.Load()); abs(ci-i) < abs(at-i) {
+			// the cursor is a child, but only its _node is kept
+			c, at = n.first, ci
+			if cn.prev != nil {
+				c = cn.prev.node().next
+			}
 		}
 	}
+	steps := abs(at - i)
+	for ; at < i; at++ {
+		c = c.node().next
+	}
+	for ; at > i; at-- {
+		c = c.node().prev
+	}
+	if steps >= cursorSteps {
+		// moving the cursor on every call would cost more than the walk
+		cn := c.node()
+		cn.index.Store(int64(i))
+		n.cursor.Store(cn)
+	}
+	return c
+}
+
+// the length of walk after which child moves the cursor
+const cursorSteps = 4
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
 }
 
 func (n *_node) NodeType() uint           { panic("Node.NodeType() not implemented") }
 func (n *_node) NodeName() string         { panic("Node.NodeName() not implemented") }
 func (n *_node) NodeValue() string        { panic("Node.NodeValue() not implemented") }
+func (n *_node) CloneNode(deep bool) Node { panic("Node.CloneNode() not implemented") }
+func (n *_node) WriteTo(w io.Writer) (int64, error) {
+	panic("Node.WriteTo() not implemented")
+}
 func (n *_node) TagName() string          { return n.NodeName() }
-func (n *_node) AppendChild(c Node) Node  { return appendChild(n, c) }
-func (n *_node) RemoveChild(c Node) Node  { return removeChild(n, c) }
+func (n *_node) AppendChild(c Node) Node  { c, _ = n.TryAppendChild(c); return c }
+func (n *_node) RemoveChild(c Node) Node  { c, _ = n.TryRemoveChild(c); return c }
 func (n *_node) ChildNodes() NodeList     { return newChildNodelist(n) }
 func (n *_node) ParentNode() Node         { return n.p }
 func (n *_node) Attributes() NamedNodeMap { return NamedNodeMap(nil) }
-func (n *_node) HasChildNodes() (b bool) {
-	b = false
-	if len(n.c) > 0 {
-		b = true
+func (n *_node) NamespaceURI() string     { return n.n.Space }
+func (n *_node) Prefix() string           { return n.pfx }
+func (n *_node) LocalName() string        { return n.n.Local }
+func (n *_node) Position() Position       { return n.pos }
+func (n *_node) HasChildNodes() bool      { return n.first != nil }
+
+// The text content of a node with children is the text content of its
+// children, except for comments and processing instructions.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Node3-textContent
+func (n *_node) TextContent() string {
+	var b strings.Builder
+	for c := n.first; c != nil; c = c.NextSibling() {
+		switch c.NodeType() {
+		case COMMENT_NODE, PROCESSING_INSTRUCTION_NODE:
+		default:
+			b.WriteString(c.TextContent())
+		}
+	}
+	return b.String()
+}
+
+// The nodes whose content can be set override SetTextContent, so that it
+// does nothing for the others, such as document types and entities.
+func (n *_node) SetTextContent(text string) {}
+
+// replaces the children of p with a single text node, or none when text
+// is empty
+func setTextContent(p Node, text string) {
+	for c := p.FirstChild(); c != nil; c = p.FirstChild() {
+		removeChild(p, c)
+	}
+	if text != "" {
+		insertChild(p, newText(xml.CharData(text)), nil)
 	}
-	return
+}
+
+// Merges adjacent text nodes and removes empty ones, in the whole subtree.
+// CDATA sections are left as they are.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-normalize
+func (n *_node) Normalize() {
+	for c := n.first; c != nil; {
+		next := c.NextSibling()
+		if t, ok := c.(*Text); ok {
+			for next != nil {
+				nt, ok := next.(*Text)
+				if !ok {
+					break
+				}
+				textMerged(t, nt, t.Length())
+				t.AppendData(nt.Data())
+				next = nt.NextSibling()
+				n.removeChild(nt)
+				nt.setParent(nil)
+			}
+			if len(t.content) == 0 {
+				n.removeChild(t)
+				t.setParent(nil)
+			}
+		} else {
+			c.Normalize()
+		}
+		c = next
+	}
+}
+
+// the qualified name is the prefix and the local name joined by a colon
+func (n *_node) qualifiedName() string {
+	return qualifiedName(n.pfx, n.n.Local)
 }
 
 // has to be package-scoped because of
@@ -66,6 +238,28 @@ func ownerDocument(n Node) *Document {
 	return nil
 }
 
+// the document of a node that is not itself a document
+func (n *_node) document() *Document {
+	if n.p == nil {
+		return nil
+	}
+	return ownerDocument(n.p)
+}
+
+// the node that embeds n, found through its siblings or its parent, or nil
+// when n is not a child
+func (n *_node) self() Node {
+	if n.prev != nil {
+		return n.prev.node().next
+	}
+	if n.p != nil {
+		if first := n.p.node().first; first != nil && first.node() == n {
+			return first
+		}
+	}
+	return nil
+}
+
 //func (n *_node) OwnerDocument(n Node) (d Document) {
 //d = nil;
 //p := n.p;
@@ -80,72 +274,37 @@ func ownerDocument(n Node) *Document {
 //}
 
 func (p *_node) InsertBefore(newChild Node, refChild Node) Node {
-	if refChild == nil {
-		// if refChild is null, insert newChild at the end of the list of children.
-		return appendChild(p, newChild)
-	} else if refChild == newChild {
-		// inserting a node before itself is implementation dependent
-		return newChild
-	}
-	// if newChild is already in the tree somewhere,
-	// remove it before reparenting
-	if newChild.ParentNode() != nil {
-		removeChild(newChild.ParentNode(), newChild)
-	}
-	// find refChild & insert
-	nl := p.ChildNodes()
-	i := nl.Length()
-	for cix := uint(0); cix < i; cix++ {
-		if nl.Item(cix) == refChild {
-			p.insertChildAt(newChild, cix)
-			newChild.setParent(p)
-			return newChild
-		}
-	}
-
-	// Specification appears to be silent on the matter if refChild is not a child of parent
-	return nil
+	newChild, _ = p.TryInsertBefore(newChild, refChild)
+	return newChild
 }
 
 func (p *_node) ReplaceChild(nc Node, rc Node) Node {
-	p.InsertBefore(nc, rc)
-	return p.RemoveChild(rc)
-}
-func (p *_node) FirstChild() Node {
-	if len(p.c) > 0 {
-		return p.c[0]
-	}
-	return nil
-}
-func (p *_node) LastChild() Node {
-	if len(p.c) > 0 {
-		return p.c[len(p.c)-1]
-	}
-	return nil
+	rc, _ = p.TryReplaceChild(nc, rc)
+	return rc
 }
 
-func previousSibling(self Node, children NodeList) Node {
-	for i := children.Length() - 1; i > 0; i-- {
-		if children.Item(i) == self {
-			return children.Item(i - 1)
-		}
-	}
-	return Node(nil)
+// The nodes that can have children override the checked methods, so that
+// only nodes without children, or whose children are read-only, use these.
+func (p *_node) TryAppendChild(c Node) (Node, error) {
+	return nil, &DOMException{HIERARCHY_REQUEST_ERR, "node cannot have children"}
 }
 
-func nextSibling(self Node, children NodeList) Node {
-	for i := uint(0); i < children.Length()-1; i++ {
-		if children.Item(i) == self {
-			return children.Item(i + 1)
-		}
-	}
-	return Node(nil)
+func (p *_node) TryInsertBefore(newChild Node, refChild Node) (Node, error) {
+	return p.TryAppendChild(newChild)
 }
 
-func (n *_node) PreviousSibling() Node {
-	return previousSibling(Node(n), n.p.ChildNodes())
+func (p *_node) TryReplaceChild(nc Node, rc Node) (Node, error) {
+	return p.TryRemoveChild(rc)
 }
 
-func (n *_node) NextSibling() Node {
-	return nextSibling(Node(n), n.p.ChildNodes())
+func (p *_node) TryRemoveChild(c Node) (Node, error) {
+	if p.hasChild(c) {
+		return nil, &DOMException{NO_MODIFICATION_ALLOWED_ERR, "children are read-only"}
+	}
+	return nil, &DOMException{NOT_FOUND_ERR, "node is not a child"}
 }
+
+func (p *_node) FirstChild() Node      { return p.first }
+func (p *_node) LastChild() Node       { return p.last }
+func (n *_node) PreviousSibling() Node { return n.prev }
+func (n *_node) NextSibling() Node     { return n.next }
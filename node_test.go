@@ -0,0 +1,290 @@
+package dom
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// checks that the sibling links, the child list and the parents agree
+func checkChildren(t *testing.T, p Node, names string) {
+	s := ""
+	var prev Node
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.PreviousSibling() != prev {
+			t.Errorf("Previous sibling of %s is %v", c.NodeName(), c.PreviousSibling())
+		}
+		if c.ParentNode() != p {
+			t.Errorf("Parent of %s is %v", c.NodeName(), c.ParentNode())
+		}
+		s += c.NodeName()
+		prev = c
+	}
+	if p.LastChild() != prev {
+		t.Errorf("Last child is %v", p.LastChild())
+	}
+	if s != names {
+		t.Errorf("Expected children %q, got %q", names, s)
+	}
+	children := p.ChildNodes()
+	if children.Length() != uint(len(names)) {
+		t.Errorf("Expected %d children, got %d", len(names), children.Length())
+	}
+	// in order, in reverse, and jumping around
+	for i := uint(0); i < children.Length(); i++ {
+		if children.Item(i).NodeName() != names[i:i+1] {
+			t.Errorf("Item(%d) is %s", i, children.Item(i).NodeName())
+		}
+	}
+	for i := children.Length(); i > 0; i-- {
+		if children.Item(i-1).NodeName() != names[i-1:i] {
+			t.Errorf("Item(%d) is %s", i-1, children.Item(i-1).NodeName())
+		}
+	}
+	for _, i := range []uint{2, 0, 4, 1, 3} {
+		if i < children.Length() && children.Item(i).NodeName() != names[i:i+1] {
+			t.Errorf("Item(%d) is %s", i, children.Item(i).NodeName())
+		}
+	}
+	if children.Item(children.Length()) != nil {
+		t.Errorf("Item past the end is not nil")
+	}
+}
+
+func TestSiblingLinks(t *testing.T) {
+	d, _ := ParseStringXml(`<r><a/><b/><c/></r>`)
+	r := d.DocumentElement()
+	checkChildren(t, r, "abc")
+	a, b, c := r.FirstChild(), r.FirstChild().NextSibling(), r.LastChild()
+
+	children := r.ChildNodes()
+	children.Item(2)
+	r.InsertBefore(d.CreateElement("d"), b)
+	checkChildren(t, r, "adbc")
+	r.AppendChild(a)
+	checkChildren(t, r, "dbca")
+	r.RemoveChild(b)
+	checkChildren(t, r, "dca")
+	if b.ParentNode() != nil || b.PreviousSibling() != nil || b.NextSibling() != nil {
+		t.Errorf("Removed node still linked")
+	}
+	r.ReplaceChild(b, c)
+	checkChildren(t, r, "dba")
+	r.InsertBefore(c, nil)
+	checkChildren(t, r, "dbac")
+
+	// moving a node between parents unlinks it from the first
+	b.AppendChild(a)
+	checkChildren(t, r, "dbc")
+	checkChildren(t, b, "a")
+
+	f := d.CreateDocumentFragment()
+	f.AppendChild(d.CreateElement("x"))
+	f.AppendChild(d.CreateElement("y"))
+	r.InsertBefore(f, c)
+	checkChildren(t, r, "dbxyc")
+	checkChildren(t, f, "")
+
+	for r.FirstChild() != nil {
+		r.RemoveChild(r.LastChild())
+	}
+	checkChildren(t, r, "")
+	if r.HasChildNodes() {
+		t.Errorf("HasChildNodes after removing all children")
+	}
+	// a node from the Create methods is not a child of its owner
+	e := d.CreateElement("e")
+	if n := d.RemoveChild(e); n != nil {
+		t.Errorf("RemoveChild of a created node returned %v", n)
+	}
+}
+
+func TestTextContent(t *testing.T) {
+	d, _ := ParseStringXml(`<!DOCTYPE r [<!ENTITY e "ent">]><r>a<!--c--><b>b<![CDATA[<c>]]></b><?pi data?>d</r>`)
+	r := d.DocumentElement()
+	b := r.FirstChild().NextSibling().NextSibling().(*Element)
+	pi := b.NextSibling()
+	test_cases := []struct {
+		n        Node
+		expected string
+	}{
+		{r, "ab<c>d"},
+		{b, "b<c>"},
+		{b.LastChild(), "<c>"},
+		{r.FirstChild().NextSibling(), "c"},
+		{pi, "data"},
+		{d, ""},
+		{d.Doctype(), ""},
+		{d.Doctype().Entities().GetNamedItem("e"), "ent"},
+	}
+	for _, v := range test_cases {
+		if s := v.n.TextContent(); s != v.expected {
+			t.Errorf("TextContent of %s is %q, expected %q", v.n.NodeName(), s, v.expected)
+		}
+	}
+
+	// setting replaces all children by a single text node
+	r.SetTextContent("x<y")
+	if r.FirstChild() == nil || r.FirstChild() != r.LastChild() || r.FirstChild().NodeType() != TEXT_NODE {
+		t.Fatalf("Children not replaced by a text node")
+	}
+	if string(r.ToXml()) != `<r>x&lt;y</r>` || b.ParentNode() != nil {
+		t.Errorf("Unexpected content after SetTextContent: %s", r.ToXml())
+	}
+	r.SetTextContent("")
+	if r.HasChildNodes() {
+		t.Errorf("Empty text content left a child")
+	}
+
+	f := d.CreateDocumentFragment()
+	f.AppendChild(d.CreateElement("x"))
+	f.SetTextContent("f")
+	if f.TextContent() != "f" || f.FirstChild().NodeType() != TEXT_NODE {
+		t.Errorf("SetTextContent failed on a fragment")
+	}
+	pi.SetTextContent("other")
+	if pi.NodeValue() != "other" {
+		t.Errorf("SetTextContent failed on a processing instruction")
+	}
+	c := d.CreateComment("c")
+	c.SetTextContent("changed")
+	if c.NodeValue() != "changed" {
+		t.Errorf("SetTextContent failed on a comment")
+	}
+	a := d.CreateAttribute("a")
+	a.SetTextContent("v")
+	if a.Value() != "v" || a.TextContent() != "v" {
+		t.Errorf("SetTextContent failed on an attribute")
+	}
+	// read-only and null nodes are unchanged
+	d.SetTextContent("doc")
+	d.Doctype().Entities().GetNamedItem("e").SetTextContent("x")
+	if d.DocumentElement() != r || d.Doctype().Entities().GetNamedItem("e").TextContent() != "ent" {
+		t.Errorf("SetTextContent changed a document or an entity")
+	}
+}
+
+// The tree can be read from several goroutines at once, which go test
+// -race checks.  Walking the children in different orders moves the
+// cursor that Item keeps in the parent.
+func TestConcurrentReads(t *testing.T) {
+	r := wideElement(1000)
+	r.AppendChild(r.OwnerDocument().CreateTextNode("t"))
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			children := r.ChildNodes()
+			for j := uint(0); j < children.Length(); j++ {
+				i := (j*uint(g+1)*37 + uint(g)) % children.Length()
+				if c := children.Item(i); c == nil || (c.NodeName() == "c") != (i < 1000) {
+					errs <- "Item(" + strconv.Itoa(int(i)) + ") returned the wrong node"
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// builds an element with n children
+func wideElement(n int) *Element {
+	d, _ := ParseStringXml(`<r/>`)
+	r := d.DocumentElement()
+	for i := 0; i < n; i++ {
+		r.AppendChild(d.CreateElement("c"))
+	}
+	return r
+}
+
+var benchmarkWidths = []int{1000, 10000, 100000}
+
+func BenchmarkNextSibling(b *testing.B) {
+	for _, n := range benchmarkWidths {
+		r := wideElement(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for c := r.FirstChild(); c != nil; c = c.NextSibling() {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPreviousSibling(b *testing.B) {
+	for _, n := range benchmarkWidths {
+		r := wideElement(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for c := r.LastChild(); c != nil; c = c.PreviousSibling() {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkChildNodesItem(b *testing.B) {
+	for _, n := range benchmarkWidths {
+		r := wideElement(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				children := r.ChildNodes()
+				for j := uint(0); j < children.Length(); j++ {
+					children.Item(j)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAppendRemoveChild(b *testing.B) {
+	for _, n := range benchmarkWidths {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				r := wideElement(n)
+				for r.FirstChild() != nil {
+					r.RemoveChild(r.FirstChild())
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInsertBefore(b *testing.B) {
+	for _, n := range benchmarkWidths {
+		r := wideElement(n)
+		d := r.OwnerDocument()
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// insert before, and then remove, every child
+				for c := r.FirstChild(); c != nil; c = c.NextSibling() {
+					r.RemoveChild(r.InsertBefore(d.CreateElement("x"), c))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInsertBeforeWithRange(b *testing.B) {
+	for _, n := range benchmarkWidths {
+		r := wideElement(n)
+		d := r.OwnerDocument()
+		// a live range elsewhere in the document
+		rng := d.CreateRange()
+		rng.SelectNodeContents(r.FirstChild())
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for c := r.FirstChild().NextSibling(); c != nil; c = c.NextSibling() {
+					r.RemoveChild(r.InsertBefore(d.CreateElement("x"), c))
+				}
+			}
+		})
+		rng.Detach()
+	}
+}
@@ -10,25 +10,27 @@ package dom
 
 // A _childNodelist only stores a reference to its parent node.
 // This way the list can be live, each time Length() or Item is
-// called, fresh results are returned.
+// called, fresh results are returned.  The parent remembers the last
+// child returned, so that walking the list in order takes linear time.
+// Like the rest of the tree, a list can be read from several goroutines
+// at once, but not while the tree is being changed.
 type _childNodelist struct {
-	list *[]Node
+	p *_node
 }
 
 func (nl *_childNodelist) Length() uint {
-	return uint(len(*nl.list))
+	return uint(nl.p.count)
 }
 
 func (nl *_childNodelist) Item(index uint) Node {
-	if index < uint(len(*nl.list)) {
-		// TODO: what if index == nl.p.c.Len() -1 and a node is deleted right now?
-		return (*nl.list)[int(index)]
+	if index < uint(nl.p.count) {
+		return nl.p.child(int(index))
 	}
 	return nil
 }
 
 func newChildNodelist(p *_node) *_childNodelist {
-	return &_childNodelist{&p.c}
+	return &_childNodelist{p}
 }
 
 // A _tagNodeList only stores a reference to the node and the tagname
@@ -36,7 +38,7 @@ func newChildNodelist(p *_node) *_childNodelist {
 // live.  TODO: Do we really query every time or can we cache the results
 // somehow?
 type _tagNodeList struct {
-	e    *Element
+	e    Node
 	tag  string
 	list []Node
 }
@@ -52,22 +54,58 @@ func (nl *_tagNodeList) Item(index uint) Node {
 	return nil
 }
 
-func addTagNodeList(list *[]Node, e *Element, tag string) {
-	for i := 0; i < len(e.c); i++ {
-		test := e.c[i]
+func addTagNodeList(list *[]Node, e Node, match func(*Element) bool) {
+	children := e.ChildNodes()
+	for i := uint(0); i < children.Length(); i++ {
+		test := children.Item(i)
 		if test.NodeType() == ELEMENT_NODE {
-			if test.NodeName() == tag {
+			if match(test.(*Element)) {
 				*list = append(*list, test)
 			}
-			addTagNodeList(list, test.(*Element), tag)
+			addTagNodeList(list, test, match)
 		}
 	}
 }
 
-func newTagNodeList(p *Element, tag string) *_tagNodeList {
+func newTagNodeList(p Node, tag string) *_tagNodeList {
 	nl := new(_tagNodeList)
 	nl.e = p
 	nl.tag = tag
-	addTagNodeList(&nl.list, p, tag)
+	addTagNodeList(&nl.list, p, func(e *Element) bool {
+		return tag == "*" || e.NodeName() == tag
+	})
 	return nl
 }
+
+// the special value "*" matches all namespaces or all local names
+func newTagNodeListNS(p Node, namespaceURI, localName string) *_tagNodeList {
+	nl := new(_tagNodeList)
+	nl.e = p
+	nl.tag = localName
+	addTagNodeList(&nl.list, p, func(e *Element) bool {
+		return (namespaceURI == "*" || e.n.Space == namespaceURI) &&
+			(localName == "*" || e.n.Local == localName)
+	})
+	return nl
+}
+
+// A _staticNodeList holds a snapshot of nodes, such as the result of a
+// query.  Unlike the other lists it is not live.
+type _staticNodeList struct {
+	list []Node
+}
+
+func (nl *_staticNodeList) Length() uint {
+	return uint(len(nl.list))
+}
+
+func (nl *_staticNodeList) Item(index uint) Node {
+	if index < uint(len(nl.list)) {
+		return nl.list[int(index)]
+	}
+	return nil
+}
+
+func newStaticNodeList(list []Node) *_staticNodeList {
+	return &_staticNodeList{list}
+}
@@ -0,0 +1,269 @@
+package dom
+
+/*
+ * MutationObserver and the records of changes to the tree
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"encoding/xml"
+)
+
+// A MutationRecord describes one change to the tree.  Type is
+// "childList" when a child was added or removed, "attributes" when an
+// attribute was set or removed, and "characterData" when the data of a
+// text node, comment or processing instruction changed.
+// http://dom.spec.whatwg.org/#interface-mutationrecord
+type MutationRecord struct {
+	Type   string
+	Target Node // the parent, the element, or the node whose data changed
+	// for childList
+	AddedNodes      []Node
+	RemovedNodes    []Node
+	PreviousSibling Node
+	NextSibling     Node
+	// for attributes
+	AttributeName      string // the local name
+	AttributeNamespace string
+	// the value before the change, when asked for by the options, or the
+	// empty string for an attribute that was added
+	OldValue string
+}
+
+// Selects the changes reported to a MutationObserver.  At least one of
+// ChildList, Attributes and CharacterData must be set, but asking for old
+// values or filtering attributes implies the type.
+// http://dom.spec.whatwg.org/#dictdef-mutationobserverinit
+type MutationObserverInit struct {
+	ChildList     bool
+	Attributes    bool
+	CharacterData bool
+	// also report changes to the descendants of the target
+	Subtree               bool
+	AttributeOldValue     bool
+	CharacterDataOldValue bool
+	// when not empty, only the attributes with these local names are
+	// reported
+	AttributeFilter []string
+}
+
+// Called by Deliver with the records queued since the last delivery.
+type MutationCallback func(records []*MutationRecord, observer *MutationObserver)
+
+// A MutationObserver queues a record for each change to the nodes it
+// observes.  Nothing is reported while the change is being made: the
+// records are taken with TakeRecords, or passed to the callback by
+// Deliver, for example after each command of an editor.
+// http://dom.spec.whatwg.org/#interface-mutationobserver
+type MutationObserver struct {
+	callback     MutationCallback
+	records      []*MutationRecord
+	observations []*_observation
+}
+
+// a target observed by an observer
+type _observation struct {
+	observer *MutationObserver
+	target   Node
+	options  MutationObserverInit
+	doc      *Document // notifies the observer of changes
+}
+
+// Returns an observer that observes nothing until Observe is called.  The
+// callback may be nil when the records are only taken with TakeRecords.
+func NewMutationObserver(callback MutationCallback) *MutationObserver {
+	return &MutationObserver{callback: callback}
+}
+
+// Starts reporting the changes to target selected by options, or
+// replaces the options when target is already observed.
+func (o *MutationObserver) Observe(target Node, options MutationObserverInit) {
+	o.TryObserve(target, options)
+}
+
+// Like Observe, but returns a DOMException when there is no target or
+// options select nothing, and when target does not belong to a document.
+func (o *MutationObserver) TryObserve(target Node, options MutationObserverInit) error {
+	if target == nil {
+		return &DOMException{NOT_FOUND_ERR, "no node to observe"}
+	}
+	if options.AttributeOldValue || len(options.AttributeFilter) > 0 {
+		options.Attributes = true
+	}
+	if options.CharacterDataOldValue {
+		options.CharacterData = true
+	}
+	if !options.ChildList && !options.Attributes && !options.CharacterData {
+		return &DOMException{SYNTAX_ERR, "options select no changes"}
+	}
+	d := ownerDocument(target)
+	if d == nil {
+		d = target.node().document()
+	}
+	if d == nil {
+		return &DOMException{NOT_SUPPORTED_ERR, "node does not belong to a document"}
+	}
+	for _, obs := range o.observations {
+		if obs.target == target {
+			obs.options = options
+			return nil
+		}
+	}
+	obs := &_observation{o, target, options, d}
+	o.observations = append(o.observations, obs)
+	d.observations = append(d.observations, obs)
+	return nil
+}
+
+// Stops observing all targets, and drops the records not yet taken.
+func (o *MutationObserver) Disconnect() {
+	for _, obs := range o.observations {
+		d := obs.doc
+		for i, other := range d.observations {
+			if other == obs {
+				d.observations = append(d.observations[:i], d.observations[i+1:]...)
+				break
+			}
+		}
+	}
+	o.observations = nil
+	o.records = nil
+}
+
+// Returns the records queued since the last call, in the order of the
+// changes, and empties the queue.
+func (o *MutationObserver) TakeRecords() []*MutationRecord {
+	records := o.records
+	o.records = nil
+	return records
+}
+
+// Passes the queued records to the callback, if there are any.
+func (o *MutationObserver) Deliver() {
+	if len(o.records) == 0 || o.callback == nil {
+		return
+	}
+	o.callback(o.TakeRecords(), o)
+}
+
+// ====================================
+
+// queues rec for the observers of n, and of its ancestors that observe
+// their subtree.  An observer gets a single record, even when it observes
+// several of those nodes.  When the target of rec is nil, n is not a
+// child, and only its own observers get the record.
+func (d *Document) queueMutation(n *_node, rec MutationRecord) {
+	var queued []*MutationObserver
+	for _, obs := range d.observations {
+		if !obs.selects(n, &rec) {
+			continue
+		}
+		o := obs.observer
+		seen := false
+		for _, q := range queued {
+			seen = seen || q == o
+		}
+		if !seen {
+			r := rec
+			r.OldValue = ""
+			if r.Target == nil {
+				r.Target = obs.target
+			}
+			o.records = append(o.records, &r)
+			queued = append(queued, o)
+		}
+		if obs.wantsOldValue(rec.Type) {
+			o.records[len(o.records)-1].OldValue = rec.OldValue
+		}
+	}
+}
+
+// reports whether the change to n is one of those observed
+func (obs *_observation) selects(n *_node, rec *MutationRecord) bool {
+	o := &obs.options
+	switch rec.Type {
+	case "childList":
+		if !o.ChildList {
+			return false
+		}
+	case "attributes":
+		if !o.Attributes || !inFilter(o.AttributeFilter, rec.AttributeName) {
+			return false
+		}
+	case "characterData":
+		if !o.CharacterData {
+			return false
+		}
+	}
+	t := obs.target.node()
+	if t == n {
+		return true
+	}
+	if !o.Subtree {
+		return false
+	}
+	for a := n; a.isChild(); {
+		if a = a.p.node(); a == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (obs *_observation) wantsOldValue(typ string) bool {
+	switch typ {
+	case "attributes":
+		return obs.options.AttributeOldValue
+	case "characterData":
+		return obs.options.CharacterDataOldValue
+	}
+	return false
+}
+
+func inFilter(filter []string, name string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// called after c was inserted into p
+func (d *Document) childAdded(p, c Node) {
+	d.queueMutation(p.node(), MutationRecord{
+		Type: "childList", Target: p, AddedNodes: []Node{c},
+		PreviousSibling: c.PreviousSibling(), NextSibling: c.NextSibling(),
+	})
+}
+
+// called before c is removed from p
+func (d *Document) childRemoving(p, c Node) {
+	d.queueMutation(p.node(), MutationRecord{
+		Type: "childList", Target: p, RemovedNodes: []Node{c},
+		PreviousSibling: c.PreviousSibling(), NextSibling: c.NextSibling(),
+	})
+}
+
+// called before the attribute name of e is set or removed, where old is
+// the value before, or the empty string if there is no attribute
+func (e *Element) attributeChanging(name xml.Name, old string) {
+	if d := e.OwnerDocument(); d != nil && len(d.observations) > 0 {
+		d.queueMutation(&e._node, MutationRecord{
+			Type: "attributes", Target: e,
+			AttributeName: name.Local, AttributeNamespace: name.Space, OldValue: old,
+		})
+	}
+}
+
+// called before the data of n changes from old.  The target is found
+// through the siblings or the parent, as n is embedded in the node.
+func dataChanging(n *_node, old func() string) {
+	if d := n.document(); d != nil && len(d.observations) > 0 {
+		d.queueMutation(n, MutationRecord{Type: "characterData", Target: n.self(), OldValue: old()})
+	}
+}
@@ -0,0 +1,133 @@
+package dom
+
+import (
+	"strings"
+	"testing"
+)
+
+// summarizes records as type:target:added:removed:attribute:old value
+func describeRecords(records []*MutationRecord) string {
+	var s []string
+	for _, r := range records {
+		names := func(nodes []Node) string {
+			n := ""
+			for _, c := range nodes {
+				n += c.NodeName()
+			}
+			return n
+		}
+		s = append(s, r.Type+":"+r.Target.NodeName()+":"+names(r.AddedNodes)+":"+
+			names(r.RemovedNodes)+":"+r.AttributeName+":"+r.OldValue)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestObserveChildList(t *testing.T) {
+	d, _ := ParseStringXml(`<a><b/><c/></a>`)
+	a := d.DocumentElement()
+	b, c := a.FirstChild(), a.LastChild()
+	o := NewMutationObserver(nil)
+	o.Observe(a, MutationObserverInit{ChildList: true})
+
+	x := d.CreateElement("x")
+	a.InsertBefore(x, c)
+	a.RemoveChild(b)
+	b.AppendChild(d.CreateElement("y")) // b is no longer in the subtree
+	c.AppendChild(d.CreateElement("z")) // not observed without subtree
+	records := o.TakeRecords()
+	if s := describeRecords(records); s != "childList:a:x::: childList:a::b::" {
+		t.Fatalf("Unexpected records %s", s)
+	}
+	if records[0].PreviousSibling != b || records[0].NextSibling != c {
+		t.Errorf("Wrong siblings for an insertion")
+	}
+	if records[1].PreviousSibling != nil || records[1].NextSibling != x {
+		t.Errorf("Wrong siblings for a removal")
+	}
+	if o.TakeRecords() != nil {
+		t.Errorf("Records not emptied")
+	}
+
+	// moving a node within the tree is a removal and an insertion
+	a.AppendChild(x)
+	a.SetTextContent("text")
+	if s := describeRecords(o.TakeRecords()); s != "childList:a::x:: childList:a:x::: "+
+		"childList:a::c:: childList:a::x:: childList:a:#text:::" {
+		t.Errorf("Unexpected records %s", s)
+	}
+}
+
+func TestObserveSubtree(t *testing.T) {
+	d, _ := ParseStringXml(`<a x="1"><b y="2">text<?pi data?></b></a>`)
+	a := d.DocumentElement()
+	b := a.FirstChild().(*Element)
+	text := b.FirstChild().(*Text)
+	pi := b.LastChild().(*ProcessingInstruction)
+
+	var delivered []*MutationRecord
+	o := NewMutationObserver(func(records []*MutationRecord, observer *MutationObserver) {
+		delivered = append(delivered, records...)
+	})
+	o.Observe(a, MutationObserverInit{Subtree: true, AttributeOldValue: true, CharacterDataOldValue: true})
+	// observing a node twice, directly and through its ancestor, gives
+	// one record
+	o.Observe(b, MutationObserverInit{Attributes: true})
+
+	b.SetAttribute("y", "3")
+	b.SetAttribute("z", "new")
+	b.GetAttributeNode("y").SetValue("4")
+	a.RemoveAttribute("x")
+	text.AppendData("!")
+	text.ReplaceData(0, 1, "T")
+	text.SplitText(2)
+	pi.SetData("other")
+	b.AppendChild(d.CreateElement("c")) // childList is not observed
+
+	if delivered != nil {
+		t.Errorf("Records delivered before Deliver")
+	}
+	o.Deliver()
+	expected := "attributes:b:::y:2 attributes:b:::z: attributes:b:::y:3 attributes:a:::x:1 " +
+		"characterData:#text::::text characterData:#text::::text! characterData:#text::::Text! " +
+		"characterData:pi::::data"
+	if s := describeRecords(delivered); s != expected {
+		t.Errorf("Expected records\n%s\ngot\n%s", expected, s)
+	}
+
+	// the filter selects by local name
+	o.Observe(a, MutationObserverInit{Subtree: true, AttributeFilter: []string{"w"}})
+	b.SetAttribute("y", "5")
+	b.SetAttributeNS("urn:w", "p:w", "6")
+	records := o.TakeRecords()
+	if len(records) != 2 || records[1].AttributeNamespace != "urn:w" || records[0].OldValue != "" {
+		t.Errorf("Unexpected records %s", describeRecords(records))
+	}
+
+	// nothing is reported after disconnecting
+	o.Disconnect()
+	b.SetAttribute("y", "6")
+	text.SetData("")
+	if o.TakeRecords() != nil || len(d.observations) != 0 {
+		t.Errorf("Records after Disconnect")
+	}
+}
+
+func TestObserveOptions(t *testing.T) {
+	d, _ := ParseStringXml(`<a/>`)
+	o := NewMutationObserver(nil)
+	if err := o.TryObserve(d, MutationObserverInit{Subtree: true}); exceptionCode(err) != SYNTAX_ERR {
+		t.Errorf("Observing nothing: %v", err)
+	}
+	if err := o.TryObserve(nil, MutationObserverInit{ChildList: true}); exceptionCode(err) != NOT_FOUND_ERR {
+		t.Errorf("Observing no node: %v", err)
+	}
+
+	// a node that is not in the tree can be observed
+	text := d.CreateTextNode("t")
+	o.Observe(text, MutationObserverInit{CharacterData: true})
+	text.SetData("u")
+	if s := describeRecords(o.TakeRecords()); s != "characterData:#text::::" {
+		t.Errorf("Unexpected records %s", s)
+	}
+	o.Deliver() // no callback
+}
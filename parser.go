@@ -0,0 +1,228 @@
+package dom
+
+/*
+ * Parser configuration
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// A Parser builds documents from XML.  The zero Parser is lenient, like
+// the parser for HTML without its entities and auto-closed elements.
+type Parser struct {
+	// Reject input that is not well-formed, or uses undeclared namespace
+	// prefixes.
+	Strict bool
+	// Elements that are closed automatically when not in strict mode.
+	AutoClose []string
+	// Entities known in addition to the predefined ones, mapped to their
+	// replacement text.
+	Entity map[string]string
+
+	// Drop text nodes containing only whitespace.
+	IgnoreWhitespace bool
+	// Drop comments.
+	IgnoreComments bool
+	// Keep qualified names as they are written, instead of resolving
+	// prefixes to namespaces.  Namespace declarations are kept as ordinary
+	// attributes.
+	IgnoreNamespaces bool
+
+	// Limits that protect against hostile input.  Exceeding a limit gives
+	// a LimitError.  Zero selects the default, which is safe for untrusted
+	// input, and a negative value removes the limit.
+
+	// The maximum nesting depth of elements.
+	MaxDepth int
+	// The maximum number of nodes created.
+	MaxNodes int
+	// The maximum number of attributes of an element.
+	MaxAttributes int
+	// The maximum size in bytes of text, comments, CDATA sections and
+	// processing instructions, and of each token in the input, such as a
+	// start tag with its attributes.
+	MaxTextSize int
+	// The maximum number of bytes produced by replacing references to the
+	// entities declared in the document type, both for the value of each
+	// entity and over the whole document.
+	MaxEntityExpansion int
+
+	// Returns a reader converting input in the named charset to UTF-8.
+	// The default uses the charsets from RegisterCharset.  UTF-8 and
+	// UTF-16 are detected from the first bytes of the input.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+	// Returns the content of an external parsed entity declared in the
+	// document type.  Without a resolver, references to such entities are
+	// errors in strict mode.
+	EntityResolver func(publicId, systemId string) (io.Reader, error)
+}
+
+// Returns a strict parser for XML.
+func XmlParser() *Parser {
+	return &Parser{Strict: true}
+}
+
+// Returns a lenient parser for HTML, which knows the HTML entities and the
+// elements that need not be closed.
+func HtmlParser() *Parser {
+	return &Parser{AutoClose: xml.HTMLAutoClose, Entity: xml.HTMLEntity}
+}
+
+func (p *Parser) Parse(r io.Reader) (*Document, error) {
+	// Create parser and get first token
+	dec, err := newDecoder(r, p)
+	if err != nil {
+		return nil, err
+	}
+	t, err := dec.Token()
+	if err != nil {
+		return nil, dec.locate(err)
+	}
+
+	d := newDoc()
+	d.pos = Position{1, 1, 0}
+	if err = parseTokens(dec, t, d, nil); err != nil {
+		return nil, dec.locate(err)
+	}
+
+	// All is good, return the document
+	return d, nil
+}
+
+func (p *Parser) ParseString(s string) (*Document, error) {
+	return p.Parse(strings.NewReader(s))
+}
+
+// Parses a snippet of XML in the context of an element.  The namespaces in
+// scope at ctx are in scope for the snippet, which may contain any number
+// of elements and text.  The returned fragment belongs to the owner
+// document of ctx, but is not inserted into the tree.
+func (p *Parser) ParseFragment(ctx *Element, r io.Reader) (*DocumentFragment, error) {
+	f := newFragment()
+
+	// wrap the snippet in an element declaring the namespaces from ctx
+	var wrapper strings.Builder
+	wrapper.WriteString("<" + fragmentWrapper)
+	if ctx != nil {
+		f.p = ctx.OwnerDocument()
+		for prefix, uri := range inScopeNamespaces(ctx) {
+			wrapper.WriteString(" " + strings.TrimSuffix("xmlns:"+prefix, ":") + "=\"")
+			xml.EscapeText(&wrapper, []byte(uri))
+			wrapper.WriteString("\"")
+		}
+	}
+	wrapper.WriteString(">")
+	dec, err := newDecoder(io.MultiReader(strings.NewReader(wrapper.String()), r, strings.NewReader("</"+fragmentWrapper+">")), p)
+	if err != nil {
+		return nil, err
+	}
+	t, err := dec.Token()
+	if err != nil {
+		return nil, fragmentError(dec.locate(err))
+	}
+	ns := (*_nsScope)(nil).push(t.(xml.StartElement).Attr)
+	dec.resetPosition()
+	f.pos = Position{1, 1, 0}
+	if t, err = dec.Token(); err != nil {
+		return nil, fragmentError(dec.locate(err))
+	}
+
+	if err = parseTokens(dec, t, f, ns); err != nil {
+		return nil, fragmentError(dec.locate(err))
+	}
+	return f, nil
+}
+
+// the element around the snippet given to ParseFragment.  The snippet
+// cannot close it, as parseTokens only accepts its end tag at the end of
+// the input.
+const fragmentWrapper = "dom-fragment"
+
+// rewrites the errors from encoding/xml that name the wrapper around a
+// snippet, as if the snippet had been parsed on its own
+func fragmentError(err error) error {
+	se, ok := err.(*SyntaxError)
+	if !ok {
+		return err
+	}
+	end := "</" + fragmentWrapper + ">"
+	// whether the error was found after the end tag of the wrapper
+	atEnd := true
+	msg := se.Msg
+	switch {
+	case strings.Contains(msg, " closed by "+end):
+		// an element of the snippet is not closed
+		msg = msg[:strings.Index(msg, " closed by ")] + " not closed"
+	case msg == "unexpected end element "+end:
+		msg = "element not closed"
+	case strings.HasPrefix(msg, "element <"+fragmentWrapper+">"):
+		// an end tag without a start tag
+		i := strings.Index(msg, "</")
+		msg = "unexpected end element " + msg[i:i+strings.Index(msg[i:], ">")+1]
+		atEnd = false
+	default:
+		return se
+	}
+	if atEnd {
+		se.Pos.Column -= len(end)
+		se.Pos.Offset -= int64(len(end))
+	}
+	se.Msg = msg
+	if xe, ok := se.Err.(*xml.SyntaxError); ok {
+		xe.Msg = msg
+	}
+	return se
+}
+
+// ====================================
+
+// reads the content of the external parsed entities of dt, using the
+// EntityResolver
+func (p *_decoder) resolveEntities(dt *DocumentType) error {
+	if p.opts.EntityResolver == nil {
+		return nil
+	}
+	for _, n := range dt.entities {
+		e := n.(*Entity)
+		if e.systemId == "" || e.notationName != "" || e.first != nil {
+			continue
+		}
+		r, err := p.opts.EntityResolver(e.publicId, e.systemId)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		text := string(b)
+		if strings.HasPrefix(text, "<?xml") {
+			// drop the text declaration
+			if end := strings.Index(text, "?>"); end >= 0 {
+				text = text[end+2:]
+			}
+		}
+		t := newText(xml.CharData(text))
+		e.insertChildBefore(t, nil)
+		t.setParent(e)
+	}
+	return nil
+}
+
+// turns the resolved names of el and its attributes back into the names
+// as written, for parsers that ignore namespaces
+func dropNamespaces(el *Element) {
+	el.n = xml.Name{Local: qualifiedName(el.pfx, el.n.Local)}
+	el.pfx = ""
+	for i := range el.attribs {
+		a := el.attribs[i]
+		a.n = xml.Name{Local: qualifiedName(a.pfx, a.n.Local)}
+		a.pfx = ""
+	}
+}
@@ -0,0 +1,138 @@
+package dom
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParserWhitespaceAndComments(t *testing.T) {
+	const in = "<a>\n  <b> x </b>\n  <!-- c -->\n  <![CDATA[ ]]>\n</a>"
+	test_cases := []struct {
+		p   Parser
+		out string
+	}{
+		{Parser{Strict: true}, "<a>\n  <b> x </b>\n  <!-- c -->\n  <![CDATA[ ]]>\n</a>"},
+		{Parser{Strict: true, IgnoreWhitespace: true}, "<a><b> x </b><!-- c --><![CDATA[ ]]></a>"},
+		{Parser{Strict: true, IgnoreComments: true}, "<a>\n  <b> x </b>\n  \n  <![CDATA[ ]]>\n</a>"},
+		{Parser{Strict: true, IgnoreWhitespace: true, IgnoreComments: true}, "<a><b> x </b><![CDATA[ ]]></a>"},
+	}
+	for i, v := range test_cases {
+		d, err := v.p.ParseString(in)
+		if err != nil {
+			t.Errorf("Test case %d: error parsing (%v).", i, err)
+			continue
+		}
+		if out := string(d.DocumentElement().ToXml()); out != v.out {
+			t.Errorf("Test case %d: got %q", i, out)
+		}
+	}
+}
+
+func TestParserIgnoreNamespaces(t *testing.T) {
+	p := &Parser{Strict: true, IgnoreNamespaces: true}
+	d, err := p.ParseString(`<p:a xmlns:p="urn:p" xmlns="urn:d" p:x="1" xml:lang="en"><q:b/></p:a>`)
+	if err != nil {
+		t.Fatalf("Error parsing (%v).", err)
+	}
+	a := d.DocumentElement()
+	if a.NodeName() != "p:a" || a.NamespaceURI() != "" || a.Prefix() != "" || a.LocalName() != "p:a" {
+		t.Errorf("Element name resolved: %s {%s}", a.NodeName(), a.NamespaceURI())
+	}
+	if a.GetAttribute("xmlns:p") != "urn:p" || a.GetAttribute("xmlns") != "urn:d" || a.GetAttribute("p:x") != "1" || a.GetAttribute("xml:lang") != "en" {
+		t.Errorf("Attribute names resolved: %s", a.ToXml())
+	}
+	if b := a.FirstChild(); b.NodeName() != "q:b" {
+		t.Errorf("Unbound prefix not kept: %s", b.NodeName())
+	}
+}
+
+func TestParserLimits(t *testing.T) {
+	test_cases := []struct {
+		p  Parser
+		in string
+		ok bool
+	}{
+		{Parser{Strict: true, MaxDepth: 2}, "<a><b/><b/></a>", true},
+		{Parser{Strict: true, MaxDepth: 2}, "<a><b><c/></b></a>", false},
+		{Parser{Strict: true, MaxNodes: 3}, "<a>x<b/></a>", true},
+		{Parser{Strict: true, MaxNodes: 3}, "<a>x<b/><!-- --></a>", false},
+		{Parser{Strict: true, MaxNodes: 3, IgnoreComments: true}, "<a>x<b/><!-- --></a>", true},
+	}
+	for i, v := range test_cases {
+		_, err := v.p.ParseString(v.in)
+		if ok := err == nil; ok != v.ok {
+			t.Errorf("Test case %d: error %v", i, err)
+		}
+	}
+}
+
+func TestParserCharsetReader(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="x-upper"?><a>text</a>`
+	if _, err := XmlParser().ParseString(in); err == nil {
+		t.Errorf("Unknown charset accepted")
+	}
+	p := XmlParser()
+	p.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if charset != "x-upper" {
+			return nil, errors.New("unexpected charset " + charset)
+		}
+		b, _ := io.ReadAll(input)
+		return strings.NewReader(strings.ToUpper(string(b))), nil
+	}
+	d, err := p.ParseString(in)
+	if err != nil {
+		t.Fatalf("Error parsing (%v).", err)
+	}
+	if d.DocumentElement().NodeName() != "A" {
+		t.Errorf("Charset reader not used")
+	}
+}
+
+func TestParserEntityResolver(t *testing.T) {
+	const in = `<!DOCTYPE a [
+<!ENTITY ext PUBLIC "-//Example//Text" "ext.txt">
+<!ENTITY img SYSTEM "img.gif" NDATA gif>
+]><a>&ext;</a>`
+	if _, err := XmlParser().ParseString(in); err == nil {
+		t.Errorf("Reference to an unresolved entity accepted")
+	}
+
+	p := XmlParser()
+	resolved := []string{}
+	p.EntityResolver = func(publicId, systemId string) (io.Reader, error) {
+		resolved = append(resolved, publicId+" "+systemId)
+		return strings.NewReader(`<?xml encoding="UTF-8"?>external & text`), nil
+	}
+	d, err := p.ParseString(in)
+	if err != nil {
+		t.Fatalf("Error parsing (%v).", err)
+	}
+	if text := string(d.DocumentElement().ToText(false)); text != "external & text" {
+		t.Errorf("Entity replaced by %q", text)
+	}
+	if len(resolved) != 1 || resolved[0] != "-//Example//Text ext.txt" {
+		t.Errorf("Resolver called for %v", resolved)
+	}
+
+	p.EntityResolver = func(publicId, systemId string) (io.Reader, error) {
+		return nil, errors.New("not found")
+	}
+	if _, err := p.ParseString(in); err == nil || err.Error() != "not found" {
+		t.Errorf("Resolver error not returned: %v", err)
+	}
+}
+
+func TestParserPresets(t *testing.T) {
+	if _, err := HtmlParser().ParseString("<p>a&nbsp;<br>b</p>"); err != nil {
+		t.Errorf("HTML preset rejects HTML (%v).", err)
+	}
+	if _, err := XmlParser().ParseString("<p>a<br>b</p>"); err == nil {
+		t.Errorf("XML preset accepts unclosed elements")
+	}
+	// the positional form is kept
+	if d, err := Parse(strings.NewReader("<a/>"), true, nil, nil); err != nil || d.DocumentElement().NodeName() != "a" {
+		t.Errorf("Parse no longer works (%v).", err)
+	}
+}
@@ -0,0 +1,48 @@
+package dom
+
+/*
+ * Source positions of parsed nodes
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// A Position is a location in the input of the parser.  Lines and columns
+// start at 1, and columns count characters.  The zero Position is used for
+// nodes that were not parsed.
+type Position struct {
+	Line   int
+	Column int
+	Offset int64 // in bytes, after conversion to UTF-8
+}
+
+// Returns true if the position was recorded by the parser.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+}
+
+// returns the line and column reached after reading b, starting at the
+// given line and column
+func advancePosition(b []byte, line, col int) (int, int) {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+		b = b[size:]
+	}
+	return line, col
+}
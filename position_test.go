@@ -0,0 +1,87 @@
+package dom
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNodePositions(t *testing.T) {
+	d, err := ParseStringXml("<?xml version=\"1.0\"?>\n<!DOCTYPE r>\n<r>\n  <é a=\"1\">text</é><!--c--><?pi x?>\n  <b><![CDATA[x]]></b>\n</r>")
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	r := d.DocumentElement()
+	e := r.ChildNodes().Item(1)
+	test_cases := []struct {
+		n    Node
+		line int
+		col  int
+		off  int64
+	}{
+		{d, 1, 1, 0},
+		{d.Doctype(), 2, 1, 22},
+		{r, 3, 1, 35},
+		{r.FirstChild(), 3, 4, 38},
+		{e, 4, 3, 41},
+		{e.FirstChild(), 4, 12, 51},
+		{r.ChildNodes().Item(2), 4, 20, 60},
+		{r.ChildNodes().Item(3), 4, 28, 68},
+		{r.ChildNodes().Item(5).FirstChild(), 5, 6, 82},
+	}
+	for i, v := range test_cases {
+		if p := v.n.Position(); p.Line != v.line || p.Column != v.col || p.Offset != v.off {
+			t.Errorf("Test case %d: %s at %v, offset %d", i, v.n.NodeName(), p, p.Offset)
+		}
+	}
+
+	if p := d.CreateElement("new").Position(); p.IsValid() || p.String() != "-" {
+		t.Errorf("Created node has a position")
+	}
+}
+
+func TestFragmentPositions(t *testing.T) {
+	d, _ := ParseStringXml(`<r xmlns:p="urn:p"/>`)
+	f, err := ParseFragment(d.DocumentElement(), strings.NewReader("text\n<p:a/>"))
+	if err != nil {
+		t.Fatalf("Error parsing fragment (%v).", err)
+	}
+	if p := f.FirstChild().Position(); p.String() != "1:1" || p.Offset != 0 {
+		t.Errorf("Text of fragment at %v, offset %d", p, p.Offset)
+	}
+	if p := f.LastChild().Position(); p.String() != "2:1" || p.Offset != 5 {
+		t.Errorf("Element of fragment at %v, offset %d", p, p.Offset)
+	}
+}
+
+func TestSyntaxErrorPositions(t *testing.T) {
+	test_cases := []struct {
+		in  string
+		pos string
+	}{
+		{"<r>\n  <p:a/>\n</r>", "2:3"},
+		{"<r/>\n<!-- -->text", "2:9"},
+		{"<r>\n<a></b>", "2:8"},
+		{"<!DOCTYPE r [<!ENTITY a>]>", "1:1"},
+		{"<r>\n  <a x=1/>", "2:9"},
+	}
+	for _, v := range test_cases {
+		_, err := ParseStringXml(v.in)
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Parsing %q returned %v", v.in, err)
+			continue
+		}
+		if se.Pos.String() != v.pos || !strings.HasPrefix(se.Error(), v.pos+": ") {
+			t.Errorf("Parsing %q: error %q at %v", v.in, se.Error(), se.Pos)
+		}
+	}
+
+	// the error from encoding/xml is still found
+	_, err := ParseStringXml("<r><a></r>")
+	var xe *xml.SyntaxError
+	if !errors.As(err, &xe) || !strings.Contains(err.Error(), xe.Msg) {
+		t.Errorf("No xml.SyntaxError in %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package dom
+
+/*
+ * ProcessingInstruction implementation
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// DOM3: http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-1004215813
+type ProcessingInstruction struct {
+	_node
+	target string
+	data   string
+}
+
+func (n *ProcessingInstruction) NodeType() uint           { return PROCESSING_INSTRUCTION_NODE }
+func (n *ProcessingInstruction) NodeName() string         { return n.target }
+func (n *ProcessingInstruction) NodeValue() string        { return n.data }
+func (n *ProcessingInstruction) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *ProcessingInstruction) TextContent() string      { return n.data }
+func (n *ProcessingInstruction) SetTextContent(text string) {
+	n.SetData(text)
+}
+func (n *ProcessingInstruction) CloneNode(deep bool) Node {
+	return cloneNode(n, deep, n.OwnerDocument())
+}
+func (n *ProcessingInstruction) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-1478689192
+func (n *ProcessingInstruction) Target() string {
+	return n.target
+}
+
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-837822393
+func (n *ProcessingInstruction) Data() string {
+	return n.data
+}
+
+func (n *ProcessingInstruction) SetData(data string) {
+	dataChanging(&n._node, n.Data)
+	count := len(n.data)
+	n.data = data
+	dataReplaced(&n._node, 0, uint32(count), uint32(len(data)))
+}
+
+func newProcInst(token xml.ProcInst) *ProcessingInstruction {
+	n := new(ProcessingInstruction)
+	n.target = token.Target
+	n.data = string(token.Inst)
+	return n
+}
+
+// returns the value of a pseudo-attribute, such as the version in the
+// XML declaration, from the data of a processing instruction
+func procInstParam(data string, name string) (string, bool) {
+	for data = strings.TrimSpace(data); data != ""; {
+		eq := strings.IndexByte(data, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(data[:eq])
+		data = strings.TrimSpace(data[eq+1:])
+		if data == "" || (data[0] != '"' && data[0] != '\'') {
+			break
+		}
+		end := strings.IndexByte(data[1:], data[0])
+		if end < 0 {
+			break
+		}
+		if key == name {
+			return data[1 : end+1], true
+		}
+		data = strings.TrimSpace(data[end+2:])
+	}
+	return "", false
+}
@@ -0,0 +1,80 @@
+package dom
+
+import (
+	"testing"
+)
+
+func TestParseProcessingInstructions(t *testing.T) {
+	str := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<?xml-stylesheet type="text/xsl" href="style.xsl"?>
+<!-- before -->
+<root><?php echo 1; ?><?empty?></root>
+<!-- after -->`
+	d, err := ParseStringXml(str)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	if d.XmlVersion() != "1.0" || d.XmlEncoding() != "UTF-8" || !d.XmlStandalone() {
+		t.Errorf("XML declaration not recorded")
+	}
+	if d.ChildNodes().Length() != 4 || d.DocumentElement().NodeName() != "root" {
+		t.Fatalf("Prolog and epilog not parsed")
+	}
+	pi, ok := d.FirstChild().(*ProcessingInstruction)
+	if !ok || pi.Target() != "xml-stylesheet" || pi.Data() != `type="text/xsl" href="style.xsl"` {
+		t.Errorf("Processing instruction not parsed")
+	}
+	if v, _ := procInstParam(pi.Data(), "href"); v != "style.xsl" {
+		t.Errorf("Pseudo-attribute not found")
+	}
+	if pi.NodeType() != PROCESSING_INSTRUCTION_NODE || pi.NodeName() != "xml-stylesheet" {
+		t.Errorf("Processing instruction node type or name")
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<?xml-stylesheet type="text/xsl" href="style.xsl"?><!-- before -->` +
+		`<root><?php echo 1; ?><?empty?></root><!-- after -->`
+	if string(d.ToXml()) != expected {
+		t.Errorf("Document serialized as %s", d.ToXml())
+	}
+}
+
+func TestParseCDATASection(t *testing.T) {
+	d, err := ParseStringXml(`<root>a<![CDATA[<b> & ]]]]><![CDATA[>]]>c</root>`)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	r := d.DocumentElement()
+	if r.ChildNodes().Length() != 4 {
+		t.Fatalf("Expected 4 children, found %d", r.ChildNodes().Length())
+	}
+	cd, ok := r.ChildNodes().Item(1).(*CDATASection)
+	if !ok || cd.NodeValue() != "<b> & ]]" || cd.NodeType() != CDATA_SECTION_NODE {
+		t.Errorf("CDATA section not parsed")
+	}
+	if _, ok := r.FirstChild().(*Text); !ok {
+		t.Errorf("Text before a CDATA section not parsed as text")
+	}
+	if string(r.ToText(false)) != "a<b> & ]]>c" {
+		t.Errorf("Text content of CDATA sections not included (%s)", r.ToText(false))
+	}
+	if string(d.ToXml()) != `<root>a<![CDATA[<b> & ]]]]><![CDATA[>]]>c</root>` {
+		t.Errorf("CDATA sections serialized as %s", d.ToXml())
+	}
+	if _, err := ParseStringXml(`<![CDATA[x]]><root/>`); err == nil {
+		t.Errorf("CDATA section outside of the root element")
+	}
+}
+
+func TestCreateProcessingInstructionCDATA(t *testing.T) {
+	d, _ := ParseStringXml(`<root/>`)
+	d.InsertBefore(d.CreateProcessingInstruction("pi", "data"), d.DocumentElement())
+	d.DocumentElement().AppendChild(d.CreateCDATASection("x]]>y"))
+	d.SetXmlVersion("1.0")
+	if string(d.ToXml()) != `<?xml version="1.0"?><?pi data?><root><![CDATA[x]]]]><![CDATA[>y]]></root>` {
+		t.Errorf("Created nodes serialized as %s", d.ToXml())
+	}
+	c := d.CloneNode(true).(*Document)
+	if string(c.ToXml()) != string(d.ToXml()) {
+		t.Errorf("Cloned document serialized as %s", c.ToXml())
+	}
+}
@@ -0,0 +1,778 @@
+package dom
+
+/*
+ * Range from DOM Level 2 Traversal and Range
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"strings"
+)
+
+// How CompareBoundaryPoints compares two ranges.  START_TO_END compares
+// the start of the source range with the end of the range.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-Range-idl
+const (
+	START_TO_START = iota
+	START_TO_END
+	END_TO_END
+	END_TO_START
+)
+
+// The codes of a RangeException.
+const (
+	_                      = iota // ignore first value
+	BAD_BOUNDARYPOINTS_ERR = iota
+	INVALID_NODE_TYPE_ERR
+)
+
+// A RangeException is returned by the checked methods of Range when a
+// boundary point or a node cannot be used.  The other errors are
+// DOMExceptions.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#RangeException
+type RangeException struct {
+	Code uint
+	Msg  string
+}
+
+func (e *RangeException) Error() string {
+	switch e.Code {
+	case BAD_BOUNDARYPOINTS_ERR:
+		return "dom: BAD_BOUNDARYPOINTS_ERR: " + e.Msg
+	case INVALID_NODE_TYPE_ERR:
+		return "dom: INVALID_NODE_TYPE_ERR: " + e.Msg
+	}
+	return "dom: " + e.Msg
+}
+
+// a position in the tree: a child index for nodes with children, and a
+// byte offset in the data for character data and processing instructions
+type boundary struct {
+	n      Node
+	offset uint32
+}
+
+// A Range selects the content between two boundary points, such as part
+// of a text node and the elements after it.  The range is updated when
+// the tree changes, so that it keeps selecting the same content, until it
+// is detached.  Like CharacterData, offsets in data are in bytes.
+//
+// The unchecked methods leave the range and the tree unchanged when the
+// checked ones would return an error.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level-2-Range-Interface
+type Range struct {
+	start, end boundary
+	doc        *Document // updates the range, nil once detached
+}
+
+// Returns a range collapsed at the start of the document.  Every change to
+// the tree updates the ranges of the document, so Detach should be called
+// when the range is no longer needed.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-DocumentRange-method-createRange
+func (d *Document) CreateRange() *Range {
+	r := &Range{boundary{d, 0}, boundary{d, 0}, d}
+	d.ranges = append(d.ranges, r)
+	return r
+}
+
+func (r *Range) StartContainer() Node { return r.start.n }
+func (r *Range) StartOffset() uint32  { return r.start.offset }
+func (r *Range) EndContainer() Node   { return r.end.n }
+func (r *Range) EndOffset() uint32    { return r.end.offset }
+func (r *Range) Collapsed() bool      { return r.start == r.end }
+
+// Returns the deepest node that contains both boundary points.
+func (r *Range) CommonAncestorContainer() Node {
+	return commonAncestor(r.start.n, r.end.n)
+}
+
+func (r *Range) SetStart(n Node, offset uint32) { r.TrySetStart(n, offset) }
+func (r *Range) SetEnd(n Node, offset uint32)   { r.TrySetEnd(n, offset) }
+func (r *Range) SetStartBefore(n Node)          { r.TrySetStartBefore(n) }
+func (r *Range) SetStartAfter(n Node)           { r.TrySetStartAfter(n) }
+func (r *Range) SetEndBefore(n Node)            { r.TrySetEndBefore(n) }
+func (r *Range) SetEndAfter(n Node)             { r.TrySetEndAfter(n) }
+func (r *Range) SelectNode(n Node)              { r.TrySelectNode(n) }
+func (r *Range) SelectNodeContents(n Node)      { r.TrySelectNodeContents(n) }
+func (r *Range) DeleteContents()                { r.TryDeleteContents() }
+func (r *Range) InsertNode(n Node)              { r.TryInsertNode(n) }
+func (r *Range) SurroundContents(n Node)        { r.TrySurroundContents(n) }
+func (r *Range) CompareBoundaryPoints(how uint, source *Range) int {
+	i, _ := r.TryCompareBoundaryPoints(how, source)
+	return i
+}
+
+// Sets the start of the range.  If the start is after the end, or in
+// another tree, the range is collapsed to the start.
+func (r *Range) TrySetStart(n Node, offset uint32) error {
+	b, err := r.boundary(n, offset)
+	if err != nil {
+		return err
+	}
+	r.start = b
+	if rootOf(b.n) != rootOf(r.end.n) || compareBoundary(b, r.end) > 0 {
+		r.end = b
+	}
+	return nil
+}
+
+// Sets the end of the range.  If the end is before the start, or in
+// another tree, the range is collapsed to the end.
+func (r *Range) TrySetEnd(n Node, offset uint32) error {
+	b, err := r.boundary(n, offset)
+	if err != nil {
+		return err
+	}
+	r.end = b
+	if rootOf(b.n) != rootOf(r.start.n) || compareBoundary(r.start, b) > 0 {
+		r.start = b
+	}
+	return nil
+}
+
+func (r *Range) TrySetStartBefore(n Node) error {
+	return r.setBeside(n, 0, r.TrySetStart)
+}
+
+func (r *Range) TrySetStartAfter(n Node) error {
+	return r.setBeside(n, 1, r.TrySetStart)
+}
+
+func (r *Range) TrySetEndBefore(n Node) error {
+	return r.setBeside(n, 0, r.TrySetEnd)
+}
+
+func (r *Range) TrySetEndAfter(n Node) error {
+	return r.setBeside(n, 1, r.TrySetEnd)
+}
+
+func (r *Range) setBeside(n Node, after uint32, set func(Node, uint32) error) error {
+	p, err := r.parent(n)
+	if err != nil {
+		return err
+	}
+	return set(p, indexOf(n)+after)
+}
+
+// Collapses the range to its start, or to its end.
+func (r *Range) Collapse(toStart bool) {
+	if toStart {
+		r.end = r.start
+	} else {
+		r.start = r.end
+	}
+}
+
+// Selects n and its descendants.
+func (r *Range) TrySelectNode(n Node) error {
+	p, err := r.parent(n)
+	if err != nil {
+		return err
+	}
+	i := indexOf(n)
+	r.start, r.end = boundary{p, i}, boundary{p, i + 1}
+	return nil
+}
+
+// Selects the descendants of n, or all of its data.
+func (r *Range) TrySelectNodeContents(n Node) error {
+	b, err := r.boundary(n, 0)
+	if err != nil {
+		return err
+	}
+	r.start, r.end = b, boundary{n, nodeLength(n)}
+	return nil
+}
+
+// Returns -1, 0 or 1 as the boundary point of the range selected by how
+// is before, at or after the one of source.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-Range-method-compareBoundaryPoints
+func (r *Range) TryCompareBoundaryPoints(how uint, source *Range) (int, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	var a, b boundary
+	switch how {
+	case START_TO_START:
+		a, b = r.start, source.start
+	case START_TO_END:
+		a, b = r.end, source.start
+	case END_TO_END:
+		a, b = r.end, source.end
+	case END_TO_START:
+		a, b = r.start, source.end
+	default:
+		return 0, &DOMException{NOT_SUPPORTED_ERR, "unknown comparison"}
+	}
+	if rootOf(r.start.n) != rootOf(source.start.n) {
+		return 0, &DOMException{WRONG_DOCUMENT_ERR, "ranges are in different trees"}
+	}
+	return compareBoundary(a, b), nil
+}
+
+// Removes the content of the range from the tree, and returns it in a
+// fragment.  The elements that are only partly in the range are left in
+// the tree, and copied without the content outside the range.  The range
+// is collapsed to where the content was.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-Range-method-extractContents
+func (r *Range) ExtractContents() *DocumentFragment {
+	f, _ := r.TryExtractContents()
+	return f
+}
+
+func (r *Range) TryExtractContents() (*DocumentFragment, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	f, b, err := contents(r.start, r.end, true)
+	if err != nil {
+		return nil, err
+	}
+	r.start, r.end = b, b
+	return f, nil
+}
+
+// Like ExtractContents, but the content is copied and the tree is left
+// unchanged.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-Range-method-cloneContents
+func (r *Range) CloneContents() *DocumentFragment {
+	f, _ := r.TryCloneContents()
+	return f
+}
+
+func (r *Range) TryCloneContents() (*DocumentFragment, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	f, _, err := contents(r.start, r.end, false)
+	return f, err
+}
+
+// Like ExtractContents, but the content is dropped.
+func (r *Range) TryDeleteContents() error {
+	_, err := r.TryExtractContents()
+	return err
+}
+
+// Inserts n at the start of the range, splitting a text node if the range
+// starts inside one.  A range that was collapsed is extended to include
+// n.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-Range-method-insertNode
+func (r *Range) TryInsertNode(n Node) error {
+	if err := r.check(); err != nil {
+		return err
+	}
+	s := r.start
+	switch {
+	case n == nil || n == s.n:
+		return &DOMException{HIERARCHY_REQUEST_ERR, "node cannot be inserted at the start of the range"}
+	case s.n.NodeType() == COMMENT_NODE || s.n.NodeType() == PROCESSING_INSTRUCTION_NODE:
+		return &DOMException{HIERARCHY_REQUEST_ERR, "range starts in a node without children"}
+	case isTextNode(s.n) && parentOf(s.n) == nil:
+		return &DOMException{HIERARCHY_REQUEST_ERR, "range starts in a text node without a parent"}
+	}
+
+	var ref Node
+	if isTextNode(s.n) {
+		ref = s.n
+	} else {
+		ref = s.n.node().child(int(s.offset))
+	}
+	p := s.n
+	if ref != nil {
+		p = parentOf(ref)
+	}
+	if err := checkChild(p, n, nil); err != nil {
+		return err
+	}
+	switch t := s.n.(type) {
+	case *CDATASection:
+		ref = t.SplitText(s.offset)
+	case *Text:
+		ref = t.SplitText(s.offset)
+	}
+	if ref == n {
+		ref = n.NextSibling()
+	}
+	if old := parentOf(n); old != nil {
+		removeChild(old, n)
+	}
+
+	offset := nodeLength(p)
+	if ref != nil {
+		offset = indexOf(ref)
+	}
+	if n.NodeType() == DOCUMENT_FRAGMENT_NODE {
+		offset += nodeLength(n)
+	} else {
+		offset++
+	}
+	insertChild(p, n, ref)
+	if r.Collapsed() {
+		r.end = boundary{p, offset}
+	}
+	return nil
+}
+
+// Moves the content of the range into n, which replaces it in the tree,
+// and selects n.  The children of n are removed first.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-Range-method-surroundContents
+func (r *Range) TrySurroundContents(n Node) error {
+	if err := r.check(); err != nil {
+		return err
+	}
+	// only text nodes may be partly in the range
+	common := commonAncestor(r.start.n, r.end.n)
+	for _, b := range [...]boundary{r.start, r.end} {
+		for a := b.n; a != nil && a != common; a = parentOf(a) {
+			if !isTextNode(a) {
+				return &RangeException{BAD_BOUNDARYPOINTS_ERR, "range selects part of a node other than text"}
+			}
+		}
+	}
+	switch n.NodeType() {
+	case ATTRIBUTE_NODE, ENTITY_NODE, NOTATION_NODE, DOCUMENT_NODE, DOCUMENT_TYPE_NODE, DOCUMENT_FRAGMENT_NODE:
+		return &RangeException{INVALID_NODE_TYPE_ERR, strings.TrimPrefix(n.NodeName(), "#") + " cannot surround the range"}
+	}
+
+	f, err := r.TryExtractContents()
+	if err != nil {
+		return err
+	}
+	for c := n.FirstChild(); c != nil; c = n.FirstChild() {
+		removeChild(n, c)
+	}
+	if err := r.TryInsertNode(n); err != nil {
+		return err
+	}
+	insertChild(n, f, nil)
+	return r.TrySelectNode(n)
+}
+
+// Returns a copy of the range, which is also updated when the tree
+// changes.
+func (r *Range) CloneRange() *Range {
+	if r.doc == nil {
+		return &Range{r.start, r.end, nil}
+	}
+	c := &Range{r.start, r.end, r.doc}
+	r.doc.ranges = append(r.doc.ranges, c)
+	return c
+}
+
+// Returns the text in the range, from text nodes and CDATA sections only.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/ranges.html#Level2-Range-method-toString
+func (r *Range) ToString() string {
+	if r.start.n == r.end.n && isData(r.start.n) {
+		if !isTextNode(r.start.n) {
+			// the range is inside of a comment or processing instruction
+			return ""
+		}
+		s, _ := characterData(r.start.n).TrySubstringData(r.start.offset, r.end.offset-r.start.offset)
+		return s
+	}
+	var b strings.Builder
+	if isTextNode(r.start.n) {
+		b.WriteString(r.start.n.NodeValue()[r.start.offset:])
+	}
+	for n, stop := after(r.start), at(r.end); n != nil && n != stop; n = following(n, nil) {
+		if isTextNode(n) {
+			b.WriteString(n.NodeValue())
+		}
+	}
+	if isTextNode(r.end.n) {
+		b.WriteString(r.end.n.NodeValue()[:r.end.offset])
+	}
+	return b.String()
+}
+
+// Stops updating the range.  The checked methods return an
+// INVALID_STATE_ERR afterwards.
+func (r *Range) Detach() {
+	if r.doc == nil {
+		return
+	}
+	for i, other := range r.doc.ranges {
+		if other == r {
+			r.doc.ranges = append(r.doc.ranges[:i], r.doc.ranges[i+1:]...)
+			break
+		}
+	}
+	r.doc = nil
+}
+
+func (r *Range) check() error {
+	if r.doc == nil {
+		return &DOMException{INVALID_STATE_ERR, "range is detached"}
+	}
+	return nil
+}
+
+// checks that a boundary point may be at offset in n
+func (r *Range) boundary(n Node, offset uint32) (boundary, error) {
+	if err := r.check(); err != nil {
+		return boundary{}, err
+	}
+	if n == nil {
+		return boundary{}, &RangeException{INVALID_NODE_TYPE_ERR, "no node"}
+	}
+	for a := n; a != nil; a = parentOf(a) {
+		switch a.NodeType() {
+		case DOCUMENT_TYPE_NODE, ENTITY_NODE, NOTATION_NODE:
+			return boundary{}, &RangeException{INVALID_NODE_TYPE_ERR, "range cannot be inside a " + strings.TrimPrefix(a.NodeName(), "#")}
+		}
+	}
+	if offset > nodeLength(n) {
+		return boundary{}, &DOMException{INDEX_SIZE_ERR, "offset past the end of the node"}
+	}
+	return boundary{n, offset}, nil
+}
+
+// returns the parent of n, for the methods that set a boundary point next
+// to n
+func (r *Range) parent(n Node) (Node, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	var p Node
+	if n != nil {
+		p = parentOf(n)
+	}
+	if p == nil {
+		return nil, &RangeException{INVALID_NODE_TYPE_ERR, "node has no parent"}
+	}
+	return p, nil
+}
+
+// ====================================
+
+// Copies, or moves when extract is set, the content between start and end
+// into a new fragment.  Also returns where the content was.
+// http://dom.spec.whatwg.org/#concept-range-extract
+func contents(start, end boundary, extract bool) (*DocumentFragment, boundary, error) {
+	f := newFragment()
+	if d := ownerDocument(start.n); d != nil {
+		f.p = d
+	}
+	if start == end {
+		return f, start, nil
+	}
+	if start.n == end.n && isData(start.n) {
+		copyData(f, start.n, start.offset, end.offset, extract)
+		return f, start, nil
+	}
+
+	// the children of the common ancestor that are partly in the range,
+	// and those in between that are wholly in it
+	common := commonAncestor(start.n, end.n)
+	var firstPartial, lastPartial, first, stop Node
+	if contains(start.n, end.n) {
+		first = start.n.node().child(int(start.offset))
+	} else {
+		firstPartial = childContaining(common, start.n)
+		first = firstPartial.NextSibling()
+	}
+	if contains(end.n, start.n) {
+		stop = end.n.node().child(int(end.offset))
+	} else {
+		lastPartial = childContaining(common, end.n)
+		stop = lastPartial
+	}
+	for c := first; c != nil && c != stop; c = c.NextSibling() {
+		if c.NodeType() == DOCUMENT_TYPE_NODE {
+			return nil, boundary{}, &DOMException{HIERARCHY_REQUEST_ERR, "range contains a document type"}
+		}
+	}
+
+	// after extracting, the range is collapsed to just after the start
+	// boundary point, at the level of the common ancestor
+	collapsed := start
+	if firstPartial != nil {
+		ref := start.n
+		for !contains(parentOf(ref), end.n) {
+			ref = parentOf(ref)
+		}
+		collapsed = boundary{parentOf(ref), indexOf(ref) + 1}
+	}
+
+	if firstPartial != nil {
+		if isData(firstPartial) {
+			copyData(f, start.n, start.offset, nodeLength(start.n), extract)
+		} else {
+			clone := firstPartial.CloneNode(false)
+			insertChild(f, clone, nil)
+			sub, _, err := contents(start, boundary{firstPartial, nodeLength(firstPartial)}, extract)
+			if err != nil {
+				return nil, boundary{}, err
+			}
+			insertChild(clone, sub, nil)
+		}
+	}
+	for c := first; c != nil && c != stop; {
+		next := c.NextSibling()
+		if extract {
+			insertChild(f, c, nil)
+		} else {
+			insertChild(f, c.CloneNode(true), nil)
+		}
+		c = next
+	}
+	if lastPartial != nil {
+		if isData(lastPartial) {
+			copyData(f, end.n, 0, end.offset, extract)
+		} else {
+			clone := lastPartial.CloneNode(false)
+			insertChild(f, clone, nil)
+			sub, _, err := contents(boundary{lastPartial, 0}, end, extract)
+			if err != nil {
+				return nil, boundary{}, err
+			}
+			insertChild(clone, sub, nil)
+		}
+	}
+	return f, collapsed, nil
+}
+
+// appends a copy of n with the data from start to end to f, and deletes
+// that data from n when extract is set
+func copyData(f *DocumentFragment, n Node, start, end uint32, extract bool) {
+	clone := n.CloneNode(false)
+	if c := characterData(n); c != nil {
+		s, _ := c.TrySubstringData(start, end-start)
+		characterData(clone).SetData(s)
+		if extract {
+			c.DeleteData(start, end-start)
+		}
+	} else if pi, ok := n.(*ProcessingInstruction); ok {
+		clone.(*ProcessingInstruction).data = pi.data[start:end]
+		if extract {
+			pi.SetData(pi.data[:start] + pi.data[end:])
+		}
+	}
+	insertChild(f, clone, nil)
+}
+
+// the data of the node types where offsets are in the data rather than
+// the children
+func characterData(n Node) *CharacterData {
+	switch n := n.(type) {
+	case *Text:
+		return &n.CharacterData
+	case *CDATASection:
+		return &n.CharacterData
+	case *Comment:
+		return &n.CharacterData
+	case *CharacterData:
+		return n
+	}
+	return nil
+}
+
+func isData(n Node) bool {
+	return characterData(n) != nil || n.NodeType() == PROCESSING_INSTRUCTION_NODE
+}
+
+// the number of bytes of data, or of children
+func nodeLength(n Node) uint32 {
+	if c := characterData(n); c != nil {
+		return c.Length()
+	}
+	if pi, ok := n.(*ProcessingInstruction); ok {
+		return uint32(len(pi.data))
+	}
+	return uint32(n.node().count)
+}
+
+// the position of n among its siblings
+func indexOf(n Node) uint32 {
+	i := uint32(0)
+	for s := n.PreviousSibling(); s != nil; s = s.PreviousSibling() {
+		i++
+	}
+	return i
+}
+
+func rootOf(n Node) Node {
+	for p := parentOf(n); p != nil; p = parentOf(p) {
+		n = p
+	}
+	return n
+}
+
+// the deepest node that is or contains both a and b
+func commonAncestor(a, b Node) Node {
+	for ; a != nil; a = parentOf(a) {
+		if contains(a, b) {
+			return a
+		}
+	}
+	return nil
+}
+
+// the child of p that is or contains n
+func childContaining(p, n Node) Node {
+	for n != nil && parentOf(n) != p {
+		n = parentOf(n)
+	}
+	return n
+}
+
+// the first node in document order after the boundary point, and after
+// the data of a node with data
+func after(b boundary) Node {
+	if isData(b.n) {
+		return followingSibling(b.n, nil)
+	}
+	return at(b)
+}
+
+// the first node in document order at or after the boundary point,
+// without the node that contains it
+func at(b boundary) Node {
+	if isData(b.n) {
+		return b.n
+	}
+	if c := b.n.node().child(int(b.offset)); c != nil {
+		return c
+	}
+	return followingSibling(b.n, nil)
+}
+
+// Returns -1, 0 or 1 as a is before, at or after b in document order.
+// http://dom.spec.whatwg.org/#concept-range-bp-position
+func compareBoundary(a, b boundary) int {
+	switch {
+	case a.n == b.n:
+		switch {
+		case a.offset < b.offset:
+			return -1
+		case a.offset > b.offset:
+			return 1
+		}
+		return 0
+	case contains(a.n, b.n):
+		if indexOf(childContaining(a.n, b.n)) < a.offset {
+			return 1
+		}
+		return -1
+	case contains(b.n, a.n):
+		return -compareBoundary(b, a)
+	}
+	common := commonAncestor(a.n, b.n)
+	if common == nil {
+		return 0
+	}
+	cb := childContaining(common, b.n)
+	for c := childContaining(common, a.n); c != nil; c = c.NextSibling() {
+		if c == cb {
+			return -1
+		}
+	}
+	return 1
+}
+
+// ====================================
+// Keeping the ranges of a document in place when the tree changes.
+// http://dom.spec.whatwg.org/#interface-range
+
+func (r *Range) boundaries() [2]*boundary {
+	return [2]*boundary{&r.start, &r.end}
+}
+
+// The index of a child, which is only counted when a boundary point needs
+// it, as that takes time in the number of siblings before it.
+type _childIndex struct {
+	c     Node
+	i     uint32
+	known bool
+}
+
+func (x *_childIndex) get() uint32 {
+	if !x.known {
+		x.i, x.known = indexOf(x.c), true
+	}
+	return x.i
+}
+
+// called after a node is inserted at index i of p: the boundary points
+// after it move forward
+func (r *Range) inserted(p Node, i *_childIndex) {
+	for _, b := range r.boundaries() {
+		if b.n == p && b.offset > 0 && b.offset > i.get() {
+			b.offset++
+		}
+	}
+}
+
+// called before c at index i of p is removed: the boundary points inside
+// it move to where it was, and those after it move back
+func (r *Range) removing(c, p Node, i *_childIndex) {
+	for _, b := range r.boundaries() {
+		if contains(c, b.n) {
+			*b = boundary{p, i.get()}
+		} else if b.n == p && b.offset > 0 && b.offset > i.get() {
+			b.offset--
+		}
+	}
+}
+
+// called when count bytes at offset in the data of n are replaced by
+// length bytes
+func dataReplaced(n *_node, offset, count, length uint32) {
+	d := n.document()
+	if d == nil {
+		return
+	}
+	for _, r := range d.ranges {
+		for _, b := range r.boundaries() {
+			if b.n == nil || b.n.node() != n {
+				continue
+			}
+			if b.offset > offset+count {
+				b.offset = b.offset - count + length
+			} else if b.offset > offset {
+				b.offset = offset
+			}
+		}
+	}
+}
+
+// called after the data of n from offset was moved into tail, which was
+// inserted after n
+func textSplit(n Node, offset uint32, tail Node) {
+	d := ownerDocument(n)
+	if d == nil {
+		return
+	}
+	p := parentOf(n)
+	i := _childIndex{c: n}
+	for _, r := range d.ranges {
+		for _, b := range r.boundaries() {
+			if b.n == n && b.offset > offset {
+				*b = boundary{tail, b.offset - offset}
+			} else if p != nil && b.n == p && b.offset > 0 && b.offset == i.get()+1 {
+				b.offset++
+			}
+		}
+	}
+}
+
+// called before the data of next is appended to t by Normalize, where
+// offset is the length of t before
+func textMerged(t, next Node, offset uint32) {
+	d := ownerDocument(t)
+	if d == nil {
+		return
+	}
+	p, i := parentOf(next), _childIndex{c: next}
+	for _, r := range d.ranges {
+		for _, b := range r.boundaries() {
+			if b.n == next {
+				*b = boundary{t, b.offset + offset}
+			} else if b.n == p && b.offset > 0 && b.offset == i.get() {
+				*b = boundary{t, offset}
+			}
+		}
+	}
+}
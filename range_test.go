@@ -0,0 +1,281 @@
+package dom
+
+import (
+	"errors"
+	"testing"
+)
+
+func rangeExceptionCode(err error) uint {
+	var e *RangeException
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
+func checkBoundaries(t *testing.T, r *Range, start Node, startOffset uint32, end Node, endOffset uint32) {
+	if r.StartContainer() != start || r.StartOffset() != startOffset {
+		t.Errorf("Expected start (%s, %d), got (%s, %d)", start.NodeName(), startOffset,
+			r.StartContainer().NodeName(), r.StartOffset())
+	}
+	if r.EndContainer() != end || r.EndOffset() != endOffset {
+		t.Errorf("Expected end (%s, %d), got (%s, %d)", end.NodeName(), endOffset,
+			r.EndContainer().NodeName(), r.EndOffset())
+	}
+}
+
+const rangeXml = `<p>ab<b>cd</b>ef<i>gh</i></p>`
+
+// a range from the b in ab to the g in gh
+func crossingRange() (*Document, *Range) {
+	d, _ := ParseStringXml(rangeXml)
+	p := d.DocumentElement()
+	r := d.CreateRange()
+	r.SetStart(p.FirstChild(), 1)
+	r.SetEnd(p.LastChild().FirstChild(), 1)
+	return d, r
+}
+
+func TestRangeContents(t *testing.T) {
+	d, r := crossingRange()
+	p := d.DocumentElement()
+	if s := r.ToString(); s != "bcdefg" {
+		t.Errorf("ToString returned %q", s)
+	}
+	if r.CommonAncestorContainer() != p || r.Collapsed() {
+		t.Errorf("Unexpected common ancestor %v", r.CommonAncestorContainer())
+	}
+
+	// cloning leaves the tree alone
+	if s := string(r.CloneContents().ToXml()); s != `b<b>cd</b>ef<i>g</i>` {
+		t.Errorf("CloneContents returned %s", s)
+	}
+	if s := string(p.ToXml()); s != rangeXml {
+		t.Errorf("CloneContents changed the tree: %s", s)
+	}
+
+	f := r.ExtractContents()
+	if s := string(f.ToXml()); s != `b<b>cd</b>ef<i>g</i>` {
+		t.Errorf("ExtractContents returned %s", s)
+	}
+	if s := string(p.ToXml()); s != `<p>a<i>h</i></p>` {
+		t.Errorf("ExtractContents left %s", s)
+	}
+	checkBoundaries(t, r, p, 1, p, 1)
+
+	// within a single text node
+	text := p.FirstChild()
+	r.SetStart(text, 0)
+	r.SetEnd(text, 1)
+	r.DeleteContents()
+	if s := string(p.ToXml()); s != `<p><i>h</i></p>` {
+		t.Errorf("DeleteContents left %s", s)
+	}
+	checkBoundaries(t, r, text, 0, text, 0)
+
+	// selecting whole nodes
+	r.SelectNodeContents(p)
+	if s := r.ToString(); s != "h" {
+		t.Errorf("ToString of the contents of p returned %q", s)
+	}
+	r.SelectNode(p.LastChild())
+	checkBoundaries(t, r, p, 1, p, 2)
+	r.DeleteContents()
+	if s := string(p.ToXml()); s != `<p></p>` {
+		t.Errorf("DeleteContents of a node left %s", s)
+	}
+
+	// a document type cannot be extracted
+	d, _ = ParseStringXml(`<!DOCTYPE a><a/>`)
+	r = d.CreateRange()
+	r.SelectNodeContents(d)
+	if _, err := r.TryExtractContents(); exceptionCode(err) != HIERARCHY_REQUEST_ERR {
+		t.Errorf("Extracting a document type: %v", err)
+	}
+	if d.Doctype() == nil || d.DocumentElement() == nil {
+		t.Errorf("Failed extraction changed the tree")
+	}
+
+	// a range inside of a comment or processing instruction has no text
+	d, _ = ParseStringXml(`<r><!--hello-->tail<b>more</b><?pi data?></r>`)
+	r = d.CreateRange()
+	for _, n := range []Node{d.DocumentElement().FirstChild(), d.DocumentElement().LastChild()} {
+		r.SetStart(n, 1)
+		r.SetEnd(n, 3)
+		if s := r.ToString(); s != "" {
+			t.Errorf("ToString inside of %s returned %q", n.NodeName(), s)
+		}
+	}
+}
+
+func TestRangeInsertNode(t *testing.T) {
+	d, _ := ParseStringXml(`<p>abcd</p>`)
+	p := d.DocumentElement()
+	text := p.FirstChild()
+	r := d.CreateRange()
+	r.SetStart(text, 2)
+	r.Collapse(true)
+	r.InsertNode(d.CreateElement("x"))
+	if s := string(p.ToXml()); s != `<p>ab<x></x>cd</p>` {
+		t.Errorf("InsertNode gave %s", s)
+	}
+	checkBoundaries(t, r, text, 2, p, 2)
+
+	f := d.CreateDocumentFragment()
+	f.AppendChild(d.CreateElement("y"))
+	f.AppendChild(d.CreateElement("z"))
+	r.SetStart(p, 0)
+	r.Collapse(true)
+	r.InsertNode(f)
+	if s := string(p.ToXml()); s != `<p><y></y><z></z>ab<x></x>cd</p>` {
+		t.Errorf("InsertNode of a fragment gave %s", s)
+	}
+	checkBoundaries(t, r, p, 0, p, 2)
+
+	c := d.CreateComment("c")
+	p.AppendChild(c)
+	r.SetStart(c, 0)
+	if err := r.TryInsertNode(d.CreateElement("w")); exceptionCode(err) != HIERARCHY_REQUEST_ERR {
+		t.Errorf("Inserting into a comment: %v", err)
+	}
+	r.SelectNode(p)
+	if err := r.TryInsertNode(d.CreateElement("w")); exceptionCode(err) != HIERARCHY_REQUEST_ERR {
+		t.Errorf("Inserting a second root element: %v", err)
+	}
+}
+
+func TestRangeSurroundContents(t *testing.T) {
+	d, _ := ParseStringXml(`<p>abcd</p>`)
+	p := d.DocumentElement()
+	r := d.CreateRange()
+	r.SetStart(p.FirstChild(), 1)
+	r.SetEnd(p.FirstChild(), 3)
+	b := d.CreateElement("b")
+	b.AppendChild(d.CreateTextNode("old"))
+	r.SurroundContents(b)
+	if s := string(p.ToXml()); s != `<p>a<b>bc</b>d</p>` {
+		t.Errorf("SurroundContents gave %s", s)
+	}
+	checkBoundaries(t, r, p, 1, p, 2)
+
+	// b is only partly in the range
+	r.SetStart(b.FirstChild(), 1)
+	r.SetEnd(p.LastChild(), 1)
+	if err := r.TrySurroundContents(d.CreateElement("i")); rangeExceptionCode(err) != BAD_BOUNDARYPOINTS_ERR {
+		t.Errorf("Surrounding part of an element: %v", err)
+	}
+	r.SelectNode(b)
+	if err := r.TrySurroundContents(d.CreateDocumentFragment()); rangeExceptionCode(err) != INVALID_NODE_TYPE_ERR {
+		t.Errorf("Surrounding with a fragment: %v", err)
+	}
+	if s := string(p.ToXml()); s != `<p>a<b>bc</b>d</p>` {
+		t.Errorf("Failed SurroundContents changed the tree: %s", s)
+	}
+}
+
+func TestRangeBoundaries(t *testing.T) {
+	d, r := crossingRange()
+	p := d.DocumentElement()
+	ab, gh := p.FirstChild(), p.LastChild().FirstChild()
+
+	// setting the start after the end collapses the range
+	r2 := r.CloneRange()
+	r2.SetStart(gh, 2)
+	checkBoundaries(t, r2, gh, 2, gh, 2)
+	r2.SetEnd(ab, 0)
+	checkBoundaries(t, r2, ab, 0, ab, 0)
+
+	r2.SetStartAfter(p.FirstChild().NextSibling())
+	r2.SetEndBefore(p.LastChild())
+	checkBoundaries(t, r2, p, 2, p, 3)
+	test_cases := []struct {
+		how      uint
+		expected int
+	}{
+		{START_TO_START, -1},
+		{START_TO_END, 1},
+		{END_TO_END, 1},
+		{END_TO_START, -1},
+	}
+	for _, v := range test_cases {
+		if c := r.CompareBoundaryPoints(v.how, r2); c != v.expected {
+			t.Errorf("CompareBoundaryPoints(%d) returned %d, expected %d", v.how, c, v.expected)
+		}
+	}
+	if c := r2.CompareBoundaryPoints(START_TO_START, r); c != 1 {
+		t.Errorf("Reversed CompareBoundaryPoints returned %d", c)
+	}
+
+	other, _ := ParseStringXml(`<o/>`)
+	if _, err := r.TryCompareBoundaryPoints(START_TO_START, other.CreateRange()); exceptionCode(err) != WRONG_DOCUMENT_ERR {
+		t.Errorf("Comparing ranges of different documents: %v", err)
+	}
+	if err := r.TrySetStart(ab, 3); exceptionCode(err) != INDEX_SIZE_ERR {
+		t.Errorf("Offset past the end: %v", err)
+	}
+	if err := r.TrySetStartBefore(d); rangeExceptionCode(err) != INVALID_NODE_TYPE_ERR {
+		t.Errorf("Setting the start before the document: %v", err)
+	}
+	d, _ = ParseStringXml(`<!DOCTYPE a [<!ENTITY e "x">]><a/>`)
+	if err := d.CreateRange().TrySetStart(d.Doctype(), 0); rangeExceptionCode(err) != INVALID_NODE_TYPE_ERR {
+		t.Errorf("Range in a document type: %v", err)
+	}
+
+	r.Detach()
+	if err := r.TrySetStart(ab, 0); exceptionCode(err) != INVALID_STATE_ERR {
+		t.Errorf("Using a detached range: %v", err)
+	}
+}
+
+func TestRangeMutation(t *testing.T) {
+	d, r := crossingRange()
+	p := d.DocumentElement()
+	ab, i := p.FirstChild(), p.LastChild()
+	gh := i.FirstChild()
+
+	// children inserted or removed before a boundary point move it
+	other := d.CreateRange()
+	other.SetStart(p, 2)
+	other.SetEnd(p, 4)
+	p.InsertBefore(d.CreateElement("x"), p.FirstChild())
+	checkBoundaries(t, other, p, 3, p, 5)
+	p.RemoveChild(p.FirstChild())
+	checkBoundaries(t, other, p, 2, p, 4)
+
+	// changes to the data move the offsets after them
+	ab.(*Text).InsertData(0, "__")
+	gh.(*Text).DeleteData(0, 1)
+	checkBoundaries(t, r, ab, 3, gh, 0)
+	ab.(*Text).SetData("new")
+	checkBoundaries(t, r, ab, 0, gh, 0)
+
+	// splitting moves the boundary points after the offset
+	r.SetEnd(ab, 3)
+	tail := ab.(*Text).SplitText(1)
+	checkBoundaries(t, r, ab, 0, tail, 2)
+	checkBoundaries(t, other, p, 3, p, 5)
+	p.Normalize()
+	checkBoundaries(t, r, ab, 0, ab, 3)
+	checkBoundaries(t, other, p, 2, p, 4)
+
+	// removing a container moves the boundary point to where it was
+	p.RemoveChild(i)
+	checkBoundaries(t, r, ab, 0, ab, 3)
+	r.SetEnd(p, 3)
+	r.SetStart(i, 0)
+	if r.StartContainer() != i || r.EndContainer() != i {
+		t.Errorf("Range not collapsed into a removed node")
+	}
+	r.SetStart(ab, 1)
+	r.SetEnd(p, 3)
+	p.RemoveChild(ab)
+	checkBoundaries(t, r, p, 0, p, 2)
+	if s := r.ToString(); s != "cdef" {
+		t.Errorf("ToString after removal returned %q", s)
+	}
+	other.Detach()
+	r.Detach()
+	if len(d.ranges) != 0 {
+		t.Errorf("Detached ranges still registered")
+	}
+}
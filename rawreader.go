@@ -0,0 +1,197 @@
+package dom
+
+/*
+ * Access to the raw input behind the tokens of an xml.Decoder
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// The xml.Decoder reads byte by byte from an io.ByteReader.  A _rawReader
+// keeps the bytes read since the start of the current token, so that
+// details lost by the decoder, such as whether character data came from a
+// CDATA section, can be recovered.
+type _rawReader struct {
+	r         io.ByteReader
+	buf       []byte
+	off       int64 // input offset of buf[0]
+	line, col int   // position of buf[0]
+	limits    _inputLimits
+}
+
+func (r *_rawReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.buf = append(r.buf, b)
+		err = r.limits.check(b, len(r.buf))
+	}
+	return b, err
+}
+
+func (r *_rawReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if p[n], err = r.ReadByte(); err != nil {
+			break
+		}
+		n++
+	}
+	return
+}
+
+// discards the bytes before the input offset start
+func (r *_rawReader) discard(start int64) {
+	if i := start - r.off; i > 0 && i <= int64(len(r.buf)) {
+		r.line, r.col = advancePosition(r.buf[:i], r.line, r.col)
+		r.buf = r.buf[:copy(r.buf, r.buf[i:])]
+		r.off = start
+	}
+}
+
+// returns the line and column of the input offset pos, which must not
+// have been discarded
+func (r *_rawReader) position(pos int64) (int, int) {
+	if i := pos - r.off; i > 0 && i <= int64(len(r.buf)) {
+		return advancePosition(r.buf[:i], r.line, r.col)
+	}
+	return r.line, r.col
+}
+
+// returns the bytes read starting at the input offset start
+func (r *_rawReader) from(start int64) []byte {
+	if i := start - r.off; i >= 0 && i <= int64(len(r.buf)) {
+		return r.buf[i:]
+	}
+	return nil
+}
+
+// An xml.Decoder that remembers where each token started.
+type _decoder struct {
+	*xml.Decoder
+	raw    *_rawReader
+	opts   *Parser
+	limits _limits
+	start  int64 // input offset of the last token
+	origin int64 // input offset of line 1, column 1
+	nodes  int   // number of nodes created
+}
+
+func newDecoder(r io.Reader, opts *Parser) (*_decoder, error) {
+	br, err := newUTF8Reader(r, opts.CharsetReader)
+	if err != nil {
+		return nil, err
+	}
+	limits := opts.limits()
+	raw := &_rawReader{r: br, line: 1, col: 1}
+	raw.limits.token = limits.text
+	raw.limits.expansion = limits.expansion
+	p := &_decoder{Decoder: xml.NewDecoder(raw), raw: raw, opts: opts, limits: limits}
+	p.Strict = opts.Strict
+	p.AutoClose = opts.AutoClose
+	p.Entity = opts.Entity
+	// the input has already been converted
+	p.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return p, nil
+}
+
+func (p *_decoder) Token() (xml.Token, error) {
+	p.start = p.InputOffset()
+	p.raw.discard(p.start)
+	return p.Decoder.Token()
+}
+
+// returns the position of the last token
+func (p *_decoder) position() Position {
+	line, col := p.raw.line, p.raw.col
+	return Position{line, col, p.start - p.origin}
+}
+
+// returns the position reached by the decoder, where it found an error
+func (p *_decoder) errorPosition() Position {
+	off := p.InputOffset()
+	line, col := p.raw.position(off)
+	return Position{line, col, off - p.origin}
+}
+
+// makes the current input offset line 1, column 1, so that positions
+// leave out input added before the document
+func (p *_decoder) resetPosition() {
+	p.origin = p.InputOffset()
+	p.raw.discard(p.origin)
+	p.raw.line, p.raw.col = 1, 1
+}
+
+// adds the position of the error to syntax errors
+func (p *_decoder) locate(err error) error {
+	switch e := err.(type) {
+	case *SyntaxError:
+		if !e.Pos.IsValid() {
+			e.Pos = p.position()
+		}
+	case *LimitError:
+		if !e.Pos.IsValid() {
+			e.Pos = p.errorPosition()
+		}
+	case *xml.SyntaxError:
+		return &SyntaxError{Msg: e.Msg, Pos: p.errorPosition(), Err: e}
+	}
+	return err
+}
+
+// returns true if the last token was read from a CDATA section
+func (p *_decoder) isCDATA() bool {
+	return bytes.HasPrefix(p.raw.from(p.start), []byte("<![CDATA["))
+}
+
+// returns the names in the last token, which must be a start tag, as they
+// were written: the name of the element followed by those of its
+// attributes.  The decoder replaces prefixes with namespace URIs, which
+// loses the prefix when several are bound to the same URI.
+func (p *_decoder) rawNames() []string {
+	b := p.raw.from(p.start)
+	if len(b) == 0 || b[0] != '<' {
+		return nil
+	}
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\r' || c == '\n' }
+	names := []string{}
+	i := 1
+	for i < len(b) {
+		for i < len(b) && isSpace(b[i]) {
+			i++
+		}
+		if i == len(b) || b[i] == '/' || b[i] == '>' {
+			break
+		}
+		start := i
+		for i < len(b) && !isSpace(b[i]) && b[i] != '=' && b[i] != '/' && b[i] != '>' {
+			i++
+		}
+		names = append(names, string(b[start:i]))
+		for i < len(b) && isSpace(b[i]) {
+			i++
+		}
+		if i == len(b) || b[i] != '=' {
+			// an attribute without a value, in non-strict mode
+			continue
+		}
+		for i++; i < len(b) && isSpace(b[i]); i++ {
+		}
+		if i < len(b) && (b[i] == '"' || b[i] == '\'') {
+			q := b[i]
+			for i++; i < len(b) && b[i] != q; i++ {
+			}
+			i++
+		} else {
+			for i < len(b) && !isSpace(b[i]) && b[i] != '>' {
+				i++
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,411 @@
+package dom
+
+/*
+ * CSS Selectors Level 3
+ * http://www.w3.org/TR/css3-selectors/
+ *
+ * A selector is compiled once with CompileSelector and can then be
+ * matched against elements from any document.  Type selectors are matched
+ * case-insensitively against the local name, so that the same selectors
+ * work for documents from ParseHtml.
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"strings"
+)
+
+// A SelectorError is returned when a selector cannot be compiled.  Pos is
+// the byte offset into the selector where the error was found.
+type SelectorError struct {
+	Selector string
+	Pos      int
+	Msg      string
+}
+
+func (e *SelectorError) Error() string {
+	return "selector: " + e.Msg + " in '" + e.Selector + "'"
+}
+
+// A compiled group of selectors.
+type Selector struct {
+	src    string
+	groups []*complexSelector
+}
+
+// Compiles a comma separated group of selectors.
+func CompileSelector(sel string) (*Selector, error) {
+	groups, err := parseSelector(sel)
+	if err != nil {
+		return nil, err
+	}
+	return &Selector{sel, groups}, nil
+}
+
+// Like CompileSelector, but panics if the selector cannot be compiled.
+func MustCompileSelector(sel string) *Selector {
+	s, err := CompileSelector(sel)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Returns the source of the selector.
+func (s *Selector) String() string {
+	return s.src
+}
+
+// Returns true if the element matches any of the selectors in the group.
+func (s *Selector) Match(e *Element) bool {
+	for _, c := range s.groups {
+		if c.match(e, len(c.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the first descendant of n, in document order, that matches.
+func (s *Selector) Query(n Node) *Element {
+	var found *Element
+	walkElements(n, func(e *Element) bool {
+		if s.Match(e) {
+			found = e
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// Returns all the descendants of n that match, in document order.
+func (s *Selector) QueryAll(n Node) NodeList {
+	list := []Node{}
+	walkElements(n, func(e *Element) bool {
+		if s.Match(e) {
+			list = append(list, e)
+		}
+		return true
+	})
+	return newStaticNodeList(list)
+}
+
+// calls fn for each descendant element of n in document order, until fn
+// returns false
+func walkElements(n Node, fn func(*Element) bool) bool {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if e, ok := c.(*Element); ok {
+			if !fn(e) || !walkElements(e, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ====================================
+
+// a sequence of compound selectors separated by combinators
+type complexSelector struct {
+	compounds   []*compoundSelector
+	combinators []byte // one of ' ', '>', '+' or '~' between each compound
+}
+
+func (c *complexSelector) match(e *Element, i int) bool {
+	if !c.compounds[i].match(e) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c.combinators[i-1] {
+	case '>':
+		p := parentElement(e)
+		return p != nil && c.match(p, i-1)
+	case ' ':
+		for p := parentElement(e); p != nil; p = parentElement(p) {
+			if c.match(p, i-1) {
+				return true
+			}
+		}
+	case '+':
+		siblings, ix := elementSiblings(e)
+		return ix > 0 && c.match(siblings[ix-1], i-1)
+	case '~':
+		siblings, ix := elementSiblings(e)
+		for j := ix - 1; j >= 0; j-- {
+			if c.match(siblings[j], i-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// a type selector followed by any number of conditions
+type compoundSelector struct {
+	tag   string // empty for the universal selector
+	conds []selectorCond
+}
+
+func (s *compoundSelector) match(e *Element) bool {
+	if s.tag != "" && !strings.EqualFold(s.tag, e.LocalName()) {
+		return false
+	}
+	for _, c := range s.conds {
+		if !c.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+type selectorCond interface {
+	match(e *Element) bool
+}
+
+// http://www.w3.org/TR/css3-selectors/#attribute-selectors
+type attrCond struct {
+	name, op, val string
+}
+
+func (c *attrCond) match(e *Element) bool {
+	if !e.HasAttribute(c.name) {
+		return false
+	}
+	v := e.GetAttribute(c.name)
+	switch c.op {
+	case "":
+		return true
+	case "=":
+		return v == c.val
+	case "~=":
+		for _, f := range strings.Fields(v) {
+			if f == c.val {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return v == c.val || strings.HasPrefix(v, c.val+"-")
+	case "^=":
+		return c.val != "" && strings.HasPrefix(v, c.val)
+	case "$=":
+		return c.val != "" && strings.HasSuffix(v, c.val)
+	}
+	return c.val != "" && strings.Contains(v, c.val)
+}
+
+type pseudoCond func(e *Element) bool
+
+func (c pseudoCond) match(e *Element) bool { return c(e) }
+
+type notCond struct {
+	s *compoundSelector
+}
+
+func (c *notCond) match(e *Element) bool { return !c.s.match(e) }
+
+// matches the value of xml:lang or lang on the element or its ancestors
+type langCond string
+
+func (c langCond) match(e *Element) bool {
+	for ; e != nil; e = parentElement(e) {
+		lang, ok := "", false
+		if e.HasAttributeNS(XML_NAMESPACE, "lang") {
+			lang, ok = e.GetAttributeNS(XML_NAMESPACE, "lang"), true
+		} else if e.HasAttribute("lang") {
+			lang, ok = e.GetAttribute("lang"), true
+		}
+		if ok {
+			lang = strings.ToLower(lang)
+			return lang == string(c) || strings.HasPrefix(lang, string(c)+"-")
+		}
+	}
+	return false
+}
+
+// http://www.w3.org/TR/css3-selectors/#structural-pseudos
+type nthCond struct {
+	a, b   int
+	ofType bool
+	last   bool
+}
+
+func (c *nthCond) match(e *Element) bool {
+	siblings, ix := elementSiblings(e)
+	if ix < 0 {
+		return false
+	}
+	pos := 0
+	if c.last {
+		for j := ix; j < len(siblings); j++ {
+			if !c.ofType || sameElementType(siblings[j], e) {
+				pos++
+			}
+		}
+	} else {
+		for j := 0; j <= ix; j++ {
+			if !c.ofType || sameElementType(siblings[j], e) {
+				pos++
+			}
+		}
+	}
+	return nthMatches(c.a, c.b, pos)
+}
+
+// true if pos = a*n + b for some n >= 0
+func nthMatches(a, b, pos int) bool {
+	if a == 0 {
+		return pos == b
+	}
+	d := pos - b
+	return d%a == 0 && d/a >= 0
+}
+
+func sameElementType(a, b *Element) bool {
+	return a.NamespaceURI() == b.NamespaceURI() && strings.EqualFold(a.LocalName(), b.LocalName())
+}
+
+var (
+	firstChildCond  = &nthCond{0, 1, false, false}
+	lastChildCond   = &nthCond{0, 1, false, true}
+	firstOfTypeCond = &nthCond{0, 1, true, false}
+	lastOfTypeCond  = &nthCond{0, 1, true, true}
+)
+
+var selectorPseudoClasses = map[string]func(*Element) bool{
+	"root": func(e *Element) bool {
+		p := e.ParentNode()
+		return p != nil && p.NodeType() == DOCUMENT_NODE && containsChild(p, e)
+	},
+	"first-child":   firstChildCond.match,
+	"last-child":    lastChildCond.match,
+	"only-child":    func(e *Element) bool { return firstChildCond.match(e) && lastChildCond.match(e) },
+	"first-of-type": firstOfTypeCond.match,
+	"last-of-type":  lastOfTypeCond.match,
+	"only-of-type":  func(e *Element) bool { return firstOfTypeCond.match(e) && lastOfTypeCond.match(e) },
+	"empty": func(e *Element) bool {
+		for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+			switch c.NodeType() {
+			case ELEMENT_NODE, TEXT_NODE, CDATA_SECTION_NODE, ENTITY_REFERENCE_NODE:
+				if c.NodeType() != TEXT_NODE || c.NodeValue() != "" {
+					return false
+				}
+			}
+		}
+		return true
+	},
+	// UI element states, taken from the HTML attributes
+	"checked":  func(e *Element) bool { return e.HasAttribute("checked") || e.HasAttribute("selected") },
+	"disabled": func(e *Element) bool { return e.HasAttribute("disabled") },
+	"enabled": func(e *Element) bool {
+		switch strings.ToLower(e.LocalName()) {
+		case "button", "input", "select", "textarea", "option", "optgroup", "fieldset":
+			return !e.HasAttribute("disabled")
+		}
+		return false
+	},
+	// dynamic pseudo-classes never match a static document
+	"link":    func(e *Element) bool { return strings.EqualFold(e.LocalName(), "a") && e.HasAttribute("href") },
+	"visited": func(e *Element) bool { return false },
+	"hover":   func(e *Element) bool { return false },
+	"active":  func(e *Element) bool { return false },
+	"focus":   func(e *Element) bool { return false },
+	"target":  func(e *Element) bool { return false },
+}
+
+// returns the parent of e if it is an element
+func parentElement(e *Element) *Element {
+	p, _ := e.ParentNode().(*Element)
+	return p
+}
+
+// returns the element children of the parent of e, and the index of e
+// among them.  The index is -1 if e has no parent.
+func elementSiblings(e *Element) ([]*Element, int) {
+	p := e.ParentNode()
+	if p == nil {
+		return nil, -1
+	}
+	list := []*Element{}
+	ix := -1
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		if ce, ok := c.(*Element); ok {
+			if ce == e {
+				ix = len(list)
+			}
+			list = append(list, ce)
+		}
+	}
+	if ix < 0 {
+		// detached nodes refer to the owner document without being a child
+		return nil, -1
+	}
+	return list, ix
+}
+
+// ====================================
+// Convenience methods on Element and Document
+// http://www.w3.org/TR/selectors-api/
+
+// Returns the first descendant element matching the selectors, or nil.
+func (n *Element) QuerySelector(selectors string) (*Element, error) {
+	s, err := CompileSelector(selectors)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(n), nil
+}
+
+// Returns all descendant elements matching the selectors.
+func (n *Element) QuerySelectorAll(selectors string) (NodeList, error) {
+	s, err := CompileSelector(selectors)
+	if err != nil {
+		return nil, err
+	}
+	return s.QueryAll(n), nil
+}
+
+// Returns true if the element matches the selectors.
+func (n *Element) Matches(selectors string) (bool, error) {
+	s, err := CompileSelector(selectors)
+	if err != nil {
+		return false, err
+	}
+	return s.Match(n), nil
+}
+
+// Returns the element or its closest ancestor matching the selectors.
+func (n *Element) Closest(selectors string) (*Element, error) {
+	s, err := CompileSelector(selectors)
+	if err != nil {
+		return nil, err
+	}
+	for e := n; e != nil; e = parentElement(e) {
+		if s.Match(e) {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// Returns the first element in the document matching the selectors, or nil.
+func (d *Document) QuerySelector(selectors string) (*Element, error) {
+	s, err := CompileSelector(selectors)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(d), nil
+}
+
+// Returns all the elements in the document matching the selectors.
+func (d *Document) QuerySelectorAll(selectors string) (NodeList, error) {
+	s, err := CompileSelector(selectors)
+	if err != nil {
+		return nil, err
+	}
+	return s.QueryAll(d), nil
+}
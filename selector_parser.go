@@ -0,0 +1,412 @@
+package dom
+
+/*
+ * Parser for CSS Selectors Level 3
+ * http://www.w3.org/TR/css3-selectors/#w3cselgrammar
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type selectorParser struct {
+	src string
+	pos int
+}
+
+func (p *selectorParser) errorf(msg string) error {
+	return &SelectorError{p.src, p.pos, msg}
+}
+
+func (p *selectorParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *selectorParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func isSelectorSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// skips white space, returning true if any was found
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && isSelectorSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '\\' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '-' || (c >= '0' && c <= '9')
+}
+
+// reads an identifier, resolving escapes
+// http://www.w3.org/TR/css3-selectors/#lex
+func (p *selectorParser) ident() (string, error) {
+	var b strings.Builder
+	start := p.pos
+	if p.peek() == '-' {
+		b.WriteByte('-')
+		p.pos++
+	}
+	if !isIdentStart(p.peek()) {
+		p.pos = start
+		return "", p.errorf("expected an identifier")
+	}
+	for !p.eof() && isIdentChar(p.peek()) {
+		if p.peek() == '\\' {
+			r, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte(p.src[p.pos])
+		p.pos++
+	}
+	return b.String(), nil
+}
+
+func (p *selectorParser) escape() (rune, error) {
+	p.pos++ // skip the backslash
+	if p.eof() {
+		return 0, p.errorf("incomplete escape")
+	}
+	hex := 0
+	for hex < 6 && p.pos+hex < len(p.src) && strings.IndexByte("0123456789abcdefABCDEF", p.src[p.pos+hex]) >= 0 {
+		hex++
+	}
+	if hex > 0 {
+		v, _ := strconv.ParseUint(p.src[p.pos:p.pos+hex], 16, 32)
+		p.pos += hex
+		// a single white space character ends the escape
+		if !p.eof() && isSelectorSpace(p.peek()) {
+			p.pos++
+		}
+		return rune(v), nil
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return r, nil
+}
+
+func (p *selectorParser) str() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\':
+			if p.pos+1 < len(p.src) && p.src[p.pos+1] == '\n' {
+				p.pos += 2
+				continue
+			}
+			r, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func parseSelector(src string) ([]*complexSelector, error) {
+	p := &selectorParser{src: src}
+	var groups []*complexSelector
+	for {
+		p.skipSpace()
+		c, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, c)
+		p.skipSpace()
+		if p.eof() {
+			return groups, nil
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf("unexpected '" + string(p.peek()) + "'")
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) parseComplex() (*complexSelector, error) {
+	c := &complexSelector{}
+	for {
+		compound, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		c.compounds = append(c.compounds, compound)
+
+		space := p.skipSpace()
+		if p.eof() || p.peek() == ',' || p.peek() == ')' {
+			return c, nil
+		}
+		switch comb := p.peek(); comb {
+		case '>', '+', '~':
+			p.pos++
+			p.skipSpace()
+			c.combinators = append(c.combinators, comb)
+		default:
+			if !space {
+				return nil, p.errorf("unexpected '" + string(comb) + "'")
+			}
+			c.combinators = append(c.combinators, ' ')
+		}
+	}
+}
+
+func (p *selectorParser) parseCompound() (*compoundSelector, error) {
+	s := &compoundSelector{}
+	start := p.pos
+	switch {
+	case p.peek() == '*':
+		p.pos++
+	case isIdentStart(p.peek()) || p.peek() == '-':
+		tag, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		s.tag = tag
+	}
+	if p.peek() == '|' {
+		return nil, p.errorf("namespace prefixes are not supported")
+	}
+
+	for !p.eof() {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			id, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			s.conds = append(s.conds, &attrCond{"id", "=", id})
+		case '.':
+			p.pos++
+			class, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			s.conds = append(s.conds, &attrCond{"class", "~=", class})
+		case '[':
+			cond, err := p.parseAttribute()
+			if err != nil {
+				return nil, err
+			}
+			s.conds = append(s.conds, cond)
+		case ':':
+			cond, err := p.parsePseudo()
+			if err != nil {
+				return nil, err
+			}
+			s.conds = append(s.conds, cond)
+		default:
+			if p.pos == start {
+				return nil, p.errorf("expected a selector")
+			}
+			return s, nil
+		}
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a selector")
+	}
+	return s, nil
+}
+
+// reads a name, which unlike an identifier may start with a digit
+func (p *selectorParser) name() (string, error) {
+	var b strings.Builder
+	for !p.eof() && isIdentChar(p.peek()) {
+		if p.peek() == '\\' {
+			r, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte(p.src[p.pos])
+		p.pos++
+	}
+	if b.Len() == 0 {
+		return "", p.errorf("expected a name")
+	}
+	return b.String(), nil
+}
+
+func (p *selectorParser) parseAttribute() (selectorCond, error) {
+	p.pos++ // skip [
+	p.skipSpace()
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	// allow qualified attribute names such as xml:lang written as xml|lang
+	if p.peek() == '|' && p.pos+1 < len(p.src) && p.src[p.pos+1] != '=' {
+		p.pos++
+		local, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		name = name + ":" + local
+	}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return &attrCond{name, "", ""}, nil
+	}
+
+	var op string
+	switch {
+	case p.peek() == '=':
+		op = "="
+		p.pos++
+	case strings.HasPrefix(p.src[p.pos:], "~=") || strings.HasPrefix(p.src[p.pos:], "|=") ||
+		strings.HasPrefix(p.src[p.pos:], "^=") || strings.HasPrefix(p.src[p.pos:], "$=") ||
+		strings.HasPrefix(p.src[p.pos:], "*="):
+		op = p.src[p.pos : p.pos+2]
+		p.pos += 2
+	default:
+		return nil, p.errorf("expected an attribute operator")
+	}
+	p.skipSpace()
+
+	var val string
+	if c := p.peek(); c == '"' || c == '\'' {
+		val, err = p.str()
+	} else {
+		val, err = p.ident()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() != ']' {
+		return nil, p.errorf("expected ']'")
+	}
+	p.pos++
+	return &attrCond{name, op, val}, nil
+}
+
+func (p *selectorParser) parsePseudo() (selectorCond, error) {
+	p.pos++ // skip :
+	if p.peek() == ':' {
+		return nil, p.errorf("pseudo-elements are not supported")
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+
+	if p.peek() != '(' {
+		switch name {
+		case "first-line", "first-letter", "before", "after":
+			return nil, p.errorf("pseudo-elements are not supported")
+		}
+		fn, ok := selectorPseudoClasses[name]
+		if !ok {
+			return nil, p.errorf("unknown pseudo-class :" + name)
+		}
+		return pseudoCond(fn), nil
+	}
+
+	p.pos++ // skip (
+	p.skipSpace()
+	var cond selectorCond
+	switch name {
+	case "not":
+		inner, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		cond = &notCond{inner}
+	case "lang":
+		lang, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		cond = langCond(strings.ToLower(lang))
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		end := strings.IndexByte(p.src[p.pos:], ')')
+		if end < 0 {
+			return nil, p.errorf("expected ')'")
+		}
+		a, b, ok := parseNth(p.src[p.pos : p.pos+end])
+		if !ok {
+			return nil, p.errorf("invalid an+b expression")
+		}
+		p.pos += end
+		cond = &nthCond{a, b, strings.HasSuffix(name, "of-type"), strings.Contains(name, "last")}
+	default:
+		return nil, p.errorf("unknown functional pseudo-class :" + name + "()")
+	}
+	p.skipSpace()
+	if p.peek() != ')' {
+		return nil, p.errorf("expected ')'")
+	}
+	p.pos++
+	return cond, nil
+}
+
+// parses the an+b argument of the :nth-* pseudo-classes
+// http://www.w3.org/TR/css3-selectors/#nth-child-pseudo
+func parseNth(s string) (a, b int, ok bool) {
+	var err error
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return 2, 1, true
+	case "even":
+		return 2, 0, true
+	}
+	if i := strings.IndexByte(s, 'n'); i >= 0 {
+		switch coef := s[:i]; coef {
+		case "", "+":
+			a = 1
+		case "-":
+			a = -1
+		default:
+			if a, err = strconv.Atoi(coef); err != nil {
+				return 0, 0, false
+			}
+		}
+		s = s[i+1:]
+		if s == "" {
+			return a, 0, true
+		}
+		if s[0] != '+' && s[0] != '-' {
+			return 0, 0, false
+		}
+	}
+	if b, err = strconv.Atoi(s); err != nil {
+		return 0, 0, false
+	}
+	return a, b, true
+}
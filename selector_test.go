@@ -0,0 +1,174 @@
+package dom
+
+import (
+	"testing"
+)
+
+const selectorDoc = `<html><body>
+<div id="main" class="content wide">
+<p class="intro first">Intro</p>
+<p lang="en-US">One</p>
+<span>Aside</span>
+<p data-x="a b c">Two</p>
+<ul><li>1</li><li class="odd">2</li><li>3</li><li>4</li><li>5</li></ul>
+<input type="checkbox" checked="checked" /><input type="text" disabled="disabled" />
+<a href="http://example.com/index.html">link</a>
+<em></em>
+</div>
+<div id="footer"><p>Footer</p></div>
+</body></html>`
+
+func selectIds(t *testing.T, d *Document, sel string) []string {
+	nl, err := d.QuerySelectorAll(sel)
+	if err != nil {
+		t.Fatalf("Error compiling selector %s (%v).", sel, err)
+	}
+	ids := []string{}
+	for i := uint(0); i < nl.Length(); i++ {
+		e := nl.Item(i).(*Element)
+		ids = append(ids, e.NodeName()+":"+string(e.ToText(false)))
+	}
+	return ids
+}
+
+func TestSelectorQuerySelectorAll(t *testing.T) {
+	d, err := ParseStringHtml(selectorDoc)
+	if err != nil {
+		t.Fatalf("Error parsing document (%v).", err)
+	}
+	test_cases := []struct {
+		sel   string
+		count int
+		first string
+	}{
+		{"p", 4, "p:Intro"},
+		{"P", 4, "p:Intro"},
+		{"*", 19, ""},
+		{"#main > p", 3, "p:Intro"},
+		{"div p", 4, "p:Intro"},
+		{".intro", 1, "p:Intro"},
+		{"p.intro.first", 1, "p:Intro"},
+		{"p.intro.missing", 0, ""},
+		{"[data-x~=b]", 1, "p:Two"},
+		{"[lang|=en]", 1, "p:One"},
+		{"a[href^='http://']", 1, "a:link"},
+		{"a[href$=\".html\"]", 1, "a:link"},
+		{"a[href*=example]", 1, "a:link"},
+		{"[class]", 3, ""},
+		{"p + span", 1, "span:Aside"},
+		{"span ~ p", 1, "p:Two"},
+		{"li:nth-child(2n+1)", 3, "li:1"},
+		{"li:nth-child(odd)", 3, "li:1"},
+		{"li:nth-child(even)", 2, "li:2"},
+		{"li:nth-child(-n + 2)", 2, "li:1"},
+		{"li:nth-last-child(1)", 1, "li:5"},
+		{"li:first-child", 1, "li:1"},
+		{"li:last-child", 1, "li:5"},
+		{"p:first-of-type", 2, "p:Intro"},
+		{"p:last-of-type", 2, "p:Two"},
+		{"p:nth-of-type(2)", 1, "p:One"},
+		{"span:only-of-type", 1, "span:Aside"},
+		{"div > p:only-child", 1, "p:Footer"},
+		{"li:not(.odd)", 4, "li:1"},
+		{"p:not([lang]):not(.intro)", 2, "p:Two"},
+		{":root", 1, ""},
+		{"em:empty", 1, ""},
+		{"input:checked", 1, ""},
+		{"input:disabled", 1, ""},
+		{"input:enabled", 1, ""},
+		{"p:lang(en)", 1, "p:One"},
+		{"ul, span", 2, "span:Aside"},
+		{"#footer p, #main .intro", 2, "p:Intro"},
+		{"li:hover", 0, ""},
+	}
+	for _, tc := range test_cases {
+		ids := selectIds(t, d, tc.sel)
+		if len(ids) != tc.count {
+			t.Errorf("%s matched %d elements instead of %d (%v)", tc.sel, len(ids), tc.count, ids)
+			continue
+		}
+		if tc.first != "" && ids[0] != tc.first {
+			t.Errorf("%s matched %s first instead of %s", tc.sel, ids[0], tc.first)
+		}
+	}
+}
+
+func TestSelectorQuerySelector(t *testing.T) {
+	d, _ := ParseStringHtml(selectorDoc)
+	main, _ := d.QuerySelector("#main")
+	if main == nil || main.GetAttribute("id") != "main" {
+		t.Fatalf("Document.QuerySelector() did not find the element")
+	}
+	p, err := main.QuerySelector("p:nth-child(2)")
+	if err != nil || p == nil || string(p.ToText(false)) != "One" {
+		t.Errorf("Element.QuerySelector() did not find the element")
+	}
+	// selectors are matched against the whole document, but only
+	// descendants are returned
+	nl, _ := main.QuerySelectorAll("body div p")
+	if nl.Length() != 3 {
+		t.Errorf("Element.QuerySelectorAll() returned %d elements instead of 3", nl.Length())
+	}
+	none, _ := main.QuerySelector("#footer")
+	if none != nil {
+		t.Errorf("Element.QuerySelector() returned an element outside the subtree")
+	}
+}
+
+func TestSelectorMatchesClosest(t *testing.T) {
+	d, _ := ParseStringHtml(selectorDoc)
+	li, _ := d.QuerySelector("li.odd")
+	if ok, _ := li.Matches("ul > li:nth-child(2)"); !ok {
+		t.Errorf("Element.Matches() returned false for a matching selector")
+	}
+	if ok, _ := li.Matches("li:first-child"); ok {
+		t.Errorf("Element.Matches() returned true for a selector that does not match")
+	}
+	div, _ := li.Closest("div")
+	if div == nil || div.GetAttribute("id") != "main" {
+		t.Errorf("Element.Closest() did not return the ancestor")
+	}
+	self, _ := li.Closest(".odd")
+	if self != li {
+		t.Errorf("Element.Closest() did not consider the element itself")
+	}
+	none, _ := li.Closest("table")
+	if none != nil {
+		t.Errorf("Element.Closest() returned an element for a selector that does not match")
+	}
+}
+
+func TestSelectorCompileOnce(t *testing.T) {
+	s := MustCompileSelector("b")
+	d1, _ := ParseStringXml(`<a><b/><b/></a>`)
+	d2, _ := ParseStringXml(`<a><c><b/></c></a>`)
+	if s.QueryAll(d1).Length() != 2 || s.QueryAll(d2).Length() != 1 {
+		t.Errorf("Compiled selector not reusable across documents")
+	}
+	if s.String() != "b" {
+		t.Errorf("Selector.String() did not return the selector")
+	}
+}
+
+func TestSelectorEscapes(t *testing.T) {
+	d, _ := ParseStringXml(`<r><a id="x.y"/><a class="1st"/></r>`)
+	if n, _ := d.QuerySelectorAll(`#x\.y`); n.Length() != 1 {
+		t.Errorf("Escaped identifier not matched")
+	}
+	if n, _ := d.QuerySelectorAll(`.\31 st`); n.Length() != 1 {
+		t.Errorf("Hex escape not matched")
+	}
+}
+
+func TestSelectorErrors(t *testing.T) {
+	bad := []string{"", "p >", "> p", "p,", "[x", "[x=]", "p::before", ":first-line", ":bogus", "li:nth-child(2x)", "a|b", ":not(p", "p $ q"}
+	for _, sel := range bad {
+		if _, err := CompileSelector(sel); err == nil {
+			t.Errorf("Compiled invalid selector '%s'", sel)
+		}
+	}
+	d, _ := ParseStringXml(`<r/>`)
+	if _, err := d.QuerySelector("[x"); err == nil {
+		t.Errorf("Document.QuerySelector() did not return an error for an invalid selector")
+	}
+}
@@ -10,6 +10,8 @@ package dom
 
 import (
 	"encoding/xml"
+	"io"
+	"strings"
 )
 
 type Text struct {
@@ -19,12 +21,108 @@ type Text struct {
 func (n *Text) NodeType() uint           { return TEXT_NODE }
 func (n *Text) NodeName() (s string)     { return "#text" }
 func (n *Text) NodeValue() (s string)    { return string(n.content) }
-func (n *Text) PreviousSibling() Node    { return previousSibling(Node(n), n.p.ChildNodes()) }
-func (n *Text) NextSibling() Node        { return nextSibling(Node(n), n.p.ChildNodes()) }
 func (n *Text) OwnerDocument() *Document { return ownerDocument(n) }
+func (n *Text) CloneNode(deep bool) Node { return cloneNode(n, deep, n.OwnerDocument()) }
+func (n *Text) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
 
 func newText(token xml.CharData) *Text {
 	n := new(Text)
 	n.content = token.Copy()
 	return n
 }
+
+// Splits the node in two at offset, in bytes, and returns the new node
+// holding the rest of the text.  When the node is in the tree, the new
+// node is inserted after it.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#ID-38853C1D
+func (n *Text) SplitText(offset uint32) *Text {
+	t, _ := n.TrySplitText(offset)
+	return t
+}
+
+// Like SplitText, but returns a DOMException when offset is past the end
+// of the text.
+func (n *Text) TrySplitText(offset uint32) (*Text, error) {
+	t := newText(nil)
+	if err := splitText(n, &n.CharacterData, offset, t, &t.CharacterData); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Returns the text of the node and of the text nodes and CDATA sections
+// next to it, in document order.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Text3-wholeText
+func (n *Text) WholeText() string {
+	start := Node(n)
+	for p := n.PreviousSibling(); p != nil && isTextNode(p); p = p.PreviousSibling() {
+		start = p
+	}
+	var b strings.Builder
+	for c := start; c != nil && isTextNode(c); c = c.NextSibling() {
+		b.WriteString(c.NodeValue())
+	}
+	return b.String()
+}
+
+// Replaces the text of the node, and removes the text nodes and CDATA
+// sections next to it.  An empty content removes the node as well, and
+// nil is returned.
+// http://www.w3.org/TR/DOM-Level-3-Core/core.html#Text3-replaceWholeText
+func (n *Text) ReplaceWholeText(content string) *Text {
+	if !replaceWholeText(&n._node, content) {
+		return nil
+	}
+	n.SetData(content)
+	return n
+}
+
+func isTextNode(n Node) bool {
+	t := n.NodeType()
+	return t == TEXT_NODE || t == CDATA_SECTION_NODE
+}
+
+// moves the text from offset into tail, which is inserted after self
+func splitText(self Node, data *CharacterData, offset uint32, tail Node, tailData *CharacterData) error {
+	if _, _, err := data.dataRange(offset, 0); err != nil {
+		return err
+	}
+	tailData.content = append([]byte(nil), data.content[offset:]...)
+	dataChanging(&data._node, data.Data)
+	data.content = data.content[:offset]
+	if p := self.ParentNode(); p != nil && p.node().hasChild(self) {
+		insertChild(p, tail, self.NextSibling())
+	} else if d := ownerDocument(self); d != nil {
+		tail.setParent(d)
+	}
+	textSplit(self, offset, tail)
+	return nil
+}
+
+// removes the text nodes next to n, and n itself when content is empty.
+// Returns whether n is kept.
+func replaceWholeText(n *_node, content string) bool {
+	p := n.p
+	if p == nil {
+		return content != ""
+	}
+	var remove []Node
+	for c := n.prev; c != nil && isTextNode(c); c = c.PreviousSibling() {
+		remove = append(remove, c)
+	}
+	for c := n.next; c != nil && isTextNode(c); c = c.NextSibling() {
+		remove = append(remove, c)
+	}
+	if content == "" {
+		// n is removed through the node its parent refers to
+		if self := n.self(); self != nil {
+			remove = append(remove, self)
+		}
+	}
+	for _, c := range remove {
+		removeChild(p, c)
+	}
+	return content != ""
+}
@@ -44,3 +44,106 @@ func TestTextNodeSubstring(t *testing.T) {
 		t.Errorf("Did not get the correct node value for a text node (got %#v)", nval)
 	}
 }
+
+func TestNormalize(t *testing.T) {
+	d, _ := ParseStringXml(`<a>x<b>1</b><![CDATA[c]]></a>`)
+	a := d.DocumentElement()
+	b := a.FirstChild().NextSibling()
+	a.InsertBefore(d.CreateTextNode("y"), b)
+	a.InsertBefore(d.CreateTextNode(""), b)
+	a.InsertBefore(d.CreateTextNode("z"), b)
+	b.AppendChild(d.CreateTextNode("2"))
+	b.AppendChild(d.CreateTextNode(""))
+	a.AppendChild(d.CreateTextNode("w"))
+	a.AppendChild(d.CreateTextNode(""))
+	e := d.CreateElement("e")
+	e.AppendChild(d.CreateTextNode(""))
+	a.AppendChild(e)
+
+	d.Normalize()
+	test_cases := []struct {
+		n     Node
+		count uint
+	}{
+		{a, 5},
+		{b, 1},
+		{e, 0},
+	}
+	for _, v := range test_cases {
+		if c := v.n.ChildNodes().Length(); c != v.count {
+			t.Errorf("%s has %d children instead of %d", v.n.NodeName(), c, v.count)
+		}
+	}
+	if s := string(d.ToXml()); s != `<a>xyz<b>12</b><![CDATA[c]]>w<e></e></a>` {
+		t.Errorf("Unexpected document %s", s)
+	}
+	if a.FirstChild().NodeValue() != "xyz" || b.FirstChild().NodeValue() != "12" {
+		t.Errorf("Text not merged")
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	d, _ := ParseStringXml(`<a>hello world<b/></a>`)
+	a := d.DocumentElement()
+	text := a.FirstChild().(*Text)
+	tail := text.SplitText(5)
+	if text.Data() != "hello" || tail.Data() != " world" {
+		t.Errorf("Split into %q and %q", text.Data(), tail.Data())
+	}
+	if text.NextSibling() != tail || tail.NextSibling() != a.LastChild() || tail.ParentNode() != a {
+		t.Errorf("New node not inserted after the text")
+	}
+	if s := string(d.ToXml()); s != "<a>hello world<b></b></a>" {
+		t.Errorf("Unexpected document %s", s)
+	}
+	if end := tail.SplitText(6); end.Data() != "" || tail.Data() != " world" {
+		t.Errorf("Split at the end gave %q", end.Data())
+	}
+	if _, err := text.TrySplitText(6); exceptionCode(err) != INDEX_SIZE_ERR {
+		t.Errorf("Split past the end: %v", err)
+	}
+
+	// detached nodes, and CDATA sections
+	c := d.CreateCDATASection("abcd")
+	ct := c.SplitText(1)
+	if ct.NodeType() != CDATA_SECTION_NODE || ct.Data() != "bcd" || ct.OwnerDocument() != d || ct.ParentNode() == a {
+		t.Errorf("Unexpected split of a CDATA section")
+	}
+}
+
+func TestWholeText(t *testing.T) {
+	d, _ := ParseStringXml(`<a>one<![CDATA[two]]>three<b/>four</a>`)
+	a := d.DocumentElement()
+	two := a.FirstChild().NextSibling().(*CDATASection)
+	three := two.NextSibling().(*Text)
+	four := a.LastChild().(*Text)
+	if s := three.WholeText(); s != "onetwothree" {
+		t.Errorf("WholeText gave %q", s)
+	}
+	if s := two.WholeText(); s != "onetwothree" {
+		t.Errorf("WholeText of a CDATA section gave %q", s)
+	}
+	if s := four.WholeText(); s != "four" {
+		t.Errorf("WholeText gave %q", s)
+	}
+
+	if r := three.ReplaceWholeText("3"); r != three || a.FirstChild() != three || three.Data() != "3" {
+		t.Errorf("ReplaceWholeText returned %v", r)
+	}
+	if s := string(d.ToXml()); s != "<a>3<b></b>four</a>" {
+		t.Errorf("Unexpected document %s", s)
+	}
+	if r := four.ReplaceWholeText(""); r != nil || four.ParentNode() != nil || a.LastChild().NodeName() != "b" {
+		t.Errorf("ReplaceWholeText with no content returned %v", r)
+	}
+
+	c := d.CreateCDATASection("x")
+	a.AppendChild(c)
+	a.AppendChild(d.CreateTextNode("y"))
+	if r := c.ReplaceWholeText("z"); r != c || a.LastChild() != c {
+		t.Errorf("ReplaceWholeText of a CDATA section returned %v", r)
+	}
+	if r := c.ReplaceWholeText(""); r != nil || a.LastChild().NodeName() != "b" {
+		t.Errorf("CDATA section not removed")
+	}
+}
@@ -0,0 +1,408 @@
+package dom
+
+/*
+ * NodeIterator and TreeWalker from DOM Level 2 Traversal
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+// Flags for the whatToShow mask of a NodeIterator or a TreeWalker.  The
+// flag of a node type t is 1 << (t-1).
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/traversal.html#Traversal-NodeFilter
+const (
+	SHOW_ELEMENT = 1 << iota
+	SHOW_ATTRIBUTE
+	SHOW_TEXT
+	SHOW_CDATA_SECTION
+	SHOW_ENTITY_REFERENCE
+	SHOW_ENTITY
+	SHOW_PROCESSING_INSTRUCTION
+	SHOW_COMMENT
+	SHOW_DOCUMENT
+	SHOW_DOCUMENT_TYPE
+	SHOW_DOCUMENT_FRAGMENT
+	SHOW_NOTATION
+	SHOW_ALL = 0xFFFFFFFF
+)
+
+// Results of NodeFilter.AcceptNode.  A NodeIterator treats FILTER_REJECT
+// like FILTER_SKIP, while a TreeWalker also skips the children of a
+// rejected node.
+const (
+	_             = iota // ignore first value
+	FILTER_ACCEPT = iota
+	FILTER_REJECT
+	FILTER_SKIP
+)
+
+// A NodeFilter decides which of the nodes selected by whatToShow are
+// returned by a NodeIterator or a TreeWalker.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/traversal.html#Traversal-NodeFilter
+type NodeFilter interface {
+	AcceptNode(n Node) uint
+}
+
+// Adapts a function to the NodeFilter interface.
+type NodeFilterFunc func(n Node) uint
+
+func (f NodeFilterFunc) AcceptNode(n Node) uint {
+	return f(n)
+}
+
+// the state shared by NodeIterator and TreeWalker
+type _traversal struct {
+	root       Node
+	whatToShow uint
+	filter     NodeFilter
+}
+
+func (t *_traversal) Root() Node         { return t.root }
+func (t *_traversal) WhatToShow() uint   { return t.whatToShow }
+func (t *_traversal) Filter() NodeFilter { return t.filter }
+
+func (t *_traversal) accept(n Node) uint {
+	if t.whatToShow&(1<<(n.NodeType()-1)) == 0 {
+		return FILTER_SKIP
+	}
+	if t.filter == nil {
+		return FILTER_ACCEPT
+	}
+	return t.filter.AcceptNode(n)
+}
+
+// A NodeIterator returns the nodes of a subtree in document order.  It
+// stays valid when the tree is changed: removing the node it is at moves
+// it to a neighbour that is still in the subtree.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/traversal.html#Traversal-NodeIterator
+type NodeIterator struct {
+	_traversal
+	reference Node      // the node the iterator is at
+	before    bool      // whether the iterator is before or after reference
+	doc       *Document // notifies the iterator of removals, nil once detached
+}
+
+// Returns the next node, or nil at the end of the subtree.
+func (it *NodeIterator) NextNode() Node {
+	return it.traverse(true)
+}
+
+// Returns the previous node, or nil at the start of the subtree.
+func (it *NodeIterator) PreviousNode() Node {
+	return it.traverse(false)
+}
+
+// Releases the iterator, so that it is no longer updated when the tree
+// changes.  NextNode and PreviousNode return nil afterwards.
+func (it *NodeIterator) Detach() {
+	if it.doc == nil {
+		return
+	}
+	for i, other := range it.doc.iterators {
+		if other == it {
+			it.doc.iterators = append(it.doc.iterators[:i], it.doc.iterators[i+1:]...)
+			break
+		}
+	}
+	it.doc = nil
+	it.reference = nil
+}
+
+func (it *NodeIterator) traverse(next bool) Node {
+	n, before := it.reference, it.before
+	if n == nil {
+		return nil
+	}
+	for {
+		if next {
+			if !before {
+				if n = following(n, it.root); n == nil {
+					return nil
+				}
+			}
+			before = false
+		} else {
+			if before {
+				if n = preceding(n, it.root); n == nil {
+					return nil
+				}
+			}
+			before = true
+		}
+		if it.accept(n) == FILTER_ACCEPT {
+			break
+		}
+	}
+	it.reference, it.before = n, before
+	return n
+}
+
+// called before c is unlinked from its parent
+// http://dom.spec.whatwg.org/#nodeiterator-pre-removing-steps
+func (it *NodeIterator) removing(c Node) {
+	if c == it.root || !contains(it.root, c) || !contains(c, it.reference) {
+		return
+	}
+	if it.before {
+		if n := followingSibling(c, it.root); n != nil {
+			it.reference = n
+			return
+		}
+		it.before = false
+	}
+	if prev := c.PreviousSibling(); prev != nil {
+		it.reference = lastDescendant(prev)
+	} else {
+		it.reference = parentOf(c)
+	}
+}
+
+// Returns an iterator over root and its descendants, which belong to the
+// document.  Only the nodes whose type is in whatToShow and that are
+// accepted by filter are returned; filter may be nil.  The iterator is
+// updated when nodes are removed until it is detached.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/traversal.html#NodeIteratorFactory-createNodeIterator
+func (d *Document) CreateNodeIterator(root Node, whatToShow uint, filter NodeFilter) *NodeIterator {
+	if root == nil {
+		return nil
+	}
+	it := &NodeIterator{_traversal{root, whatToShow, filter}, root, true, d}
+	d.iterators = append(d.iterators, it)
+	return it
+}
+
+// A TreeWalker moves around a subtree, going only to the nodes that are
+// accepted.  The tree may be changed freely, as all moves are relative to
+// the current node.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/traversal.html#Traversal-TreeWalker
+type TreeWalker struct {
+	_traversal
+	current Node
+}
+
+// Returns a walker over root and its descendants, starting at root.  Only
+// the nodes whose type is in whatToShow and that are accepted by filter
+// are visited; filter may be nil.
+// DOM2: http://www.w3.org/TR/DOM-Level-2-Traversal-Range/traversal.html#NodeIteratorFactory-createTreeWalker
+func (d *Document) CreateTreeWalker(root Node, whatToShow uint, filter NodeFilter) *TreeWalker {
+	if root == nil {
+		return nil
+	}
+	return &TreeWalker{_traversal{root, whatToShow, filter}, root}
+}
+
+func (w *TreeWalker) CurrentNode() Node {
+	return w.current
+}
+
+// Moves the walker to n, which need not be accepted or in the subtree.
+// Setting nil is ignored.
+func (w *TreeWalker) SetCurrentNode(n Node) {
+	if n != nil {
+		w.current = n
+	}
+}
+
+// Moves to the closest accepted ancestor within the subtree, and returns
+// it, or nil.
+func (w *TreeWalker) ParentNode() Node {
+	for n := w.current; n != nil && n != w.root; {
+		if n = parentOf(n); n != nil && w.accept(n) == FILTER_ACCEPT {
+			w.current = n
+			return n
+		}
+	}
+	return nil
+}
+
+func (w *TreeWalker) FirstChild() Node {
+	return w.traverseChildren(true)
+}
+
+func (w *TreeWalker) LastChild() Node {
+	return w.traverseChildren(false)
+}
+
+func (w *TreeWalker) NextSibling() Node {
+	return w.traverseSiblings(true)
+}
+
+func (w *TreeWalker) PreviousSibling() Node {
+	return w.traverseSiblings(false)
+}
+
+// Moves to the previous accepted node in document order.
+func (w *TreeWalker) PreviousNode() Node {
+	n := w.current
+	for n != w.root {
+		for sibling := n.PreviousSibling(); sibling != nil; sibling = n.PreviousSibling() {
+			n = sibling
+			r := w.accept(n)
+			for r != FILTER_REJECT && n.LastChild() != nil {
+				n = n.LastChild()
+				r = w.accept(n)
+			}
+			if r == FILTER_ACCEPT {
+				w.current = n
+				return n
+			}
+		}
+		if n = parentOf(n); n == nil {
+			return nil
+		}
+		if w.accept(n) == FILTER_ACCEPT {
+			w.current = n
+			return n
+		}
+	}
+	return nil
+}
+
+// Moves to the next accepted node in document order.
+func (w *TreeWalker) NextNode() Node {
+	n, r := w.current, uint(FILTER_ACCEPT)
+	for {
+		for r != FILTER_REJECT && n.FirstChild() != nil {
+			n = n.FirstChild()
+			if r = w.accept(n); r == FILTER_ACCEPT {
+				w.current = n
+				return n
+			}
+		}
+		if n = followingSibling(n, w.root); n == nil {
+			return nil
+		}
+		if r = w.accept(n); r == FILTER_ACCEPT {
+			w.current = n
+			return n
+		}
+	}
+}
+
+// http://dom.spec.whatwg.org/#concept-traverse-children
+func (w *TreeWalker) traverseChildren(first bool) Node {
+	n := w.current.LastChild()
+	if first {
+		n = w.current.FirstChild()
+	}
+	for n != nil {
+		r := w.accept(n)
+		if r == FILTER_ACCEPT {
+			w.current = n
+			return n
+		}
+		if r == FILTER_SKIP {
+			if c := childAt(n, first); c != nil {
+				n = c
+				continue
+			}
+		}
+		for n != nil {
+			if s := siblingOf(n, first); s != nil {
+				n = s
+				break
+			}
+			p := parentOf(n)
+			if p == nil || p == w.root || p == w.current {
+				return nil
+			}
+			n = p
+		}
+	}
+	return nil
+}
+
+// http://dom.spec.whatwg.org/#concept-traverse-siblings
+func (w *TreeWalker) traverseSiblings(next bool) Node {
+	n := w.current
+	if n == w.root {
+		return nil
+	}
+	for {
+		for s := siblingOf(n, next); s != nil; {
+			n = s
+			r := w.accept(n)
+			if r == FILTER_ACCEPT {
+				w.current = n
+				return n
+			}
+			if s = childAt(n, next); r == FILTER_REJECT || s == nil {
+				s = siblingOf(n, next)
+			}
+		}
+		if n = parentOf(n); n == nil || n == w.root || w.accept(n) == FILTER_ACCEPT {
+			return nil
+		}
+	}
+}
+
+// ====================================
+
+// the parent that n is a child of, which is nil for the nodes from the
+// Create methods
+func parentOf(n Node) Node {
+	if p := n.ParentNode(); p != nil && p.node().hasChild(n) {
+		return p
+	}
+	return nil
+}
+
+// reports whether n is a or one of its descendants
+func contains(a, n Node) bool {
+	for ; n != nil; n = parentOf(n) {
+		if n == a {
+			return true
+		}
+	}
+	return false
+}
+
+func childAt(n Node, first bool) Node {
+	if first {
+		return n.FirstChild()
+	}
+	return n.LastChild()
+}
+
+func siblingOf(n Node, next bool) Node {
+	if next {
+		return n.NextSibling()
+	}
+	return n.PreviousSibling()
+}
+
+func lastDescendant(n Node) Node {
+	for c := n.LastChild(); c != nil; c = n.LastChild() {
+		n = c
+	}
+	return n
+}
+
+// the node after n in document order within root, or nil
+func following(n, root Node) Node {
+	if c := n.FirstChild(); c != nil {
+		return c
+	}
+	return followingSibling(n, root)
+}
+
+// the node after n and its descendants in document order within root, or
+// nil
+func followingSibling(n, root Node) Node {
+	for ; n != nil && n != root; n = parentOf(n) {
+		if s := n.NextSibling(); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// the node before n in document order within root, or nil
+func preceding(n, root Node) Node {
+	if n == root {
+		return nil
+	}
+	if s := n.PreviousSibling(); s != nil {
+		return lastDescendant(s)
+	}
+	return parentOf(n)
+}
@@ -0,0 +1,174 @@
+package dom
+
+import (
+	"testing"
+)
+
+const traversalXml = `<a><b><c/>text<d/></b><!--comment--><e><f/></e></a>`
+
+// the names of the nodes returned by next until it returns nil
+func collect(next func() Node) string {
+	s := ""
+	for n := next(); n != nil; n = next() {
+		s += n.NodeName() + " "
+	}
+	return s
+}
+
+// rejects or skips the nodes with the given name
+func filterName(name string, result uint) NodeFilter {
+	return NodeFilterFunc(func(n Node) uint {
+		if n.NodeName() == name {
+			return result
+		}
+		return FILTER_ACCEPT
+	})
+}
+
+func TestNodeIterator(t *testing.T) {
+	d, _ := ParseStringXml(traversalXml)
+	b := d.DocumentElement().FirstChild()
+	test_cases := []struct {
+		root       Node
+		whatToShow uint
+		filter     NodeFilter
+		expected   string
+	}{
+		{d, SHOW_ALL, nil, "#document a b c #text d #comment e f "},
+		{d, SHOW_ELEMENT, nil, "a b c d e f "},
+		{d, SHOW_TEXT | SHOW_COMMENT, nil, "#text #comment "},
+		{b, SHOW_ALL, nil, "b c #text d "},
+		{d, SHOW_ELEMENT, filterName("b", FILTER_REJECT), "a c d e f "},
+		{d, SHOW_ELEMENT, filterName("b", FILTER_SKIP), "a c d e f "},
+		{d.DocumentElement().LastChild().FirstChild(), SHOW_ALL, nil, "f "},
+	}
+	for _, v := range test_cases {
+		it := d.CreateNodeIterator(v.root, v.whatToShow, v.filter)
+		if s := collect(it.NextNode); s != v.expected {
+			t.Errorf("NextNode from %s returned %q, expected %q", v.root.NodeName(), s, v.expected)
+		}
+		// and back again
+		reversed := ""
+		for n := it.PreviousNode(); n != nil; n = it.PreviousNode() {
+			reversed = n.NodeName() + " " + reversed
+		}
+		if reversed != v.expected {
+			t.Errorf("PreviousNode from %s returned %q, expected %q", v.root.NodeName(), reversed, v.expected)
+		}
+		it.Detach()
+		if it.NextNode() != nil {
+			t.Errorf("Detached iterator returned a node")
+		}
+	}
+	if len(d.iterators) != 0 {
+		t.Errorf("Detached iterators still registered")
+	}
+}
+
+func TestNodeIteratorRemoval(t *testing.T) {
+	d, _ := ParseStringXml(traversalXml)
+	a := d.DocumentElement()
+	b := a.FirstChild()
+	it := d.CreateNodeIterator(a, SHOW_ELEMENT, nil)
+	defer it.Detach()
+
+	// removing the node the iterator is at, after it
+	it.NextNode()
+	it.NextNode()
+	if n := it.NextNode(); n.NodeName() != "c" {
+		t.Fatalf("Expected c, got %s", n.NodeName())
+	}
+	b.RemoveChild(b.FirstChild())
+	if s := collect(it.NextNode); s != "d e f " {
+		t.Errorf("After removing c, NextNode returned %q", s)
+	}
+
+	// removing an ancestor of the node the iterator is at, before it
+	it.PreviousNode()
+	it.PreviousNode()
+	if n := it.PreviousNode(); n.NodeName() != "d" {
+		t.Fatalf("Expected d, got %s", n.NodeName())
+	}
+	a.RemoveChild(b)
+	if s := collect(it.NextNode); s != "e f " {
+		t.Errorf("After removing b, NextNode returned %q", s)
+	}
+
+	// removing the last nodes moves the iterator back to the root
+	a.RemoveChild(a.LastChild())
+	if s := collect(it.PreviousNode); s != "a " {
+		t.Errorf("After removing e, PreviousNode returned %q", s)
+	}
+
+	// nodes moved elsewhere in the tree are still found
+	d2, _ := ParseStringXml(traversalXml)
+	it2 := d2.CreateNodeIterator(d2, SHOW_ELEMENT, nil)
+	defer it2.Detach()
+	moved := false
+	for n := it2.NextNode(); n != nil; n = it2.NextNode() {
+		if e, ok := n.(*Element); ok && e.TagName() == "c" && !moved {
+			moved = true
+			d2.DocumentElement().AppendChild(e)
+			d2.DocumentElement().AppendChild(d2.CreateElement("g"))
+		}
+	}
+	if s := collect(it2.PreviousNode); s != "g c f e d b a " {
+		t.Errorf("After moving c, PreviousNode returned %q", s)
+	}
+}
+
+func TestTreeWalker(t *testing.T) {
+	d, _ := ParseStringXml(traversalXml)
+	a := d.DocumentElement()
+
+	w := d.CreateTreeWalker(d, SHOW_ELEMENT, nil)
+	if s := collect(w.NextNode); s != "a b c d e f " || w.CurrentNode().NodeName() != "f" {
+		t.Errorf("NextNode returned %q", s)
+	}
+	if s := collect(w.PreviousNode); s != "e d c b a " || w.CurrentNode() != a {
+		t.Errorf("PreviousNode returned %q", s)
+	}
+
+	// rejecting b skips its children, skipping b does not
+	w = d.CreateTreeWalker(a, SHOW_ELEMENT, filterName("b", FILTER_REJECT))
+	if s := collect(w.NextNode); s != "e f " {
+		t.Errorf("NextNode with b rejected returned %q", s)
+	}
+	w = d.CreateTreeWalker(a, SHOW_ELEMENT, filterName("b", FILTER_SKIP))
+	if n := w.FirstChild(); n == nil || n.NodeName() != "c" {
+		t.Fatalf("FirstChild with b skipped returned %v", n)
+	}
+	if s := collect(w.NextSibling); s != "d e " {
+		t.Errorf("NextSibling with b skipped returned %q", s)
+	}
+	if s := collect(w.PreviousSibling); s != "d c " {
+		t.Errorf("PreviousSibling with b skipped returned %q", s)
+	}
+	if n := w.ParentNode(); n != a || w.ParentNode() != nil {
+		t.Errorf("ParentNode returned %v", n)
+	}
+	if n := w.LastChild(); n == nil || n.NodeName() != "e" {
+		t.Errorf("LastChild returned %v", n)
+	}
+
+	// the walker stays on a node that is removed
+	w = d.CreateTreeWalker(a, SHOW_ALL, nil)
+	w.FirstChild()
+	b := w.FirstChild().ParentNode()
+	text := w.NextSibling()
+	b.RemoveChild(text)
+	if w.CurrentNode() != text || w.NextSibling() != nil || w.ParentNode() != nil {
+		t.Errorf("Walker moved away from a removed node")
+	}
+	w.SetCurrentNode(b)
+	if s := collect(w.NextNode); s != "c d #comment e f " {
+		t.Errorf("NextNode after removal returned %q", s)
+	}
+	w.SetCurrentNode(nil)
+	if w.CurrentNode() == nil {
+		t.Errorf("SetCurrentNode accepted nil")
+	}
+	if d.CreateTreeWalker(nil, SHOW_ALL, nil) != nil || d.CreateNodeIterator(nil, SHOW_ALL, nil) != nil {
+		t.Errorf("Traversal created without a root")
+	}
+}
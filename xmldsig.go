@@ -0,0 +1,499 @@
+package dom
+
+/*
+ * XML Signature
+ * http://www.w3.org/TR/xmldsig-core1/
+ *
+ * Signatures are made and checked over nodes of the same document, which
+ * are found by an empty URI (the whole document) or a fragment URI naming
+ * an element by ID.
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"math/big"
+	"strings"
+)
+
+const DSIG_NAMESPACE = "http://www.w3.org/2000/09/xmldsig#"
+
+// Identifiers of the signature, digest and transform algorithms.
+const (
+	RSA_SHA1     = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	RSA_SHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	RSA_SHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	ECDSA_SHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	ECDSA_SHA384 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+	ECDSA_SHA512 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+	HMAC_SHA1    = "http://www.w3.org/2000/09/xmldsig#hmac-sha1"
+	HMAC_SHA256  = "http://www.w3.org/2001/04/xmldsig-more#hmac-sha256"
+	HMAC_SHA512  = "http://www.w3.org/2001/04/xmldsig-more#hmac-sha512"
+
+	DIGEST_SHA1   = "http://www.w3.org/2000/09/xmldsig#sha1"
+	DIGEST_SHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	DIGEST_SHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+
+	ENVELOPED_SIGNATURE = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+type _signatureMethod struct {
+	kind string // rsa, ecdsa or hmac
+	hash crypto.Hash
+}
+
+var signatureMethods = map[string]_signatureMethod{
+	RSA_SHA1:     {"rsa", crypto.SHA1},
+	RSA_SHA256:   {"rsa", crypto.SHA256},
+	RSA_SHA512:   {"rsa", crypto.SHA512},
+	ECDSA_SHA256: {"ecdsa", crypto.SHA256},
+	ECDSA_SHA384: {"ecdsa", crypto.SHA384},
+	ECDSA_SHA512: {"ecdsa", crypto.SHA512},
+	HMAC_SHA1:    {"hmac", crypto.SHA1},
+	HMAC_SHA256:  {"hmac", crypto.SHA256},
+	HMAC_SHA512:  {"hmac", crypto.SHA512},
+}
+
+var digestMethods = map[string]crypto.Hash{
+	DIGEST_SHA1:   crypto.SHA1,
+	DIGEST_SHA256: crypto.SHA256,
+	DIGEST_SHA512: crypto.SHA512,
+}
+
+// A SignatureError is returned when a signature cannot be made, or does
+// not verify.
+type SignatureError struct {
+	Msg string
+}
+
+func (e *SignatureError) Error() string {
+	return "dom: " + e.Msg
+}
+
+// A Reference names the nodes covered by a signature, and how they are
+// digested.
+type Reference struct {
+	// Either empty, for the whole document, or "#" followed by an ID.
+	URI string
+	// Algorithm identifiers of the transforms, applied in order.  Without a
+	// canonicalization transform, the nodes are canonicalized by C14N 1.0.
+	Transforms []string
+	// The prefix list for an exclusive canonicalization transform.
+	InclusiveNamespaces []string
+	// The default is the DigestMethod of the Signer.
+	DigestMethod string
+}
+
+// A Signer creates ds:Signature elements.
+type Signer struct {
+	// An *rsa.PrivateKey, an *ecdsa.PrivateKey, or a []byte for HMAC.
+	Key interface{}
+	// The default is RSA_SHA256, ECDSA_SHA256 or HMAC_SHA256, depending on
+	// the key.
+	SignatureMethod string
+	// The default is DIGEST_SHA256.
+	DigestMethod string
+	// Used for the SignedInfo.  The default is EXC_C14N, which keeps the
+	// signature independent of where it is placed.
+	CanonicalizationMethod string
+	// The prefix for the signature namespace.  The default is "ds".
+	Prefix string
+}
+
+// Signs the nodes named by refs, and appends the ds:Signature element to
+// parent.  The signature is added before the digests are computed, so
+// that a reference with the enveloped signature transform may cover
+// parent itself.
+func (s *Signer) Sign(parent *Element, refs ...Reference) (*Element, error) {
+	method := s.SignatureMethod
+	if method == "" {
+		switch s.Key.(type) {
+		case *rsa.PrivateKey:
+			method = RSA_SHA256
+		case *ecdsa.PrivateKey:
+			method = ECDSA_SHA256
+		case []byte:
+			method = HMAC_SHA256
+		}
+	}
+	digest := s.DigestMethod
+	if digest == "" {
+		digest = DIGEST_SHA256
+	}
+	c14n := s.CanonicalizationMethod
+	if c14n == "" {
+		c14n = EXC_C14N
+	}
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "ds"
+	}
+
+	d := parent.OwnerDocument()
+	if d == nil {
+		return nil, &SignatureError{"the parent does not belong to a document"}
+	}
+	create := func(parent *Element, local string) *Element {
+		e := d.CreateElementNS(DSIG_NAMESPACE, prefix+":"+local)
+		parent.AppendChild(e)
+		return e
+	}
+	sig := d.CreateElementNS(DSIG_NAMESPACE, prefix+":Signature")
+	sig.SetAttributeNS(XMLNS_NAMESPACE, "xmlns:"+prefix, DSIG_NAMESPACE)
+	si := create(sig, "SignedInfo")
+	create(si, "CanonicalizationMethod").SetAttribute("Algorithm", c14n)
+	create(si, "SignatureMethod").SetAttribute("Algorithm", method)
+	for _, ref := range refs {
+		r := create(si, "Reference")
+		r.SetAttribute("URI", ref.URI)
+		if len(ref.Transforms) > 0 {
+			ts := create(r, "Transforms")
+			for _, alg := range ref.Transforms {
+				t := create(ts, "Transform")
+				t.SetAttribute("Algorithm", alg)
+				if (alg == EXC_C14N || alg == EXC_C14N_COMMENTS) && len(ref.InclusiveNamespaces) > 0 {
+					in := d.CreateElementNS(EXC_C14N, "ec:InclusiveNamespaces")
+					in.SetAttributeNS(XMLNS_NAMESPACE, "xmlns:ec", EXC_C14N)
+					in.SetAttribute("PrefixList", strings.Join(ref.InclusiveNamespaces, " "))
+					t.AppendChild(in)
+				}
+			}
+		}
+		if ref.DigestMethod != "" {
+			create(r, "DigestMethod").SetAttribute("Algorithm", ref.DigestMethod)
+		} else {
+			create(r, "DigestMethod").SetAttribute("Algorithm", digest)
+		}
+		create(r, "DigestValue")
+	}
+	sv := create(sig, "SignatureValue")
+	parent.AppendChild(sig)
+
+	value, err := s.sign(sig, si, method)
+	if err != nil {
+		parent.RemoveChild(sig)
+		return nil, err
+	}
+	sv.AppendChild(d.CreateTextNode(base64.StdEncoding.EncodeToString(value)))
+	return sig, nil
+}
+
+// Signs e with an enveloped signature, which is appended to e.  The
+// reference is to the ID of e, if it has one, and otherwise to the whole
+// document.
+func (s *Signer) SignEnveloped(e *Element) (*Element, error) {
+	uri := ""
+	for i := range e.attribs {
+		if a := e.attribs[i]; isIdAttribute(a) && a.v != "" {
+			uri = "#" + a.v
+			break
+		}
+	}
+	c14n := s.CanonicalizationMethod
+	if c14n == "" {
+		c14n = EXC_C14N
+	}
+	return s.Sign(e, Reference{URI: uri, Transforms: []string{ENVELOPED_SIGNATURE, c14n}})
+}
+
+// fills in the digest values and returns the signature value
+func (s *Signer) sign(sig, si *Element, method string) ([]byte, error) {
+	for _, r := range dsigChildren(si, "Reference") {
+		_, digest, err := digestReference(sig, r)
+		if err != nil {
+			return nil, err
+		}
+		dv := dsigChild(r, "DigestValue")
+		dv.AppendChild(sig.OwnerDocument().CreateTextNode(base64.StdEncoding.EncodeToString(digest)))
+	}
+
+	m, ok := signatureMethods[method]
+	if !ok {
+		return nil, &SignatureError{"unsupported signature method " + method}
+	}
+	signed, err := canonicalSignedInfo(si)
+	if err != nil {
+		return nil, err
+	}
+	if m.kind == "hmac" {
+		key, ok := s.Key.([]byte)
+		if !ok {
+			return nil, &SignatureError{"HMAC signatures require a []byte key"}
+		}
+		mac := hmac.New(m.hash.New, key)
+		mac.Write(signed)
+		return mac.Sum(nil), nil
+	}
+	h := m.hash.New()
+	h.Write(signed)
+	hashed := h.Sum(nil)
+	switch key := s.Key.(type) {
+	case *rsa.PrivateKey:
+		if m.kind == "rsa" {
+			return rsa.SignPKCS1v15(rand.Reader, key, m.hash, hashed)
+		}
+	case *ecdsa.PrivateKey:
+		if m.kind == "ecdsa" {
+			r, ss, err := ecdsa.Sign(rand.Reader, key, hashed)
+			if err != nil {
+				return nil, err
+			}
+			// the integers are concatenated, each padded to the size of the curve
+			size := (key.Curve.Params().BitSize + 7) / 8
+			value := make([]byte, 2*size)
+			r.FillBytes(value[:size])
+			ss.FillBytes(value[size:])
+			return value, nil
+		}
+	}
+	return nil, &SignatureError{"the key does not match the signature method " + method}
+}
+
+// ====================================
+
+// A Verifier checks ds:Signature elements.
+type Verifier struct {
+	// An *rsa.PublicKey, an *ecdsa.PublicKey, or a []byte for HMAC.
+	Key interface{}
+}
+
+// Checks the signature value and the digest of every reference of sig,
+// which must be a ds:Signature element in the document it signs.  Returns
+// the referenced nodes, which are the only ones covered by the signature.
+func (v *Verifier) Verify(sig *Element) ([]Node, error) {
+	if sig.n.Space != DSIG_NAMESPACE || sig.n.Local != "Signature" {
+		return nil, &SignatureError{"not a signature element"}
+	}
+	si := dsigChild(sig, "SignedInfo")
+	sv := dsigChild(sig, "SignatureValue")
+	if si == nil || sv == nil {
+		return nil, &SignatureError{"missing SignedInfo or SignatureValue"}
+	}
+	sm := dsigChild(si, "SignatureMethod")
+	if sm == nil {
+		return nil, &SignatureError{"missing SignatureMethod"}
+	}
+	method := sm.GetAttribute("Algorithm")
+	m, ok := signatureMethods[method]
+	if !ok {
+		return nil, &SignatureError{"unsupported signature method " + method}
+	}
+	if dsigChild(sm, "HMACOutputLength") != nil {
+		// truncated HMACs are too easily forged
+		return nil, &SignatureError{"HMACOutputLength is not supported"}
+	}
+	value, err := dsigBase64(sv)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := canonicalSignedInfo(si)
+	if err != nil {
+		return nil, err
+	}
+	if !v.verify(m, signed, value) {
+		return nil, &SignatureError{"signature value does not verify"}
+	}
+
+	refs := dsigChildren(si, "Reference")
+	if len(refs) == 0 {
+		return nil, &SignatureError{"missing Reference"}
+	}
+	nodes := []Node{}
+	for _, r := range refs {
+		n, digest, err := digestReference(sig, r)
+		if err != nil {
+			return nil, err
+		}
+		dv := dsigChild(r, "DigestValue")
+		if dv == nil {
+			return nil, &SignatureError{"missing DigestValue"}
+		}
+		want, err := dsigBase64(dv)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(digest, want) {
+			return nil, &SignatureError{"digest of reference \"" + r.GetAttribute("URI") + "\" does not match"}
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func (v *Verifier) verify(m _signatureMethod, signed, value []byte) bool {
+	if m.kind == "hmac" {
+		key, ok := v.Key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(m.hash.New, key)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), value)
+	}
+	h := m.hash.New()
+	h.Write(signed)
+	hashed := h.Sum(nil)
+	switch key := v.Key.(type) {
+	case *rsa.PublicKey:
+		return m.kind == "rsa" && rsa.VerifyPKCS1v15(key, m.hash, hashed, value) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if m.kind != "ecdsa" || len(value) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(value[:size])
+		s := new(big.Int).SetBytes(value[size:])
+		return ecdsa.Verify(key, hashed, r, s)
+	}
+	return false
+}
+
+// ====================================
+
+// Dereferences the URI of the Reference element r, applies its transforms
+// and returns the referenced node and its digest.
+func digestReference(sig, r *Element) (Node, []byte, error) {
+	uri := r.GetAttribute("URI")
+	d := sig.OwnerDocument()
+	if d == nil {
+		return nil, nil, &SignatureError{"the signature does not belong to a document"}
+	}
+	var n Node
+	switch {
+	case uri == "":
+		n = d
+	case strings.HasPrefix(uri, "#"):
+		e := d.GetElementById(uri[1:])
+		if e == nil {
+			return nil, nil, &SignatureError{"no element with the ID " + uri[1:]}
+		}
+		if countIds(d.DocumentElement(), uri[1:]) > 1 {
+			// the signed element could be swapped for another
+			return nil, nil, &SignatureError{"more than one element with the ID " + uri[1:]}
+		}
+		n = e
+	default:
+		return nil, nil, &SignatureError{"unsupported reference URI " + uri}
+	}
+
+	c := &Canonicalizer{Algorithm: C14N_1_0}
+	enveloped, octets := false, false
+	if ts := dsigChild(r, "Transforms"); ts != nil {
+		for _, t := range dsigChildren(ts, "Transform") {
+			alg := t.GetAttribute("Algorithm")
+			if octets {
+				return nil, nil, &SignatureError{"transform " + alg + " follows canonicalization"}
+			}
+			switch alg {
+			case ENVELOPED_SIGNATURE:
+				enveloped = true
+			case C14N_1_0, C14N_1_0_COMMENTS, C14N_1_1, C14N_1_1_COMMENTS, EXC_C14N, EXC_C14N_COMMENTS:
+				c.Algorithm, c.InclusiveNamespaces = alg, inclusiveNamespaces(t)
+				octets = true
+			default:
+				return nil, nil, &SignatureError{"unsupported transform " + alg}
+			}
+		}
+	}
+	// same-document references leave out comments, even for the
+	// WithComments algorithms
+	c.skip = func(m Node) bool {
+		return m.NodeType() == COMMENT_NODE || enveloped && m == Node(sig)
+	}
+	if n == Node(sig) && enveloped {
+		return nil, nil, &SignatureError{"reference to the signature itself"}
+	}
+	data, err := c.Canonicalize(n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dm := dsigChild(r, "DigestMethod")
+	if dm == nil {
+		return nil, nil, &SignatureError{"missing DigestMethod"}
+	}
+	hash, ok := digestMethods[dm.GetAttribute("Algorithm")]
+	if !ok {
+		return nil, nil, &SignatureError{"unsupported digest method " + dm.GetAttribute("Algorithm")}
+	}
+	h := hash.New()
+	h.Write(data)
+	return n, h.Sum(nil), nil
+}
+
+// returns the number of elements in the subtree of e with the given ID
+func countIds(e *Element, id string) int {
+	count := 0
+	for i := range e.attribs {
+		if a := e.attribs[i]; a.v == id && isIdAttribute(a) {
+			count++
+			break
+		}
+	}
+	for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+		if ce, ok := c.(*Element); ok {
+			count += countIds(ce, id)
+		}
+	}
+	return count
+}
+
+func canonicalSignedInfo(si *Element) ([]byte, error) {
+	cm := dsigChild(si, "CanonicalizationMethod")
+	if cm == nil {
+		return nil, &SignatureError{"missing CanonicalizationMethod"}
+	}
+	c := &Canonicalizer{Algorithm: cm.GetAttribute("Algorithm"), InclusiveNamespaces: inclusiveNamespaces(cm)}
+	switch c.Algorithm {
+	case C14N_1_0, C14N_1_0_COMMENTS, C14N_1_1, C14N_1_1_COMMENTS, EXC_C14N, EXC_C14N_COMMENTS:
+	default:
+		return nil, &SignatureError{"unsupported canonicalization method " + c.Algorithm}
+	}
+	return c.Canonicalize(si)
+}
+
+// returns the PrefixList of an ec:InclusiveNamespaces child of e
+func inclusiveNamespaces(e *Element) []string {
+	for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+		if ce, ok := c.(*Element); ok && ce.n.Space == EXC_C14N && ce.n.Local == "InclusiveNamespaces" {
+			return strings.Fields(ce.GetAttribute("PrefixList"))
+		}
+	}
+	return nil
+}
+
+func dsigChildren(e *Element, local string) []*Element {
+	es := []*Element{}
+	for c := e.FirstChild(); c != nil; c = c.NextSibling() {
+		if ce, ok := c.(*Element); ok && ce.n.Space == DSIG_NAMESPACE && ce.n.Local == local {
+			es = append(es, ce)
+		}
+	}
+	return es
+}
+
+func dsigChild(e *Element, local string) *Element {
+	if es := dsigChildren(e, local); len(es) > 0 {
+		return es[0]
+	}
+	return nil
+}
+
+// decodes the base64 content of e, which may be split over several lines
+func dsigBase64(e *Element) ([]byte, error) {
+	s := strings.Join(strings.Fields(string(e.ToText(false))), "")
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &SignatureError{"invalid base64 in " + e.n.Local}
+	}
+	return b, nil
+}
@@ -0,0 +1,207 @@
+package dom
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const dsigDoc = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="r1">
+  <!-- not signed -->
+  <saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="a1">
+    <saml:Subject>alice</saml:Subject>
+  </saml:Assertion>
+</samlp:Response>`
+
+func dsigKeys(t *testing.T) []struct {
+	name        string
+	signer, pub interface{}
+	wrongPublic interface{}
+} {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating RSA key (%v).", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating ECDSA key (%v).", err)
+	}
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return []struct {
+		name        string
+		signer, pub interface{}
+		wrongPublic interface{}
+	}{
+		{"RSA", rsaKey, &rsaKey.PublicKey, &ecKey.PublicKey},
+		{"ECDSA", ecKey, &ecKey.PublicKey, &otherKey.PublicKey},
+		{"HMAC", []byte("secret"), []byte("secret"), []byte("guess")},
+	}
+}
+
+func TestSignEnveloped(t *testing.T) {
+	for _, k := range dsigKeys(t) {
+		d, _ := ParseStringXml(dsigDoc)
+		assertion := d.GetElementById("a1")
+		s := &Signer{Key: k.signer}
+		sig, err := s.SignEnveloped(assertion)
+		if err != nil {
+			t.Errorf("%s: error signing (%v).", k.name, err)
+			continue
+		}
+		if sig.ParentNode() != assertion {
+			t.Errorf("%s: signature not appended", k.name)
+		}
+		if uri := sig.GetElementsByTagNameNS(DSIG_NAMESPACE, "Reference").Item(0).(*Element).GetAttribute("URI"); uri != "#a1" {
+			t.Errorf("%s: reference to %q", k.name, uri)
+		}
+
+		// the signature survives serialization
+		d2, err := ParseStringXml(string(d.ToXml()))
+		if err != nil {
+			t.Fatalf("%s: error parsing signed document (%v).", k.name, err)
+		}
+		sig2 := d2.GetElementsByTagNameNS(DSIG_NAMESPACE, "Signature").Item(0).(*Element)
+		nodes, err := (&Verifier{Key: k.pub}).Verify(sig2)
+		if err != nil || len(nodes) != 1 || nodes[0] != d2.GetElementById("a1") {
+			t.Errorf("%s: signature does not verify (%v).", k.name, err)
+		}
+		if _, err := (&Verifier{Key: k.wrongPublic}).Verify(sig2); err == nil {
+			t.Errorf("%s: signature verifies with the wrong key", k.name)
+		}
+
+		// changes outside of the assertion, and to comments, do not matter
+		d2.DocumentElement().SetAttribute("Extra", "1")
+		d2.GetElementById("a1").AppendChild(d2.CreateComment("ignored"))
+		if _, err := (&Verifier{Key: k.pub}).Verify(sig2); err != nil {
+			t.Errorf("%s: unrelated change breaks the signature (%v).", k.name, err)
+		}
+
+		subject := d2.GetElementById("a1").FirstChild().NextSibling()
+		subject.AppendChild(d2.CreateTextNode("x"))
+		if _, err := (&Verifier{Key: k.pub}).Verify(sig2); err == nil || !strings.Contains(err.Error(), "digest") {
+			t.Errorf("%s: change to the assertion not detected (%v).", k.name, err)
+		}
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	d, _ := ParseStringXml(dsigDoc)
+	key := []byte("secret")
+	s := &Signer{Key: key, SignatureMethod: HMAC_SHA512, DigestMethod: DIGEST_SHA1}
+	sig, err := s.Sign(d.DocumentElement(), Reference{URI: "#a1", Transforms: []string{C14N_1_1}, DigestMethod: DIGEST_SHA512})
+	if err != nil {
+		t.Fatalf("Error signing (%v).", err)
+	}
+	if sig.ParentNode() != d.DocumentElement() {
+		t.Errorf("Signature not appended")
+	}
+	nodes, err := (&Verifier{Key: key}).Verify(sig)
+	if err != nil || len(nodes) != 1 || nodes[0] != d.GetElementById("a1") {
+		t.Errorf("Detached signature does not verify (%v).", err)
+	}
+
+	// tampering with the signed info
+	dm := sig.GetElementsByTagNameNS(DSIG_NAMESPACE, "DigestMethod").Item(0).(*Element)
+	dm.SetAttribute("Algorithm", DIGEST_SHA256)
+	if _, err := (&Verifier{Key: key}).Verify(sig); err == nil {
+		t.Errorf("Change to SignedInfo not detected")
+	}
+}
+
+func TestSignWholeDocument(t *testing.T) {
+	d, _ := ParseStringXml(`<doc><a/></doc>`)
+	s := &Signer{Key: []byte("k"), Prefix: "sig", CanonicalizationMethod: C14N_1_0}
+	sig, err := s.SignEnveloped(d.DocumentElement())
+	if err != nil {
+		t.Fatalf("Error signing (%v).", err)
+	}
+	if sig.NodeName() != "sig:Signature" {
+		t.Errorf("Prefix not used: %s", sig.NodeName())
+	}
+	if _, err := (&Verifier{Key: []byte("k")}).Verify(sig); err != nil {
+		t.Errorf("Signature over the document does not verify (%v).", err)
+	}
+	d.DocumentElement().FirstChild().(*Element).SetAttribute("b", "1")
+	if _, err := (&Verifier{Key: []byte("k")}).Verify(sig); err == nil {
+		t.Errorf("Change to the document not detected")
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	d, _ := ParseStringXml(dsigDoc)
+	root := d.DocumentElement()
+	test_cases := []struct {
+		s   Signer
+		ref Reference
+	}{
+		{Signer{Key: "key"}, Reference{URI: "#a1"}},
+		{Signer{Key: []byte("k"), SignatureMethod: RSA_SHA256}, Reference{URI: "#a1"}},
+		{Signer{Key: []byte("k")}, Reference{URI: "#missing"}},
+		{Signer{Key: []byte("k")}, Reference{URI: "http://example.org/"}},
+		{Signer{Key: []byte("k")}, Reference{URI: "#a1", Transforms: []string{"urn:unknown"}}},
+		{Signer{Key: []byte("k")}, Reference{URI: "#a1", Transforms: []string{EXC_C14N, ENVELOPED_SIGNATURE}}},
+		{Signer{Key: []byte("k")}, Reference{URI: "#a1", DigestMethod: "urn:unknown"}},
+	}
+	for i, v := range test_cases {
+		if _, err := v.s.Sign(root, v.ref); err == nil {
+			t.Errorf("Test case %d: no error", i)
+		}
+	}
+	if root.LastChild().NodeType() == ELEMENT_NODE && root.LastChild().NodeName() == "ds:Signature" {
+		t.Errorf("Failed signature left in the document")
+	}
+
+	// duplicate IDs make the reference ambiguous
+	s := &Signer{Key: []byte("k")}
+	sig, _ := s.Sign(root, Reference{URI: "#a1"})
+	dup := d.CreateElement("dup")
+	dup.SetAttribute("ID", "a1")
+	root.AppendChild(dup)
+	if _, err := (&Verifier{Key: []byte("k")}).Verify(sig); err == nil {
+		t.Errorf("Duplicate IDs not detected")
+	}
+
+	// truncated HMACs are refused
+	sig, _ = s.SignEnveloped(root)
+	sm := sig.GetElementsByTagNameNS(DSIG_NAMESPACE, "SignatureMethod").Item(0)
+	sm.AppendChild(d.CreateElementNS(DSIG_NAMESPACE, "ds:HMACOutputLength"))
+	if _, err := (&Verifier{Key: []byte("k")}).Verify(sig); err == nil {
+		t.Errorf("HMACOutputLength accepted")
+	}
+
+	// nodes removed from the document cannot be signed or verified
+	var e *SignatureError
+	a := d.GetElementById("a1")
+	root.RemoveChild(a)
+	if _, err := s.SignEnveloped(a); !errors.As(err, &e) {
+		t.Errorf("Signing a removed element: %v", err)
+	}
+	sig, _ = s.Sign(root, Reference{URI: ""})
+	root.RemoveChild(sig)
+	if _, err := (&Verifier{Key: []byte("k")}).Verify(sig); !errors.As(err, &e) {
+		t.Errorf("Verifying a removed signature: %v", err)
+	}
+}
+
+func TestGetElementByIdAttributes(t *testing.T) {
+	d, _ := ParseStringXml(`<a xmlns:wsu="urn:wsu"><b ID="x"/><c wsu:Id="y"/><d xml:id="z"/><e name="w"/></a>`)
+	test_cases := []struct {
+		id, name string
+	}{
+		{"x", "b"},
+		{"y", "c"},
+		{"z", "d"},
+		{"w", ""},
+		{"", ""},
+	}
+	for _, v := range test_cases {
+		e := d.GetElementById(v.id)
+		if v.name == "" && e != nil || v.name != "" && (e == nil || e.NodeName() != v.name) {
+			t.Errorf("GetElementById(%q) returned %v", v.id, e)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package dom
+
+/*
+ * XPath 1.0 evaluation over the DOM
+ * http://www.w3.org/TR/xpath/
+ *
+ * An expression is compiled once with CompileXPath and can then be
+ * evaluated against any number of context nodes.
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+// The four types of object an XPath expression can evaluate to.
+const (
+	_              = iota // ignore first value
+	XPATH_NODE_SET = iota
+	XPATH_STRING
+	XPATH_NUMBER
+	XPATH_BOOLEAN
+)
+
+// Node type reported by the namespace nodes returned from the namespace axis.
+// http://www.w3.org/TR/DOM-Level-3-XPath/xpath.html#XPathNamespace
+const XPATH_NAMESPACE_NODE = 13
+
+// An XPathError is returned when an expression cannot be compiled or
+// evaluated.  For compile errors, Pos is the byte offset into the
+// expression where the error was found.
+type XPathError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *XPathError) Error() string {
+	return "xpath: " + e.Msg + " in '" + e.Expr + "'"
+}
+
+// An XPathContext supplies the bindings used while evaluating an expression.
+// Namespaces maps the prefixes used in the expression to namespace URIs.
+// Variables holds the values of variable references, which may be of type
+// string, bool, float64, int, Node, []Node, NodeList or *XPathResult.
+type XPathContext struct {
+	Namespaces map[string]string
+	Variables  map[string]interface{}
+}
+
+// A compiled XPath expression.  An XPath is safe to evaluate from multiple
+// goroutines at once, as is the DOM as long as nothing changes it.
+type XPath struct {
+	expr string
+	root xpathExpr
+}
+
+// Compiles an XPath 1.0 expression.
+func CompileXPath(expr string) (*XPath, error) {
+	root, err := parseXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &XPath{expr, root}, nil
+}
+
+// Like CompileXPath, but panics if the expression cannot be compiled.
+func MustCompileXPath(expr string) *XPath {
+	x, err := CompileXPath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+// Returns the source of the expression.
+func (x *XPath) String() string {
+	return x.expr
+}
+
+// Evaluates the expression with n as the context node.
+func (x *XPath) Evaluate(n Node) (*XPathResult, error) {
+	return x.EvaluateWith(n, nil)
+}
+
+// Evaluates the expression with n as the context node, using the
+// namespace and variable bindings from ctx.  The context may be nil.
+func (x *XPath) EvaluateWith(n Node, ctx *XPathContext) (*XPathResult, error) {
+	env := newXPathEnv(x.expr, ctx)
+	v, err := x.root.eval(&xpathContext{n, 1, 1, env})
+	if err != nil {
+		return nil, err
+	}
+	return &XPathResult{v}, nil
+}
+
+// Evaluates the expression, which must return a node-set, and returns the
+// nodes in document order.
+func (x *XPath) SelectNodes(n Node) (NodeList, error) {
+	r, err := x.Evaluate(n)
+	if err != nil {
+		return nil, err
+	}
+	if r.Type() != XPATH_NODE_SET {
+		return nil, &XPathError{x.expr, 0, "expression does not return a node-set"}
+	}
+	return r.Nodes(), nil
+}
+
+// Evaluates the expression, which must return a node-set, and returns the
+// first node in document order, or nil if the node-set is empty.
+func (x *XPath) SelectNode(n Node) (Node, error) {
+	nl, err := x.SelectNodes(n)
+	if err != nil {
+		return nil, err
+	}
+	return nl.Item(0), nil
+}
+
+// The result of evaluating an XPath expression.
+type XPathResult struct {
+	v interface{} // one of []Node, string, float64 or bool
+}
+
+// Returns one of XPATH_NODE_SET, XPATH_STRING, XPATH_NUMBER or XPATH_BOOLEAN.
+func (r *XPathResult) Type() uint {
+	switch r.v.(type) {
+	case []Node:
+		return XPATH_NODE_SET
+	case string:
+		return XPATH_STRING
+	case float64:
+		return XPATH_NUMBER
+	}
+	return XPATH_BOOLEAN
+}
+
+// Returns the nodes of a node-set result in document order, or nil if the
+// result is not a node-set.
+func (r *XPathResult) Nodes() NodeList {
+	if ns, ok := r.v.([]Node); ok {
+		return newStaticNodeList(ns)
+	}
+	return nil
+}
+
+// Converts the result to a string as if by the string() function.
+func (r *XPathResult) String() string {
+	return xpathString(r.v)
+}
+
+// Converts the result to a number as if by the number() function.
+func (r *XPathResult) Number() float64 {
+	return xpathNumber(r.v)
+}
+
+// Converts the result to a boolean as if by the boolean() function.
+func (r *XPathResult) Bool() bool {
+	return xpathBoolean(r.v)
+}
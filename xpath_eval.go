@@ -0,0 +1,840 @@
+package dom
+
+/*
+ * Evaluation of compiled XPath 1.0 expressions
+ * http://www.w3.org/TR/xpath/
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type xpathExpr interface {
+	eval(c *xpathContext) (interface{}, error)
+}
+
+// the context for evaluating an expression
+// http://www.w3.org/TR/xpath/#section-Introduction
+type xpathContext struct {
+	node Node
+	pos  int
+	size int
+	env  *xpathEnv
+}
+
+// state shared by all contexts during one evaluation
+type xpathEnv struct {
+	expr  string
+	ctx   *XPathContext
+	attrs map[*Element][]Node // attribute nodes, created once per element
+	nss   map[*Element][]Node // namespace nodes, created once per element
+	owner map[Node]*Element   // parent element of attribute and namespace nodes
+	order map[Node]int        // document order of nodes seen so far
+}
+
+func newXPathEnv(expr string, ctx *XPathContext) *xpathEnv {
+	if ctx == nil {
+		ctx = &XPathContext{}
+	}
+	return &xpathEnv{
+		expr:  expr,
+		ctx:   ctx,
+		attrs: make(map[*Element][]Node),
+		nss:   make(map[*Element][]Node),
+		owner: make(map[Node]*Element),
+	}
+}
+
+func (env *xpathEnv) errorf(msg string) error {
+	return &XPathError{env.expr, 0, msg}
+}
+
+// ====================================
+// Namespace nodes
+
+type _xpathNamespace struct {
+	_node
+	uri   string
+	owner *Element // for canonicalizing a node-set
+}
+
+func (n *_xpathNamespace) NodeType() uint        { return XPATH_NAMESPACE_NODE }
+func (n *_xpathNamespace) NodeName() string      { return n.n.Local }
+func (n *_xpathNamespace) NodeValue() string     { return n.uri }
+func (n *_xpathNamespace) ParentNode() Node      { return Node(nil) }
+func (n *_xpathNamespace) PreviousSibling() Node { return Node(nil) }
+func (n *_xpathNamespace) NextSibling() Node     { return Node(nil) }
+func (n *_xpathNamespace) ChildNodes() NodeList  { return newStaticNodeList(nil) }
+func (n *_xpathNamespace) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(n, w)
+}
+func (n *_xpathNamespace) CloneNode(deep bool) Node {
+	c := &_xpathNamespace{uri: n.uri}
+	c.n = n.n
+	return c
+}
+
+// ====================================
+// Node model
+
+// returns the attributes of e, excluding namespace declarations
+func (env *xpathEnv) attributes(e *Element) []Node {
+	if list, ok := env.attrs[e]; ok {
+		return list
+	}
+	list := []Node{}
+	m := e.Attributes()
+	for i := uint(0); i < m.Length(); i++ {
+		a := m.Item(i)
+		if a.NamespaceURI() == XMLNS_NAMESPACE {
+			continue
+		}
+		list = append(list, a)
+		env.owner[a] = e
+	}
+	env.attrs[e] = list
+	return list
+}
+
+// returns the namespace nodes in scope for e
+func (env *xpathEnv) namespaces(e *Element) []Node {
+	if list, ok := env.nss[e]; ok {
+		return list
+	}
+	seen := map[string]bool{}
+	list := []Node{}
+	add := func(prefix, uri string) {
+		if seen[prefix] {
+			return
+		}
+		seen[prefix] = true
+		if uri == "" {
+			// undeclares the default namespace
+			return
+		}
+		ns := &_xpathNamespace{uri: uri, owner: e}
+		ns.n.Local = prefix
+		list = append(list, ns)
+		env.owner[ns] = e
+	}
+	add("xml", XML_NAMESPACE)
+	for n := Node(e); n != nil; n = n.ParentNode() {
+		el, ok := n.(*Element)
+		if !ok {
+			continue
+		}
+		for _, a := range el.attribs {
+			if a.n.Space != XMLNS_NAMESPACE {
+				continue
+			}
+			if a.pfx == "xmlns" {
+				add(a.n.Local, a.v)
+			} else {
+				add("", a.v)
+			}
+		}
+		if el.n.Space != "" {
+			add(el.pfx, el.n.Space)
+		}
+	}
+	env.nss[e] = list
+	return list
+}
+
+func (env *xpathEnv) parent(n Node) Node {
+	if e, ok := env.owner[n]; ok {
+		return e
+	}
+	p := n.ParentNode()
+	// detached nodes refer to their owner document, without being one of its children
+	if p != nil && p.NodeType() == DOCUMENT_NODE && !containsChild(p, n) {
+		return nil
+	}
+	return p
+}
+
+func containsChild(p Node, c Node) bool {
+	for ch := p.FirstChild(); ch != nil; ch = ch.NextSibling() {
+		if ch == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (env *xpathEnv) children(n Node) []Node {
+	switch n.NodeType() {
+	case ATTRIBUTE_NODE, XPATH_NAMESPACE_NODE:
+		return nil
+	}
+	cn := n.ChildNodes()
+	if cn == nil {
+		return nil
+	}
+	list := make([]Node, 0, cn.Length())
+	for i := uint(0); i < cn.Length(); i++ {
+		// the document type declaration is not part of the data model
+		if c := cn.Item(i); c.NodeType() != DOCUMENT_TYPE_NODE {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+func (env *xpathEnv) root(n Node) Node {
+	for {
+		p := env.parent(n)
+		if p == nil {
+			return n
+		}
+		n = p
+	}
+}
+
+// numbers all the nodes in the tree containing n
+func (env *xpathEnv) number(n Node) {
+	if env.order == nil {
+		env.order = make(map[Node]int)
+	}
+	var walk func(n Node)
+	walk = func(n Node) {
+		env.order[n] = len(env.order)
+		if e, ok := n.(*Element); ok {
+			for _, ns := range env.namespaces(e) {
+				env.order[ns] = len(env.order)
+			}
+			for _, a := range env.attributes(e) {
+				env.order[a] = len(env.order)
+			}
+		}
+		for _, c := range env.children(n) {
+			walk(c)
+		}
+	}
+	walk(env.root(n))
+	if _, ok := env.order[n]; !ok {
+		// not reachable from its root, so number it on its own
+		walk(n)
+	}
+}
+
+func (env *xpathEnv) documentOrder(n Node) int {
+	if o, ok := env.order[n]; ok {
+		return o
+	}
+	env.number(n)
+	return env.order[n]
+}
+
+// sorts a node-set into document order and removes duplicates
+func (env *xpathEnv) sortNodes(nodes []Node) []Node {
+	if len(nodes) < 2 {
+		return nodes
+	}
+	for _, n := range nodes {
+		env.documentOrder(n)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return env.order[nodes[i]] < env.order[nodes[j]]
+	})
+	out := nodes[:1]
+	for _, n := range nodes[1:] {
+		if n != out[len(out)-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// returns the string-value of a node
+// http://www.w3.org/TR/xpath/#data-model
+func stringValue(n Node) string {
+	switch n.NodeType() {
+	case ELEMENT_NODE, DOCUMENT_NODE, DOCUMENT_FRAGMENT_NODE:
+		var b strings.Builder
+		appendStringValue(&b, n)
+		return b.String()
+	}
+	return n.NodeValue()
+}
+
+func appendStringValue(b *strings.Builder, n Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c.NodeType() {
+		case TEXT_NODE, CDATA_SECTION_NODE:
+			b.WriteString(c.NodeValue())
+		case ELEMENT_NODE:
+			appendStringValue(b, c)
+		}
+	}
+}
+
+// ====================================
+// Conversions
+// http://www.w3.org/TR/xpath/#section-Function-Calls
+
+func xpathString(v interface{}) string {
+	switch v := v.(type) {
+	case []Node:
+		if len(v) == 0 {
+			return ""
+		}
+		return stringValue(v[0])
+	case string:
+		return v
+	case float64:
+		return formatXPathNumber(v)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
+
+func formatXPathNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == math.Trunc(f) && math.Abs(f) < 1e15:
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func parseXPathNumber(s string) float64 {
+	s = strings.Trim(s, " \t\r\n")
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits == "." || strings.Trim(digits, "0123456789.") != "" ||
+		strings.Count(digits, ".") > 1 {
+		return math.NaN()
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func xpathNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case []Node:
+		return parseXPathNumber(xpathString(v))
+	case string:
+		return parseXPathNumber(v)
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+func xpathBoolean(v interface{}) bool {
+	switch v := v.(type) {
+	case []Node:
+		return len(v) > 0
+	case string:
+		return v != ""
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case bool:
+		return v
+	}
+	return false
+}
+
+// converts a Go value supplied as a variable into an XPath object
+func xpathValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case string, float64, bool:
+		return v, true
+	case int:
+		return float64(v), true
+	case []Node:
+		return v, true
+	case Node:
+		return []Node{v}, true
+	case NodeList:
+		list := make([]Node, 0, v.Length())
+		for i := uint(0); i < v.Length(); i++ {
+			list = append(list, v.Item(i))
+		}
+		return list, true
+	case *XPathResult:
+		return v.v, true
+	}
+	return nil, false
+}
+
+// ====================================
+// Expressions
+
+type xpathLiteral string
+
+func (e xpathLiteral) eval(c *xpathContext) (interface{}, error) { return string(e), nil }
+
+type xpathNumberLiteral float64
+
+func (e xpathNumberLiteral) eval(c *xpathContext) (interface{}, error) { return float64(e), nil }
+
+type xpathVariable struct {
+	name string
+}
+
+func (e *xpathVariable) eval(c *xpathContext) (interface{}, error) {
+	v, ok := c.env.ctx.Variables[e.name]
+	if !ok {
+		return nil, c.env.errorf("undefined variable $" + e.name)
+	}
+	if v, ok := xpathValue(v); ok {
+		if ns, ok := v.([]Node); ok {
+			return c.env.sortNodes(append([]Node(nil), ns...)), nil
+		}
+		return v, nil
+	}
+	return nil, c.env.errorf("unsupported type for variable $" + e.name)
+}
+
+type xpathNegate struct {
+	e xpathExpr
+}
+
+func (e *xpathNegate) eval(c *xpathContext) (interface{}, error) {
+	v, err := e.e.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	return -xpathNumber(v), nil
+}
+
+type xpathBinary struct {
+	op   string
+	l, r xpathExpr
+}
+
+func (e *xpathBinary) eval(c *xpathContext) (interface{}, error) {
+	l, err := e.l.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	// 'and' and 'or' short-circuit
+	switch e.op {
+	case "and":
+		if !xpathBoolean(l) {
+			return false, nil
+		}
+	case "or":
+		if xpathBoolean(l) {
+			return true, nil
+		}
+	}
+	r, err := e.r.eval(c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "and", "or":
+		return xpathBoolean(r), nil
+	case "|":
+		ln, lok := l.([]Node)
+		rn, rok := r.([]Node)
+		if !lok || !rok {
+			return nil, c.env.errorf("operands of '|' must be node-sets")
+		}
+		return c.env.sortNodes(append(append([]Node(nil), ln...), rn...)), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compareXPath(e.op, l, r), nil
+	}
+
+	a, b := xpathNumber(l), xpathNumber(r)
+	switch e.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "div":
+		return a / b, nil
+	}
+	// mod truncates like the % operator in Java
+	return math.Mod(a, b), nil
+}
+
+// http://www.w3.org/TR/xpath/#booleans
+func compareXPath(op string, l, r interface{}) bool {
+	ln, lok := l.([]Node)
+	rn, rok := r.([]Node)
+	switch {
+	case lok && rok:
+		for _, a := range ln {
+			sa := stringValue(a)
+			for _, b := range rn {
+				if compareXPathAtoms(op, sa, stringValue(b)) {
+					return true
+				}
+			}
+		}
+		return false
+	case lok:
+		return compareNodeSet(op, ln, r, false)
+	case rok:
+		return compareNodeSet(op, rn, l, true)
+	}
+	return compareXPathAtoms(op, l, r)
+}
+
+func compareNodeSet(op string, nodes []Node, v interface{}, swap bool) bool {
+	if b, ok := v.(bool); ok {
+		if swap {
+			return compareXPathAtoms(op, b, len(nodes) > 0)
+		}
+		return compareXPathAtoms(op, len(nodes) > 0, b)
+	}
+	for _, n := range nodes {
+		var a interface{} = stringValue(n)
+		if _, ok := v.(float64); ok {
+			a = parseXPathNumber(a.(string))
+		}
+		if (!swap && compareXPathAtoms(op, a, v)) || (swap && compareXPathAtoms(op, v, a)) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareXPathAtoms(op string, l, r interface{}) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, lb := l.(bool)
+		_, rb := r.(bool)
+		_, lf := l.(float64)
+		_, rf := r.(float64)
+		switch {
+		case lb || rb:
+			eq = xpathBoolean(l) == xpathBoolean(r)
+		case lf || rf:
+			eq = xpathNumber(l) == xpathNumber(r)
+		default:
+			eq = xpathString(l) == xpathString(r)
+		}
+		return eq == (op == "=")
+	}
+	a, b := xpathNumber(l), xpathNumber(r)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+type xpathCall struct {
+	name string
+	fn   xpathFunction
+	args []xpathExpr
+}
+
+func (e *xpathCall) eval(c *xpathContext) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return e.fn.call(c, args)
+}
+
+type xpathFilter struct {
+	e     xpathExpr
+	preds []xpathExpr
+}
+
+func (e *xpathFilter) eval(c *xpathContext) (interface{}, error) {
+	v, err := e.e.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]Node)
+	if !ok {
+		return nil, c.env.errorf("predicates can only be applied to node-sets")
+	}
+	return applyPredicates(c.env, nodes, e.preds)
+}
+
+func applyPredicates(env *xpathEnv, nodes []Node, preds []xpathExpr) ([]Node, error) {
+	for _, pred := range preds {
+		out := []Node{}
+		for i, n := range nodes {
+			v, err := pred.eval(&xpathContext{n, i + 1, len(nodes), env})
+			if err != nil {
+				return nil, err
+			}
+			if f, ok := v.(float64); ok {
+				if f == float64(i+1) {
+					out = append(out, n)
+				}
+			} else if xpathBoolean(v) {
+				out = append(out, n)
+			}
+		}
+		nodes = out
+	}
+	return nodes, nil
+}
+
+type xpathPath struct {
+	absolute bool
+	filter   xpathExpr // set when the path starts with a filter expression
+	steps    []*xpathStep
+}
+
+func (e *xpathPath) eval(c *xpathContext) (interface{}, error) {
+	var nodes []Node
+	switch {
+	case e.filter != nil:
+		v, err := e.filter.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		ns, ok := v.([]Node)
+		if !ok {
+			return nil, c.env.errorf("a location path can only follow a node-set")
+		}
+		nodes = ns
+	case e.absolute:
+		nodes = []Node{c.env.root(c.node)}
+	default:
+		nodes = []Node{c.node}
+	}
+
+	for _, step := range e.steps {
+		next := []Node{}
+		for _, n := range nodes {
+			found, err := step.eval(c.env, n)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, found...)
+		}
+		if len(nodes) > 1 {
+			next = c.env.sortNodes(next)
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+type xpathNodeTest struct {
+	kind string // name, node, text, comment or processing-instruction
+	name string
+}
+
+type xpathStep struct {
+	axis  string
+	test  xpathNodeTest
+	preds []xpathExpr
+}
+
+// returns the nodes selected by the step from the context node n, in
+// document order
+func (s *xpathStep) eval(env *xpathEnv, n Node) ([]Node, error) {
+	candidates, reverse := env.axis(s.axis, n)
+	principal := uint(ELEMENT_NODE)
+	switch s.axis {
+	case "attribute":
+		principal = ATTRIBUTE_NODE
+	case "namespace":
+		principal = XPATH_NAMESPACE_NODE
+	}
+
+	nodes := []Node{}
+	for _, c := range candidates {
+		ok, err := s.test.matches(env, c, principal)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			nodes = append(nodes, c)
+		}
+	}
+	nodes, err := applyPredicates(env, nodes, s.preds)
+	if err != nil {
+		return nil, err
+	}
+	if reverse {
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	}
+	return nodes, nil
+}
+
+func (t *xpathNodeTest) matches(env *xpathEnv, n Node, principal uint) (bool, error) {
+	switch t.kind {
+	case "node":
+		return true, nil
+	case "text":
+		return n.NodeType() == TEXT_NODE || n.NodeType() == CDATA_SECTION_NODE, nil
+	case "comment":
+		return n.NodeType() == COMMENT_NODE, nil
+	case "processing-instruction":
+		return n.NodeType() == PROCESSING_INSTRUCTION_NODE && (t.name == "" || n.NodeName() == t.name), nil
+	}
+
+	if n.NodeType() != principal {
+		return false, nil
+	}
+	if t.name == "*" {
+		return true, nil
+	}
+	prefix, local := splitQualifiedName(t.name)
+	uri := ""
+	if prefix != "" {
+		var ok bool
+		if uri, ok = env.ctx.Namespaces[prefix]; !ok {
+			if prefix != "xml" {
+				return false, env.errorf("undeclared namespace prefix '" + prefix + "'")
+			}
+			uri = XML_NAMESPACE
+		}
+	}
+	if principal == XPATH_NAMESPACE_NODE {
+		return prefix == "" && n.NodeName() == local, nil
+	}
+	if n.NamespaceURI() != uri {
+		return false, nil
+	}
+	return local == "*" || n.LocalName() == local, nil
+}
+
+// returns the nodes on an axis in axis order, and whether that is the
+// reverse of document order
+func (env *xpathEnv) axis(axis string, n Node) ([]Node, bool) {
+	switch axis {
+	case "self":
+		return []Node{n}, false
+	case "child":
+		return env.children(n), false
+	case "parent":
+		if p := env.parent(n); p != nil {
+			return []Node{p}, false
+		}
+		return nil, false
+	case "attribute":
+		if e, ok := n.(*Element); ok {
+			return env.attributes(e), false
+		}
+		return nil, false
+	case "namespace":
+		if e, ok := n.(*Element); ok {
+			return env.namespaces(e), false
+		}
+		return nil, false
+	case "descendant", "descendant-or-self":
+		list := []Node{}
+		if axis == "descendant-or-self" {
+			list = append(list, n)
+		}
+		return env.descendants(list, n), false
+	case "ancestor", "ancestor-or-self":
+		list := []Node{}
+		if axis == "ancestor-or-self" {
+			list = append(list, n)
+		}
+		for p := env.parent(n); p != nil; p = env.parent(p) {
+			list = append(list, p)
+		}
+		return list, true
+	case "following-sibling", "preceding-sibling":
+		if t := n.NodeType(); t == ATTRIBUTE_NODE || t == XPATH_NAMESPACE_NODE {
+			return nil, false
+		}
+		p := env.parent(n)
+		if p == nil {
+			return nil, false
+		}
+		siblings := env.children(p)
+		for i, s := range siblings {
+			if s != n {
+				continue
+			}
+			if axis == "following-sibling" {
+				return siblings[i+1:], false
+			}
+			list := []Node{}
+			for j := i - 1; j >= 0; j-- {
+				list = append(list, siblings[j])
+			}
+			return list, true
+		}
+		return nil, false
+	case "following":
+		list := []Node{}
+		for x := n; x != nil; x = env.parent(x) {
+			if t := x.NodeType(); t == ATTRIBUTE_NODE || t == XPATH_NAMESPACE_NODE {
+				// the children of the owner element follow attributes
+				list = env.descendants(list, env.parent(x))
+				continue
+			}
+			following, _ := env.axis("following-sibling", x)
+			for _, s := range following {
+				list = append(list, s)
+				list = env.descendants(list, s)
+			}
+		}
+		return env.sortNodes(list), false
+	case "preceding":
+		list := []Node{}
+		ancestors := map[Node]bool{}
+		for p := env.parent(n); p != nil; p = env.parent(p) {
+			ancestors[p] = true
+		}
+		target := n
+		if t := n.NodeType(); t == ATTRIBUTE_NODE || t == XPATH_NAMESPACE_NODE {
+			target = env.parent(n)
+		}
+		root := env.root(n)
+		for _, d := range env.descendants([]Node{root}, root) {
+			if d == target {
+				break
+			}
+			if !ancestors[d] {
+				list = append(list, d)
+			}
+		}
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+func (env *xpathEnv) descendants(list []Node, n Node) []Node {
+	for _, c := range env.children(n) {
+		list = append(list, c)
+		list = env.descendants(list, c)
+	}
+	return list
+}
@@ -0,0 +1,312 @@
+package dom
+
+/*
+ * The XPath 1.0 core function library
+ * http://www.w3.org/TR/xpath/#corelib
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+type xpathFunction struct {
+	min, max int // number of arguments, max is -1 when unbounded
+	call     func(c *xpathContext, args []interface{}) (interface{}, error)
+}
+
+var xpathFunctions = map[string]xpathFunction{
+	// Node Set Functions
+	"last":          {0, 0, xpathLast},
+	"position":      {0, 0, xpathPosition},
+	"count":         {1, 1, xpathCount},
+	"id":            {1, 1, xpathId},
+	"local-name":    {0, 1, xpathLocalName},
+	"namespace-uri": {0, 1, xpathNamespaceURI},
+	"name":          {0, 1, xpathName},
+	// String Functions
+	"string":           {0, 1, xpathStringFn},
+	"concat":           {2, -1, xpathConcat},
+	"starts-with":      {2, 2, xpathStartsWith},
+	"contains":         {2, 2, xpathContains},
+	"substring-before": {2, 2, xpathSubstringBefore},
+	"substring-after":  {2, 2, xpathSubstringAfter},
+	"substring":        {2, 3, xpathSubstring},
+	"string-length":    {0, 1, xpathStringLength},
+	"normalize-space":  {0, 1, xpathNormalizeSpace},
+	"translate":        {3, 3, xpathTranslate},
+	// Boolean Functions
+	"boolean": {1, 1, xpathBooleanFn},
+	"not":     {1, 1, xpathNot},
+	"true":    {0, 0, xpathTrue},
+	"false":   {0, 0, xpathFalse},
+	"lang":    {1, 1, xpathLang},
+	// Number Functions
+	"number":  {0, 1, xpathNumberFn},
+	"sum":     {1, 1, xpathSum},
+	"floor":   {1, 1, xpathFloor},
+	"ceiling": {1, 1, xpathCeiling},
+	"round":   {1, 1, xpathRound},
+}
+
+// returns the single argument of a function, or the context node as a
+// node-set when the argument was omitted
+func contextArg(c *xpathContext, args []interface{}) interface{} {
+	if len(args) == 0 {
+		return []Node{c.node}
+	}
+	return args[0]
+}
+
+func nodeSetArg(c *xpathContext, v interface{}, fn string) ([]Node, error) {
+	ns, ok := v.([]Node)
+	if !ok {
+		return nil, c.env.errorf("argument to " + fn + "() must be a node-set")
+	}
+	return ns, nil
+}
+
+func xpathLast(c *xpathContext, args []interface{}) (interface{}, error) {
+	return float64(c.size), nil
+}
+
+func xpathPosition(c *xpathContext, args []interface{}) (interface{}, error) {
+	return float64(c.pos), nil
+}
+
+func xpathCount(c *xpathContext, args []interface{}) (interface{}, error) {
+	ns, err := nodeSetArg(c, args[0], "count")
+	if err != nil {
+		return nil, err
+	}
+	return float64(len(ns)), nil
+}
+
+func xpathId(c *xpathContext, args []interface{}) (interface{}, error) {
+	var ids []string
+	if ns, ok := args[0].([]Node); ok {
+		for _, n := range ns {
+			ids = append(ids, strings.Fields(stringValue(n))...)
+		}
+	} else {
+		ids = strings.Fields(xpathString(args[0]))
+	}
+	root := c.env.root(c.node)
+	nodes := []Node{}
+	for _, id := range ids {
+		var e *Element
+		switch r := root.(type) {
+		case *Document:
+			e = r.GetElementById(id)
+		case *Element:
+			e = r.GetElementById(id)
+		}
+		if e != nil {
+			nodes = append(nodes, e)
+		}
+	}
+	return c.env.sortNodes(nodes), nil
+}
+
+// returns the first node of the argument, or nil for an empty node-set
+func firstNodeArg(c *xpathContext, args []interface{}, fn string) (Node, error) {
+	ns, err := nodeSetArg(c, contextArg(c, args), fn)
+	if err != nil || len(ns) == 0 {
+		return nil, err
+	}
+	return ns[0], nil
+}
+
+func xpathLocalName(c *xpathContext, args []interface{}) (interface{}, error) {
+	n, err := firstNodeArg(c, args, "local-name")
+	if err != nil || n == nil {
+		return "", err
+	}
+	switch n.NodeType() {
+	case ELEMENT_NODE, ATTRIBUTE_NODE, XPATH_NAMESPACE_NODE:
+		return n.LocalName(), nil
+	case PROCESSING_INSTRUCTION_NODE:
+		return n.NodeName(), nil
+	}
+	return "", nil
+}
+
+func xpathNamespaceURI(c *xpathContext, args []interface{}) (interface{}, error) {
+	n, err := firstNodeArg(c, args, "namespace-uri")
+	if err != nil || n == nil {
+		return "", err
+	}
+	switch n.NodeType() {
+	case ELEMENT_NODE, ATTRIBUTE_NODE:
+		return n.NamespaceURI(), nil
+	}
+	return "", nil
+}
+
+func xpathName(c *xpathContext, args []interface{}) (interface{}, error) {
+	n, err := firstNodeArg(c, args, "name")
+	if err != nil || n == nil {
+		return "", err
+	}
+	switch n.NodeType() {
+	case ELEMENT_NODE, ATTRIBUTE_NODE, XPATH_NAMESPACE_NODE, PROCESSING_INSTRUCTION_NODE:
+		return n.NodeName(), nil
+	}
+	return "", nil
+}
+
+func xpathStringFn(c *xpathContext, args []interface{}) (interface{}, error) {
+	return xpathString(contextArg(c, args)), nil
+}
+
+func xpathConcat(c *xpathContext, args []interface{}) (interface{}, error) {
+	var b strings.Builder
+	for _, a := range args {
+		b.WriteString(xpathString(a))
+	}
+	return b.String(), nil
+}
+
+func xpathStartsWith(c *xpathContext, args []interface{}) (interface{}, error) {
+	return strings.HasPrefix(xpathString(args[0]), xpathString(args[1])), nil
+}
+
+func xpathContains(c *xpathContext, args []interface{}) (interface{}, error) {
+	return strings.Contains(xpathString(args[0]), xpathString(args[1])), nil
+}
+
+func xpathSubstringBefore(c *xpathContext, args []interface{}) (interface{}, error) {
+	s, sep := xpathString(args[0]), xpathString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], nil
+	}
+	return "", nil
+}
+
+func xpathSubstringAfter(c *xpathContext, args []interface{}) (interface{}, error) {
+	s, sep := xpathString(args[0]), xpathString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[i+len(sep):], nil
+	}
+	return "", nil
+}
+
+// positions are counted in characters, starting from 1
+func xpathSubstring(c *xpathContext, args []interface{}) (interface{}, error) {
+	runes := []rune(xpathString(args[0]))
+	start := xpathRoundNumber(xpathNumber(args[1]))
+	end := math.Inf(1)
+	if len(args) == 3 {
+		end = start + xpathRoundNumber(xpathNumber(args[2]))
+	}
+	var b strings.Builder
+	for i, r := range runes {
+		if p := float64(i + 1); p >= start && p < end {
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
+
+func xpathStringLength(c *xpathContext, args []interface{}) (interface{}, error) {
+	return float64(utf8.RuneCountInString(xpathString(contextArg(c, args)))), nil
+}
+
+func xpathNormalizeSpace(c *xpathContext, args []interface{}) (interface{}, error) {
+	return strings.Join(strings.FieldsFunc(xpathString(contextArg(c, args)), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	}), " "), nil
+}
+
+func xpathTranslate(c *xpathContext, args []interface{}) (interface{}, error) {
+	from, to := []rune(xpathString(args[1])), []rune(xpathString(args[2]))
+	mapping := map[rune]int{}
+	for i, r := range from {
+		if _, ok := mapping[r]; !ok {
+			mapping[r] = i
+		}
+	}
+	var b strings.Builder
+	for _, r := range xpathString(args[0]) {
+		i, ok := mapping[r]
+		switch {
+		case !ok:
+			b.WriteRune(r)
+		case i < len(to):
+			b.WriteRune(to[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func xpathBooleanFn(c *xpathContext, args []interface{}) (interface{}, error) {
+	return xpathBoolean(args[0]), nil
+}
+
+func xpathNot(c *xpathContext, args []interface{}) (interface{}, error) {
+	return !xpathBoolean(args[0]), nil
+}
+
+func xpathTrue(c *xpathContext, args []interface{}) (interface{}, error) {
+	return true, nil
+}
+
+func xpathFalse(c *xpathContext, args []interface{}) (interface{}, error) {
+	return false, nil
+}
+
+// http://www.w3.org/TR/xpath/#function-lang
+func xpathLang(c *xpathContext, args []interface{}) (interface{}, error) {
+	want := strings.ToLower(xpathString(args[0]))
+	for n := c.node; n != nil; n = c.env.parent(n) {
+		e, ok := n.(*Element)
+		if !ok || !e.HasAttributeNS(XML_NAMESPACE, "lang") {
+			continue
+		}
+		lang := strings.ToLower(e.GetAttributeNS(XML_NAMESPACE, "lang"))
+		return lang == want || strings.HasPrefix(lang, want+"-"), nil
+	}
+	return false, nil
+}
+
+func xpathNumberFn(c *xpathContext, args []interface{}) (interface{}, error) {
+	return xpathNumber(contextArg(c, args)), nil
+}
+
+func xpathSum(c *xpathContext, args []interface{}) (interface{}, error) {
+	ns, err := nodeSetArg(c, args[0], "sum")
+	if err != nil {
+		return nil, err
+	}
+	sum := 0.0
+	for _, n := range ns {
+		sum += parseXPathNumber(stringValue(n))
+	}
+	return sum, nil
+}
+
+func xpathFloor(c *xpathContext, args []interface{}) (interface{}, error) {
+	return math.Floor(xpathNumber(args[0])), nil
+}
+
+func xpathCeiling(c *xpathContext, args []interface{}) (interface{}, error) {
+	return math.Ceil(xpathNumber(args[0])), nil
+}
+
+func xpathRound(c *xpathContext, args []interface{}) (interface{}, error) {
+	return xpathRoundNumber(xpathNumber(args[0])), nil
+}
+
+// rounds half way cases towards positive infinity
+func xpathRoundNumber(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	if f < 0 && f >= -0.5 {
+		return math.Copysign(0, -1)
+	}
+	return math.Floor(f + 0.5)
+}
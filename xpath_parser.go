@@ -0,0 +1,566 @@
+package dom
+
+/*
+ * Tokenizer and recursive descent parser for XPath 1.0 expressions
+ * http://www.w3.org/TR/xpath/#exprlex
+ *
+ * Copyright (c) 2011,2012 Robert Johnstone
+ */
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	xtEOF      = iota
+	xtPunct    // ( ) [ ] . .. @ , ::
+	xtOperator // and or mod div / // | + - = != < <= > >= *
+	xtNameTest // * NCName:* QName
+	xtNodeType // comment text processing-instruction node
+	xtFunction // function name
+	xtAxis     // axis name
+	xtLiteral  // quoted string
+	xtNumber   // number
+	xtVariable // $QName
+)
+
+type xpathToken struct {
+	kind int
+	val  string
+	pos  int
+}
+
+type xpathLexer struct {
+	expr   string
+	pos    int
+	tokens []xpathToken
+}
+
+func isNCNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNCNameChar(r rune) bool {
+	return isNCNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r) ||
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) || r == 0xB7
+}
+
+func (l *xpathLexer) errorf(pos int, msg string) error {
+	return &XPathError{l.expr, pos, msg}
+}
+
+func (l *xpathLexer) peekRune(off int) rune {
+	if l.pos+off >= len(l.expr) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.expr[l.pos+off:])
+	return r
+}
+
+func (l *xpathLexer) skipSpace() {
+	for l.pos < len(l.expr) && strings.IndexByte(" \t\r\n", l.expr[l.pos]) >= 0 {
+		l.pos++
+	}
+}
+
+func (l *xpathLexer) ncname() string {
+	start := l.pos
+	for l.pos < len(l.expr) {
+		r, size := utf8.DecodeRuneInString(l.expr[l.pos:])
+		if (l.pos == start && !isNCNameStart(r)) || (l.pos > start && !isNCNameChar(r)) {
+			break
+		}
+		l.pos += size
+	}
+	return l.expr[start:l.pos]
+}
+
+// The preceding token decides whether * and names are operators.
+// http://www.w3.org/TR/xpath/#exprlex
+func (l *xpathLexer) operatorExpected() bool {
+	if len(l.tokens) == 0 {
+		return false
+	}
+	t := l.tokens[len(l.tokens)-1]
+	switch t.kind {
+	case xtOperator:
+		return false
+	case xtPunct:
+		return t.val == ")" || t.val == "]" || t.val == "." || t.val == ".."
+	}
+	return true
+}
+
+func (l *xpathLexer) lex() ([]xpathToken, error) {
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.expr) {
+			l.tokens = append(l.tokens, xpathToken{xtEOF, "", l.pos})
+			return l.tokens, nil
+		}
+		start := l.pos
+		c := l.expr[l.pos]
+		emit := func(kind int, val string) {
+			l.tokens = append(l.tokens, xpathToken{kind, val, start})
+		}
+		switch {
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',' || c == '@':
+			l.pos++
+			emit(xtPunct, string(c))
+		case c == '.' && l.peekRune(1) == '.':
+			l.pos += 2
+			emit(xtPunct, "..")
+		case c == '.' && !(l.peekRune(1) >= '0' && l.peekRune(1) <= '9'):
+			l.pos++
+			emit(xtPunct, ".")
+		case c == ':' && l.peekRune(1) == ':':
+			l.pos += 2
+			emit(xtPunct, "::")
+		case c == '/' && l.peekRune(1) == '/':
+			l.pos += 2
+			emit(xtOperator, "//")
+		case c == '!' && l.peekRune(1) == '=':
+			l.pos += 2
+			emit(xtOperator, "!=")
+		case (c == '<' || c == '>') && l.peekRune(1) == '=':
+			l.pos += 2
+			emit(xtOperator, l.expr[start:l.pos])
+		case strings.IndexByte("/|+-=<>", c) >= 0:
+			l.pos++
+			emit(xtOperator, string(c))
+		case c == '*':
+			l.pos++
+			if l.operatorExpected() {
+				emit(xtOperator, "*")
+			} else {
+				emit(xtNameTest, "*")
+			}
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(l.expr[l.pos+1:], c)
+			if end < 0 {
+				return nil, l.errorf(start, "unterminated string literal")
+			}
+			emit(xtLiteral, l.expr[l.pos+1:l.pos+1+end])
+			l.pos += end + 2
+		case c >= '0' && c <= '9' || c == '.':
+			for l.pos < len(l.expr) && l.expr[l.pos] >= '0' && l.expr[l.pos] <= '9' {
+				l.pos++
+			}
+			if l.pos < len(l.expr) && l.expr[l.pos] == '.' {
+				l.pos++
+				for l.pos < len(l.expr) && l.expr[l.pos] >= '0' && l.expr[l.pos] <= '9' {
+					l.pos++
+				}
+			}
+			emit(xtNumber, l.expr[start:l.pos])
+		case c == '$':
+			l.pos++
+			name, err := l.qname()
+			if err != nil {
+				return nil, err
+			}
+			emit(xtVariable, name)
+		default:
+			if !isNCNameStart(l.peekRune(0)) {
+				return nil, l.errorf(start, "unexpected character '"+string(l.peekRune(0))+"'")
+			}
+			if l.operatorExpected() {
+				name := l.ncname()
+				switch name {
+				case "and", "or", "mod", "div":
+					emit(xtOperator, name)
+				default:
+					return nil, l.errorf(start, "expected an operator but found '"+name+"'")
+				}
+				continue
+			}
+			name, err := l.qname()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasSuffix(name, ":*") {
+				emit(xtNameTest, name)
+				continue
+			}
+			// look ahead to distinguish function names, node types and axes
+			save := l.pos
+			l.skipSpace()
+			switch {
+			case l.peekRune(0) == '(':
+				switch name {
+				case "comment", "text", "processing-instruction", "node":
+					emit(xtNodeType, name)
+				default:
+					emit(xtFunction, name)
+				}
+			case l.peekRune(0) == ':' && l.peekRune(1) == ':':
+				emit(xtAxis, name)
+			default:
+				emit(xtNameTest, name)
+			}
+			l.pos = save
+		}
+	}
+}
+
+// reads a QName, or a name test of the form NCName:*
+func (l *xpathLexer) qname() (string, error) {
+	start := l.pos
+	if l.ncname() == "" {
+		return "", l.errorf(start, "expected a name")
+	}
+	if l.peekRune(0) == ':' && l.peekRune(1) != ':' {
+		l.pos++
+		if l.peekRune(0) == '*' {
+			l.pos++
+		} else if l.ncname() == "" {
+			return "", l.errorf(start, "invalid qualified name")
+		}
+	}
+	return l.expr[start:l.pos], nil
+}
+
+// ====================================
+
+type xpathParser struct {
+	expr   string
+	tokens []xpathToken
+	i      int
+}
+
+func parseXPath(expr string) (xpathExpr, error) {
+	lexer := &xpathLexer{expr: expr}
+	tokens, err := lexer.lex()
+	if err != nil {
+		return nil, err
+	}
+	p := &xpathParser{expr, tokens, 0}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != xtEOF {
+		return nil, p.errorf(t, "unexpected '"+t.val+"'")
+	}
+	return e, nil
+}
+
+func (p *xpathParser) peek() xpathToken { return p.tokens[p.i] }
+func (p *xpathParser) next() xpathToken { t := p.tokens[p.i]; p.i++; return t }
+
+func (p *xpathParser) errorf(t xpathToken, msg string) error {
+	if t.kind == xtEOF {
+		msg = "unexpected end of expression"
+	}
+	return &XPathError{p.expr, t.pos, msg}
+}
+
+func (p *xpathParser) is(kind int, val string) bool {
+	t := p.peek()
+	return t.kind == kind && t.val == val
+}
+
+func (p *xpathParser) expect(kind int, val string) error {
+	if t := p.next(); t.kind != kind || t.val != val {
+		return p.errorf(t, "expected '"+val+"'")
+	}
+	return nil
+}
+
+// parses a left associative chain of binary operators
+func (p *xpathParser) parseBinary(ops []string, operand func() (xpathExpr, error)) (xpathExpr, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		found := false
+		for _, op := range ops {
+			if t.kind == xtOperator && t.val == op {
+				found = true
+			}
+		}
+		if !found {
+			return l, nil
+		}
+		p.next()
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l = &xpathBinary{t.val, l, r}
+	}
+}
+
+func (p *xpathParser) parseOr() (xpathExpr, error) {
+	return p.parseBinary([]string{"or"}, p.parseAnd)
+}
+
+func (p *xpathParser) parseAnd() (xpathExpr, error) {
+	return p.parseBinary([]string{"and"}, p.parseEquality)
+}
+
+func (p *xpathParser) parseEquality() (xpathExpr, error) {
+	return p.parseBinary([]string{"=", "!="}, p.parseRelational)
+}
+
+func (p *xpathParser) parseRelational() (xpathExpr, error) {
+	return p.parseBinary([]string{"<", ">", "<=", ">="}, p.parseAdditive)
+}
+
+func (p *xpathParser) parseAdditive() (xpathExpr, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseMultiplicative)
+}
+
+func (p *xpathParser) parseMultiplicative() (xpathExpr, error) {
+	return p.parseBinary([]string{"*", "div", "mod"}, p.parseUnary)
+}
+
+func (p *xpathParser) parseUnary() (xpathExpr, error) {
+	if p.is(xtOperator, "-") {
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &xpathNegate{e}, nil
+	}
+	return p.parseBinary([]string{"|"}, p.parsePath)
+}
+
+func (p *xpathParser) parsePath() (xpathExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == xtVariable || t.kind == xtLiteral || t.kind == xtNumber ||
+		t.kind == xtFunction || (t.kind == xtPunct && t.val == "("):
+		// FilterExpr (('/' | '//') RelativeLocationPath)?
+		e, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(xtOperator, "/") && !p.is(xtOperator, "//") {
+			return e, nil
+		}
+		path := &xpathPath{filter: e}
+		if err := p.parseRelativePath(path); err != nil {
+			return nil, err
+		}
+		return path, nil
+
+	case t.kind == xtOperator && (t.val == "/" || t.val == "//"):
+		path := &xpathPath{absolute: true}
+		if t.val == "/" {
+			p.next()
+			if !p.startsStep() {
+				return path, nil
+			}
+			if err := p.parseSteps(path); err != nil {
+				return nil, err
+			}
+			return path, nil
+		}
+		if err := p.parseRelativePath(path); err != nil {
+			return nil, err
+		}
+		return path, nil
+	}
+
+	path := &xpathPath{}
+	if err := p.parseSteps(path); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+func (p *xpathParser) startsStep() bool {
+	t := p.peek()
+	switch t.kind {
+	case xtNameTest, xtNodeType, xtAxis:
+		return true
+	case xtPunct:
+		return t.val == "@" || t.val == "." || t.val == ".."
+	}
+	return false
+}
+
+// parses ('/' | '//') RelativeLocationPath
+func (p *xpathParser) parseRelativePath(path *xpathPath) error {
+	if t := p.next(); t.val == "//" {
+		path.steps = append(path.steps, descendantOrSelfStep())
+	}
+	return p.parseSteps(path)
+}
+
+// parses Step (('/' | '//') Step)*
+func (p *xpathParser) parseSteps(path *xpathPath) error {
+	for {
+		step, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, step)
+		if t := p.peek(); t.kind == xtOperator && (t.val == "/" || t.val == "//") {
+			p.next()
+			if t.val == "//" {
+				path.steps = append(path.steps, descendantOrSelfStep())
+			}
+			continue
+		}
+		return nil
+	}
+}
+
+func descendantOrSelfStep() *xpathStep {
+	return &xpathStep{axis: "descendant-or-self", test: xpathNodeTest{kind: "node"}}
+}
+
+var xpathAxes = map[string]bool{
+	"ancestor": true, "ancestor-or-self": true, "attribute": true, "child": true,
+	"descendant": true, "descendant-or-self": true, "following": true,
+	"following-sibling": true, "namespace": true, "parent": true, "preceding": true,
+	"preceding-sibling": true, "self": true,
+}
+
+func (p *xpathParser) parseStep() (*xpathStep, error) {
+	t := p.next()
+	switch {
+	case t.kind == xtPunct && t.val == ".":
+		return &xpathStep{axis: "self", test: xpathNodeTest{kind: "node"}}, nil
+	case t.kind == xtPunct && t.val == "..":
+		return &xpathStep{axis: "parent", test: xpathNodeTest{kind: "node"}}, nil
+	}
+
+	step := &xpathStep{axis: "child"}
+	switch {
+	case t.kind == xtAxis:
+		if !xpathAxes[t.val] {
+			return nil, p.errorf(t, "unknown axis '"+t.val+"'")
+		}
+		step.axis = t.val
+		if err := p.expect(xtPunct, "::"); err != nil {
+			return nil, err
+		}
+		t = p.next()
+	case t.kind == xtPunct && t.val == "@":
+		step.axis = "attribute"
+		t = p.next()
+	}
+
+	switch t.kind {
+	case xtNameTest:
+		step.test = xpathNodeTest{kind: "name", name: t.val}
+	case xtNodeType:
+		step.test = xpathNodeTest{kind: t.val}
+		if err := p.expect(xtPunct, "("); err != nil {
+			return nil, err
+		}
+		if t.val == "processing-instruction" && p.peek().kind == xtLiteral {
+			step.test.name = p.next().val
+		}
+		if err := p.expect(xtPunct, ")"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf(t, "expected a node test")
+	}
+
+	preds, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	step.preds = preds
+	return step, nil
+}
+
+func (p *xpathParser) parsePredicates() ([]xpathExpr, error) {
+	var preds []xpathExpr
+	for p.is(xtPunct, "[") {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(xtPunct, "]"); err != nil {
+			return nil, err
+		}
+		preds = append(preds, e)
+	}
+	return preds, nil
+}
+
+func (p *xpathParser) parseFilter() (xpathExpr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	preds, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	if len(preds) == 0 {
+		return e, nil
+	}
+	return &xpathFilter{e, preds}, nil
+}
+
+func (p *xpathParser) parsePrimary() (xpathExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case xtVariable:
+		return &xpathVariable{t.val}, nil
+	case xtLiteral:
+		return xpathLiteral(t.val), nil
+	case xtNumber:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number")
+		}
+		return xpathNumberLiteral(f), nil
+	case xtFunction:
+		return p.parseFunctionCall(t)
+	}
+	// only '(' is left
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(xtPunct, ")"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *xpathParser) parseFunctionCall(name xpathToken) (xpathExpr, error) {
+	fn, ok := xpathFunctions[name.val]
+	if !ok {
+		return nil, p.errorf(name, "unknown function '"+name.val+"'")
+	}
+	if err := p.expect(xtPunct, "("); err != nil {
+		return nil, err
+	}
+	call := &xpathCall{name: name.val, fn: fn}
+	if !p.is(xtPunct, ")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.is(xtPunct, ",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expect(xtPunct, ")"); err != nil {
+		return nil, err
+	}
+	if len(call.args) < fn.min || (fn.max >= 0 && len(call.args) > fn.max) {
+		return nil, p.errorf(name, "wrong number of arguments to "+name.val+"()")
+	}
+	return call, nil
+}
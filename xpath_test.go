@@ -0,0 +1,217 @@
+package dom
+
+import (
+	"math"
+	"testing"
+)
+
+const xpathDoc = `<library xmlns:b="urn:books">
+<shelf id="s1"><b:book id="b1" year="1990" lang="en"><title xml:lang="en-GB">Alpha</title><price>10</price></b:book><b:book id="b2" year="2005"><title>Beta</title><price>25.5</price></b:book></shelf>
+<shelf id="s2"><!-- empty --><b:book id="b3" year="2010"><title>Gamma</title><price>4.5</price></b:book></shelf>
+</library>`
+
+func evalXPath(t *testing.T, d *Document, expr string, ctx *XPathContext) *XPathResult {
+	x, err := CompileXPath(expr)
+	if err != nil {
+		t.Fatalf("Error compiling %s (%v).", expr, err)
+	}
+	r, err := x.EvaluateWith(d, ctx)
+	if err != nil {
+		t.Fatalf("Error evaluating %s (%v).", expr, err)
+	}
+	return r
+}
+
+func TestXPathNodeSets(t *testing.T) {
+	d, _ := ParseStringXml(xpathDoc)
+	ctx := &XPathContext{Namespaces: map[string]string{"bk": "urn:books"}}
+	test_cases := []struct {
+		expr  string
+		count uint
+		first string
+	}{
+		{"/library/shelf", 2, "s1"},
+		{"//bk:book", 3, "b1"},
+		{"//bk:book[2]", 1, "b2"},
+		{"//bk:book[last()]", 2, "b2"},
+		{"(//bk:book)[last()]", 1, "b3"},
+		{"//bk:book[@year > 2000]/@id", 2, "b2"},
+		{"//bk:book[price < 20]", 2, "b1"},
+		{"//shelf[bk:book/title = 'Gamma']", 1, "s2"},
+		{"//title[. = 'Beta']/../@id", 1, "b2"},
+		{"(//bk:book)[3]/preceding::bk:book", 2, "b1"},
+		{"//bk:book[1]/following::bk:book", 2, "b2"},
+		{"//bk:book[@id='b2']/preceding-sibling::*", 1, "b1"},
+		{"//bk:book[@id='b1']/following-sibling::bk:book", 1, "b2"},
+		{"//title[.='Gamma']/ancestor::*[@id]", 2, "s2"},
+		{"//title[.='Gamma']/ancestor-or-self::*[1]", 1, ""},
+		{"//shelf/@id | //bk:book/@id", 5, "s1"},
+		{"//bk:*[@lang]", 1, "b1"},
+		{"id('b3 s1')", 2, "s1"},
+		{"//shelf[2]/comment()", 1, ""},
+		{"/descendant::price[position() mod 2 = 1]", 2, ""},
+		{"//bk:book[not(@lang)]", 2, "b2"},
+	}
+	for _, tc := range test_cases {
+		r := evalXPath(t, d, tc.expr, ctx)
+		if r.Type() != XPATH_NODE_SET {
+			t.Errorf("%s did not return a node-set", tc.expr)
+			continue
+		}
+		nl := r.Nodes()
+		if nl.Length() != tc.count {
+			t.Errorf("%s returned %d nodes instead of %d", tc.expr, nl.Length(), tc.count)
+			continue
+		}
+		if tc.first == "" {
+			continue
+		}
+		first := nl.Item(0)
+		id := first.NodeValue()
+		if e, ok := first.(*Element); ok {
+			id = e.GetAttribute("id")
+		}
+		if id != tc.first {
+			t.Errorf("%s returned %s as the first node instead of %s", tc.expr, id, tc.first)
+		}
+	}
+}
+
+func TestXPathValues(t *testing.T) {
+	d, _ := ParseStringXml(xpathDoc)
+	ctx := &XPathContext{
+		Namespaces: map[string]string{"bk": "urn:books"},
+		Variables:  map[string]interface{}{"min": 5, "name": "Beta"},
+	}
+	test_cases := []struct{ expr, expected string }{
+		{"count(//bk:book)", "3"},
+		{"sum(//price)", "40"},
+		{"sum(//price) div count(//price)", "13.333333333333334"},
+		{"string(//bk:book[2]/title)", "Beta"},
+		{"concat('a', 1, true())", "a1true"},
+		{"substring('12345', 1.5, 2.6)", "234"},
+		{"substring('12345', 0, 3)", "12"},
+		{"substring('12345', 0 div 0, 3)", ""},
+		{"substring-before('1999/04/01', '/')", "1999"},
+		{"substring-after('1999/04/01', '/')", "04/01"},
+		{"translate('bar', 'abc', 'ABC')", "BAr"},
+		{"translate('--aaa--', 'abc-', 'ABC')", "AAA"},
+		{"normalize-space('  a \n b  ')", "a b"},
+		{"string-length('été')", "3"},
+		{"local-name(//bk:book)", "book"},
+		{"name(//bk:book)", "b:book"},
+		{"namespace-uri(//bk:book)", "urn:books"},
+		{"count(//bk:book[price > $min])", "2"},
+		{"//bk:book[title = $name]/@year", "2005"},
+		{"round(2.5)", "3"},
+		{"round(-2.5)", "-2"},
+		{"floor(-1.5)", "-2"},
+		{"ceiling(1.2)", "2"},
+		{"1 div 0", "Infinity"},
+		{"-1 div 0", "-Infinity"},
+		{"number('abc')", "NaN"},
+		{"7 mod -3", "1"},
+		{"-(3 - 5) * 2", "4"},
+		{"//bk:book[1]/title/@xml:lang", "en-GB"},
+		{"count((//bk:book)[1]/namespace::*)", "2"},
+		{"starts-with(//shelf/@id, 's')", "true"},
+		{"lang('en')", "false"},
+		{"count(//title[lang('en')])", "1"},
+		{"//shelf = 'nothing'", "false"},
+		{"//price = 25.5", "true"},
+		{"//price != 10", "true"},
+		{"2 > 1 and 1 > 2 or true()", "true"},
+	}
+	for _, tc := range test_cases {
+		r := evalXPath(t, d, tc.expr, ctx)
+		if r.String() != tc.expected {
+			t.Errorf("%s returned '%s' instead of '%s'", tc.expr, r.String(), tc.expected)
+		}
+	}
+}
+
+func TestXPathResultConversions(t *testing.T) {
+	d, _ := ParseStringXml(xpathDoc)
+	r := evalXPath(t, d, "//price", nil)
+	if r.Number() != 10 || r.String() != "10" || !r.Bool() {
+		t.Errorf("Node-set conversions not implemented correctly")
+	}
+	r = evalXPath(t, d, "//missing", nil)
+	if !math.IsNaN(r.Number()) || r.String() != "" || r.Bool() || r.Nodes().Length() != 0 {
+		t.Errorf("Empty node-set conversions not implemented correctly")
+	}
+	r = evalXPath(t, d, "1 = 1", nil)
+	if r.Type() != XPATH_BOOLEAN || r.Nodes() != nil || r.Number() != 1 {
+		t.Errorf("Boolean conversions not implemented correctly")
+	}
+}
+
+func TestXPathCompileOnce(t *testing.T) {
+	x := MustCompileXPath("count(*)")
+	d1, _ := ParseStringXml(`<a><b/><b/></a>`)
+	d2, _ := ParseStringXml(`<a><b/></a>`)
+	r1, _ := x.Evaluate(d1.DocumentElement())
+	r2, _ := x.Evaluate(d2.DocumentElement())
+	if r1.Number() != 2 || r2.Number() != 1 {
+		t.Errorf("Compiled expression not reusable across documents")
+	}
+	if x.String() != "count(*)" {
+		t.Errorf("XPath.String() did not return the expression")
+	}
+}
+
+func TestXPathRelativeContext(t *testing.T) {
+	d, _ := ParseStringXml(xpathDoc)
+	shelf := d.GetElementById("s2")
+	x := MustCompileXPath("count(.//title) + count(/library/shelf)")
+	r, err := x.Evaluate(shelf)
+	if err != nil || r.Number() != 3 {
+		t.Errorf("Expression not evaluated relative to the context node")
+	}
+	n, err := MustCompileXPath("..").SelectNode(shelf)
+	if err != nil || n != d.DocumentElement() {
+		t.Errorf("XPath.SelectNode() did not return the parent")
+	}
+	a, _ := MustCompileXPath("@id").SelectNode(shelf)
+	p, _ := MustCompileXPath("..").SelectNode(a)
+	if a == nil || p != nil {
+		// attribute nodes from outside the evaluation have no known owner
+		t.Errorf("Attribute context node not handled")
+	}
+	p, _ = MustCompileXPath("@id/..").SelectNode(shelf)
+	if p != shelf {
+		t.Errorf("Parent of an attribute is not its owner element")
+	}
+}
+
+func TestXPathErrors(t *testing.T) {
+	bad := []string{"", "//", "foo(", "unknown()", "count()", "a[1", "'abc", "1 +", "child::", "bogus::a", "a b"}
+	for _, expr := range bad {
+		if _, err := CompileXPath(expr); err == nil {
+			t.Errorf("Compiled invalid expression '%s'", expr)
+		}
+	}
+	d, _ := ParseStringXml(xpathDoc)
+	for _, expr := range []string{"$undefined", "//p:book", "count(1)", "1 | //a"} {
+		if _, err := MustCompileXPath(expr).Evaluate(d); err == nil {
+			t.Errorf("Evaluated invalid expression '%s'", expr)
+		}
+	}
+}
+
+func TestXPathLexerDisambiguation(t *testing.T) {
+	d, _ := ParseStringXml(`<r><div>6</div><mod>4</mod><and>2</and></r>`)
+	test_cases := []struct{ expr, expected string }{
+		{"r/div div r/and", "3"},
+		{"r/div mod r/mod", "2"},
+		{"r/*[2] * 2", "8"},
+		{"count(r/*)", "3"},
+		{"r/and and r/mod", "true"},
+	}
+	for _, tc := range test_cases {
+		r := evalXPath(t, d, tc.expr, nil)
+		if r.String() != tc.expected {
+			t.Errorf("%s returned '%s' instead of '%s'", tc.expr, r.String(), tc.expected)
+		}
+	}
+}